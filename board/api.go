@@ -1,6 +1,8 @@
 package board
 
 import (
+	"encoding/json"
+
 	"github.com/BattlesnakeOfficial/rules"
 )
 
@@ -20,6 +22,16 @@ type Game struct {
 	Map          string            `json:"Map"`
 }
 
+// Values for the Game Status field.
+const (
+	GameStatusQueued    = "queued"
+	GameStatusRunning   = "running"
+	GameStatusComplete  = "complete"
+	GameStatusCancelled = "cancelled"
+	GameStatusError     = "error"
+	GameStatusAborted   = "aborted" // interrupted by the server stopping
+)
+
 // The websocket stream has support for returning different types of events, along with a "type" attribute.
 type GameEventType string
 
@@ -34,6 +46,43 @@ type GameEvent struct {
 	Data      interface{}   `json:"Data"`
 }
 
+// Decode the event data into the type matching the event type, so that stored events
+// can be used in the same way as events sent directly by the game runner.
+func (event *GameEvent) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		EventType GameEventType   `json:"Type"`
+		Data      json.RawMessage `json:"Data"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	event.EventType = raw.EventType
+	switch raw.EventType {
+	case EVENT_TYPE_FRAME:
+		var frame GameFrame
+		if err := json.Unmarshal(raw.Data, &frame); err != nil {
+			return err
+		}
+		event.Data = frame
+	case EVENT_TYPE_GAME_END:
+		var game Game
+		if err := json.Unmarshal(raw.Data, &game); err != nil {
+			return err
+		}
+		event.Data = game
+	default:
+		var eventData interface{}
+		if len(raw.Data) > 0 {
+			if err := json.Unmarshal(raw.Data, &eventData); err != nil {
+				return err
+			}
+		}
+		event.Data = eventData
+	}
+	return nil
+}
+
 // Represents a single turn in the game.
 type GameFrame struct {
 	Turn    int           `json:"Turn"`
@@ -0,0 +1,108 @@
+package board
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/spf13/jwalterweatherman"
+)
+
+// Record collection holding a copy of each game that hasn't been saved to the store yet.
+const checkpointsCollection = "game_checkpoints"
+
+// A copy of an unsaved game, so that it isn't lost if the server stops before the game is saved.
+type gameCheckpoint struct {
+	Game    Game        `json:"Game"`
+	Events  []GameEvent `json:"Events"`
+	Created time.Time   `json:"Created"`
+	Ended   time.Time   `json:"Ended"` // zero while the game is still running
+}
+
+// Must be called with the lock held.
+func (gameState *GameState) checkpoint() gameCheckpoint {
+	return gameCheckpoint{
+		Game:    gameState.game,
+		Events:  append([]GameEvent(nil), gameState.events...),
+		Created: gameState.created,
+		Ended:   gameState.ended,
+	}
+}
+
+// Save a checkpoint of every game that is still running or queued, with the events sent so far.
+// This should be done regularly, and before the server stops, so that RecoverGames loses as little as possible.
+func (s *PersistentBoardServer) Checkpoint() error {
+	s.mu.RLock()
+	checkpoints := make([]gameCheckpoint, 0, len(s.activeGames))
+	for _, gameState := range s.activeGames {
+		if gameState.isLive {
+			checkpoints = append(checkpoints, gameState.checkpoint())
+		}
+	}
+	s.mu.RUnlock()
+
+	var errs []error
+	for _, checkpoint := range checkpoints {
+		if err := s.store.PutRecord(checkpointsCollection, checkpoint.Game.ID, checkpoint); err != nil {
+			errs = append(errs, fmt.Errorf("unable to checkpoint game %s: %w", checkpoint.Game.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Save the games left behind when the server last stopped, returning the number of games recovered.
+// Games that had ended but weren't saved are saved as they were, and games that were interrupted are saved
+// with the "aborted" status, keeping the events from their last checkpoint.
+// Listeners are called for each recovered game, so this should be done once they have been registered
+// and before any games are added.
+func (s *PersistentBoardServer) RecoverGames() (int, error) {
+	gameIDs, err := s.store.ListRecords(checkpointsCollection)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.RLock()
+	listeners := s.gameEndListeners
+	s.mu.RUnlock()
+
+	recovered := 0
+	for _, gameID := range gameIDs {
+		var checkpoint gameCheckpoint
+		if err := s.store.GetRecord(checkpointsCollection, gameID, &checkpoint); errors.Is(err, ErrRecordNotFound) {
+			continue
+		} else if err != nil {
+			return recovered, err
+		}
+
+		// A checkpoint taken just as a game ended can outlive it, and mustn't replace the saved game
+		if _, err := s.store.GetGame(gameID); err == nil {
+			if err := s.store.DeleteRecord(checkpointsCollection, gameID); err != nil {
+				return recovered, err
+			}
+			continue
+		}
+
+		if checkpoint.Ended.IsZero() {
+			checkpoint.Game.Status = GameStatusAborted
+			checkpoint.Ended = time.Now()
+			checkpoint.Events = append(checkpoint.Events, GameEvent{
+				EventType: EVENT_TYPE_GAME_END,
+				Data:      checkpoint.Game,
+			})
+		}
+		summary := NewGameSummary(checkpoint.Game, checkpoint.Events, checkpoint.Created, checkpoint.Ended)
+		if err := s.store.SaveGame(summary, checkpoint.Events); err != nil {
+			return recovered, fmt.Errorf("unable to save recovered game %s: %w", gameID, err)
+		}
+		if err := s.store.DeleteRecord(checkpointsCollection, gameID); err != nil {
+			return recovered, err
+		}
+		log.INFO.Printf("Recovered game %s with status %s", gameID, summary.Game.Status)
+		recovered++
+
+		for _, listener := range listeners {
+			listener(summary, checkpoint.Events)
+		}
+	}
+	return recovered, nil
+}
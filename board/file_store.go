@@ -0,0 +1,277 @@
+package board
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	fileStoreGameFile    = "game.json"
+	fileStoreSummaryFile = "summary.json"
+	fileStoreEventsFile  = "events.jsonl"
+	fileStoreRecordsDir  = "_records"
+	fileStoreRecordExt   = ".json"
+)
+
+// FileGameStore keeps each game in its own directory, holding the game metadata and summary
+// as JSON and the event log as one JSON event per line.
+// Other records are kept in the _records directory, with one directory per collection and one JSON file per record.
+type FileGameStore struct {
+	dir string
+}
+
+func NewFileGameStore(dir string) (*FileGameStore, error) {
+	if dir == "" {
+		return nil, errors.New("a directory is required for the file storage backend")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create storage directory: %w", err)
+	}
+	return &FileGameStore{dir: dir}, nil
+}
+
+func (store *FileGameStore) SaveGame(summary GameSummary, events []GameEvent) error {
+	gameDir, err := store.gameDir(summary.Game.ID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(gameDir, 0755); err != nil {
+		return fmt.Errorf("unable to create game directory: %w", err)
+	}
+
+	// Write the events first, so that a game is only visible once its event log is complete
+	var eventLines strings.Builder
+	for _, event := range events {
+		eventJSON, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("unable to serialize event: %w", err)
+		}
+		eventLines.Write(eventJSON)
+		eventLines.WriteString("\n")
+	}
+	if err := writeFileAtomic(filepath.Join(gameDir, fileStoreEventsFile), []byte(eventLines.String())); err != nil {
+		return err
+	}
+
+	gameJSON, err := json.Marshal(summary.Game)
+	if err != nil {
+		return fmt.Errorf("unable to serialize game: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(gameDir, fileStoreGameFile), gameJSON); err != nil {
+		return err
+	}
+
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("unable to serialize game summary: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(gameDir, fileStoreSummaryFile), summaryJSON)
+}
+
+func (store *FileGameStore) GetGame(gameID string) (Game, error) {
+	gameDir, err := store.gameDir(gameID)
+	if err != nil {
+		return Game{}, err
+	}
+	gameJSON, err := os.ReadFile(filepath.Join(gameDir, fileStoreGameFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return Game{}, ErrGameNotFound
+	} else if err != nil {
+		return Game{}, fmt.Errorf("unable to read game: %w", err)
+	}
+
+	var game Game
+	if err := json.Unmarshal(gameJSON, &game); err != nil {
+		return Game{}, fmt.Errorf("unable to parse game: %w", err)
+	}
+	return game, nil
+}
+
+func (store *FileGameStore) GetSummary(gameID string) (GameSummary, error) {
+	gameDir, err := store.gameDir(gameID)
+	if err != nil {
+		return GameSummary{}, err
+	}
+	summaryJSON, err := os.ReadFile(filepath.Join(gameDir, fileStoreSummaryFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return GameSummary{}, ErrGameNotFound
+	} else if err != nil {
+		return GameSummary{}, fmt.Errorf("unable to read game summary: %w", err)
+	}
+
+	var summary GameSummary
+	if err := json.Unmarshal(summaryJSON, &summary); err != nil {
+		return GameSummary{}, fmt.Errorf("unable to parse game summary for %s: %w", gameID, err)
+	}
+	return summary, nil
+}
+
+func (store *FileGameStore) GetEvents(gameID string) ([]GameEvent, error) {
+	gameDir, err := store.gameDir(gameID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(gameDir, fileStoreGameFile)); errors.Is(err, os.ErrNotExist) {
+		return nil, ErrGameNotFound
+	}
+	f, err := os.Open(filepath.Join(gameDir, fileStoreEventsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrGameNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read events: %w", err)
+	}
+	defer f.Close()
+
+	events := []GameEvent{}
+	scanner := bufio.NewScanner(f)
+	// Frames for large boards can exceed the default line limit
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event GameEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("unable to parse event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read events: %w", err)
+	}
+	return events, nil
+}
+
+func (store *FileGameStore) ListGames() ([]GameSummary, error) {
+	entries, err := os.ReadDir(store.dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list games: %w", err)
+	}
+
+	summaries := make([]GameSummary, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		summaryJSON, err := os.ReadFile(filepath.Join(store.dir, entry.Name(), fileStoreSummaryFile))
+		if errors.Is(err, os.ErrNotExist) {
+			// Not a game directory, or a game that is still being written
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read game summary: %w", err)
+		}
+		var summary GameSummary
+		if err := json.Unmarshal(summaryJSON, &summary); err != nil {
+			return nil, fmt.Errorf("unable to parse game summary for %s: %w", entry.Name(), err)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+func (store *FileGameStore) PutRecord(collection string, key string, value interface{}) error {
+	collectionDir, err := store.collectionDir(collection)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("unable to serialize record: %w", err)
+	}
+	if err := os.MkdirAll(collectionDir, 0755); err != nil {
+		return fmt.Errorf("unable to create record directory: %w", err)
+	}
+	return writeFileAtomic(recordFile(collectionDir, key), data)
+}
+
+func (store *FileGameStore) GetRecord(collection string, key string, value interface{}) error {
+	collectionDir, err := store.collectionDir(collection)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(recordFile(collectionDir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrRecordNotFound
+	} else if err != nil {
+		return fmt.Errorf("unable to read record: %w", err)
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("unable to parse record %s: %w", key, err)
+	}
+	return nil
+}
+
+func (store *FileGameStore) DeleteRecord(collection string, key string) error {
+	collectionDir, err := store.collectionDir(collection)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(recordFile(collectionDir, key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to delete record: %w", err)
+	}
+	return nil
+}
+
+func (store *FileGameStore) ListRecords(collection string) ([]string, error) {
+	collectionDir, err := store.collectionDir(collection)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(collectionDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to list records: %w", err)
+	}
+
+	keys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, fileStoreRecordExt) {
+			continue
+		}
+		key, err := url.PathUnescape(strings.TrimSuffix(name, fileStoreRecordExt))
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (store *FileGameStore) collectionDir(collection string) (string, error) {
+	if collection == "" || collection == "." || collection == ".." || strings.ContainsAny(collection, `/\`) {
+		return "", fmt.Errorf("invalid record collection %q", collection)
+	}
+	return filepath.Join(store.dir, fileStoreRecordsDir, collection), nil
+}
+
+// Record keys can be any string, such as a snake name, so escape them to get a safe file name.
+func recordFile(collectionDir string, key string) string {
+	return filepath.Join(collectionDir, url.PathEscape(key)+fileStoreRecordExt)
+}
+
+// Game IDs come from request URLs, so make sure they can't be used to escape the storage directory.
+func (store *FileGameStore) gameDir(gameID string) (string, error) {
+	if gameID == "" || gameID == "." || gameID == ".." || strings.ContainsAny(gameID, `/\`) {
+		return "", ErrGameNotFound
+	}
+	return filepath.Join(store.dir, gameID), nil
+}
+
+func writeFileAtomic(filename string, data []byte) error {
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("unable to write %s: %w", filepath.Base(filename), err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		return fmt.Errorf("unable to write %s: %w", filepath.Base(filename), err)
+	}
+	return nil
+}
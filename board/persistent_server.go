@@ -1,129 +1,305 @@
 package board
 
 import (
-	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
-	db "github.com/replit/database-go"
+	log "github.com/spf13/jwalterweatherman"
 )
 
 type PersistentBoardServer struct {
-	activeGames map[string]*GameState
-	eventChans  map[string][]chan GameEvent
-	mu          sync.RWMutex
+	activeGames      map[string]*GameState // games that are running, or have ended but couldn't be saved to the store
+	subscribers      map[string][]*Subscription
+	gameEndListeners []GameEndListener
+	store            GameStore
+	mu               sync.RWMutex
 }
 
+// GameEndListener is called once a game has ended and been saved, with the game summary and every event sent for the game.
+// Listeners are called from the goroutine running the game, so slow work should be done in the background.
+type GameEndListener func(summary GameSummary, events []GameEvent)
+
 type GameState struct {
-	game   Game
-	events []GameEvent
-	isLive bool
+	game    Game
+	events  []GameEvent
+	isLive  bool
+	created time.Time
+	ended   time.Time
 }
 
-func NewPersistentBoardServer() *PersistentBoardServer {
+// Create a server that keeps live games in memory and persists finished games to the given store.
+func NewPersistentBoardServer(store GameStore) *PersistentBoardServer {
 	return &PersistentBoardServer{
 		activeGames: make(map[string]*GameState),
-		eventChans:  make(map[string][]chan GameEvent),
+		subscribers: make(map[string][]*Subscription),
+		store:       store,
 	}
 }
 
+// Add a game, which is checkpointed straight away so that it can be recovered if the server stops before it ends.
 func (s *PersistentBoardServer) AddGame(game Game) *GameState {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	gameState := &GameState{
-		game:   game,
-		events: make([]GameEvent, 0),
-		isLive: true,
+		game:    game,
+		events:  make([]GameEvent, 0),
+		isLive:  true,
+		created: time.Now(),
 	}
 	s.activeGames[game.ID] = gameState
-	s.eventChans[game.ID] = make([]chan GameEvent, 0)
+	s.subscribers[game.ID] = make([]*Subscription, 0)
+	checkpoint := gameState.checkpoint()
+	s.mu.Unlock()
+
+	if err := s.store.PutRecord(checkpointsCollection, game.ID, checkpoint); err != nil {
+		log.ERROR.Printf("Unable to checkpoint game %s: %v", game.ID, err)
+	}
 	return gameState
 }
 
 func (s *PersistentBoardServer) SendEvent(gameID string, event GameEvent) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 
-	if gameState, exists := s.activeGames[gameID]; exists {
-		gameState.events = append(gameState.events, event)
+	gameState, exists := s.activeGames[gameID]
+	if !exists {
+		s.mu.Unlock()
+		return
+	}
+	gameState.events = append(gameState.events, event)
 
-		// Send to all active websocket connections
-		for _, ch := range s.eventChans[gameID] {
-			ch <- event
-		}
+	// Queue for all active websocket connections, which never blocks
+	for _, sub := range s.subscribers[gameID] {
+		sub.push(event)
+	}
 
-		// If this is a game end event, persist to DB and cleanup
-		if event.EventType == EVENT_TYPE_GAME_END {
-			gameState.isLive = false
-			eventsJSON, _ := json.Marshal(gameState.events)
-			db.Set(fmt.Sprintf("game:%s:events", gameID), string(eventsJSON))
-			gameJSON, _ := json.Marshal(gameState.game)
-			db.Set(fmt.Sprintf("game:%s:metadata", gameID), string(gameJSON))
+	if event.EventType != EVENT_TYPE_GAME_END {
+		s.mu.Unlock()
+		return
+	}
+
+	// If this is a game end event, close the event streams and persist to the store
+	for _, sub := range s.subscribers[gameID] {
+		sub.finish()
+	}
+	delete(s.subscribers, gameID)
+	gameState.isLive = false
+	gameState.ended = time.Now()
+	if game, ok := event.Data.(Game); ok {
+		gameState.game = game
+	}
+	summary := gameState.summary()
+	events := append([]GameEvent(nil), gameState.events...)
+	listeners := s.gameEndListeners
+	s.mu.Unlock()
+
+	// The checkpoint is only removed once the game is saved, so that saving can be retried by RecoverGames
+	if err := s.store.SaveGame(summary, events); err != nil {
+		log.ERROR.Printf("Unable to save game %s: %v", gameID, err)
+		checkpoint := gameCheckpoint{Game: summary.Game, Events: events, Created: summary.Created, Ended: summary.Ended}
+		if err := s.store.PutRecord(checkpointsCollection, gameID, checkpoint); err != nil {
+			log.ERROR.Printf("Unable to checkpoint game %s: %v", gameID, err)
 		}
+	} else {
+		// Once saved, the game is served from the store, so that finished games aren't kept in memory
+		s.mu.Lock()
+		delete(s.activeGames, gameID)
+		s.mu.Unlock()
+		if err := s.store.DeleteRecord(checkpointsCollection, gameID); err != nil {
+			log.ERROR.Printf("Unable to remove checkpoint for game %s: %v", gameID, err)
+		}
+	}
+	for _, listener := range listeners {
+		listener(summary, events)
 	}
 }
 
-func (s *PersistentBoardServer) SubscribeToGame(gameID string) (chan GameEvent, error) {
+// Register a listener to be called whenever a game ends.
+func (s *PersistentBoardServer) OnGameEnd(listener GameEndListener) {
 	s.mu.Lock()
-	fmt.Printf("Subscribing to event stream for %v \n", gameID)
 	defer s.mu.Unlock()
 
-	// First check active games
-	if gameState, exists := s.activeGames[gameID]; exists {
-		fmt.Printf("Game %v is active \n", gameID)
+	s.gameEndListeners = append(s.gameEndListeners, listener)
+}
 
-		ch := make(chan GameEvent, 100)
-		s.eventChans[gameID] = append(s.eventChans[gameID], ch)
+// Update the status of an active game, such as when a queued game starts running.
+func (s *PersistentBoardServer) SetGameStatus(gameID string, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gameState, exists := s.activeGames[gameID]
+	if !exists || !gameState.isLive {
+		return fmt.Errorf("%w: %s", ErrGameNotFound, gameID)
+	}
+	gameState.game.Status = status
+	return nil
+}
 
-		// Send existing events
-		go func() {
-			fmt.Printf("Starting goroutine for %v \n", gameID)
-			for _, event := range gameState.events {
-				fmt.Printf("Sending an event for %v \n", gameID)
-				ch <- event
-			}
-		}()
+// Subscribe to the events for a game. The events sent so far are replayed first, starting from the
+// frame for fromTurn, followed by live events until the game ends. Pass 0 to replay the whole game.
+// The subscription must be closed when the client goes away.
+func (s *PersistentBoardServer) SubscribeToGame(gameID string, fromTurn int) (*Subscription, error) {
+	log.DEBUG.Printf("Subscribing to event stream for %v", gameID)
 
-		return ch, nil
+	// First check active games
+	s.mu.Lock()
+	if gameState, exists := s.activeGames[gameID]; exists {
+		sub := newSubscription(s, gameID, eventsFromTurn(gameState.events, fromTurn))
+		if gameState.isLive {
+			s.subscribers[gameID] = append(s.subscribers[gameID], sub)
+		} else {
+			sub.finish()
+		}
+		s.mu.Unlock()
+		return sub, nil
 	}
+	s.mu.Unlock()
 
-	// Check DB for completed games
-	eventsJSON, err := db.Get(fmt.Sprintf("game:%s:events", gameID))
+	// Check the store for completed games, without holding the lock so that running games aren't held up
+	events, err := s.store.GetEvents(gameID)
 	if err != nil {
-		return nil, fmt.Errorf("game not found: %s", gameID)
+		return nil, fmt.Errorf("%w: %s", err, gameID)
 	}
+	sub := newSubscription(nil, gameID, eventsFromTurn(events, fromTurn))
+	sub.finish()
+	return sub, nil
+}
 
-	ch := make(chan GameEvent, 100)
-	var events []GameEvent
-	json.Unmarshal([]byte(eventsJSON), &events)
+// Skip the frames before a turn, keeping all other events.
+func eventsFromTurn(events []GameEvent, fromTurn int) []GameEvent {
+	if fromTurn <= 0 {
+		return events
+	}
+	filtered := make([]GameEvent, 0, len(events))
+	for _, event := range events {
+		if frame, ok := event.Data.(GameFrame); ok && frame.Turn < fromTurn {
+			continue
+		}
+		filtered = append(filtered, event)
+	}
+	return filtered
+}
 
-	// Send stored events
-	go func() {
-		for _, event := range events {
-			ch <- event
+// Remove a subscriber, so that it no longer receives events.
+func (s *PersistentBoardServer) unsubscribe(sub *Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscribers := s.subscribers[sub.gameID]
+	for i, existing := range subscribers {
+		if existing == sub {
+			s.subscribers[sub.gameID] = append(subscribers[:i:i], subscribers[i+1:]...)
+			return
 		}
-		close(ch)
-	}()
+	}
+}
 
-	return ch, nil
+// The number of subscriptions currently open across all games.
+func (s *PersistentBoardServer) SubscriberCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, subscribers := range s.subscribers {
+		count += len(subscribers)
+	}
+	return count
 }
 
 func (s *PersistentBoardServer) GetGame(gameID string) (*Game, error) {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
+	if gameState, exists := s.activeGames[gameID]; exists {
+		game := gameState.game
+		s.mu.RUnlock()
+		return &game, nil
+	}
+	s.mu.RUnlock()
 
+	// Check the store for completed games, without holding the lock so that running games aren't held up
+	game, err := s.store.GetGame(gameID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, gameID)
+	}
+	return &game, nil
+}
+
+// Get the summary of an active or stored game.
+func (s *PersistentBoardServer) GetSummary(gameID string) (GameSummary, error) {
+	s.mu.RLock()
 	if gameState, exists := s.activeGames[gameID]; exists {
-		return &gameState.game, nil
+		summary := gameState.summary()
+		s.mu.RUnlock()
+		return summary, nil
 	}
+	s.mu.RUnlock()
 
-	// Check DB for completed games
-	gameJSON, err := db.Get(fmt.Sprintf("game:%s:metadata", gameID))
+	summary, err := s.store.GetSummary(gameID)
 	if err != nil {
-		return nil, fmt.Errorf("game not found: %s", gameID)
+		return GameSummary{}, fmt.Errorf("%w: %s", err, gameID)
 	}
+	return summary, nil
+}
 
-	var game Game
-	json.Unmarshal([]byte(gameJSON), &game)
-	return &game, nil
+// Get the events sent so far for an active game, or all events for a stored game.
+func (s *PersistentBoardServer) GetEvents(gameID string) ([]GameEvent, error) {
+	s.mu.RLock()
+	if gameState, exists := s.activeGames[gameID]; exists {
+		events := append([]GameEvent(nil), gameState.events...)
+		s.mu.RUnlock()
+		return events, nil
+	}
+	s.mu.RUnlock()
+
+	events, err := s.store.GetEvents(gameID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, gameID)
+	}
+	return events, nil
+}
+
+// List active and stored games matching the filter, newest first.
+// Returns the requested page of games along with the total number of matching games.
+func (s *PersistentBoardServer) ListGames(filter GameFilter, limit int, offset int) ([]GameSummary, int, error) {
+	// Active games are listed before stored games, so that a game saved in between is still listed once
+	s.mu.RLock()
+	active := make(map[string]bool, len(s.activeGames))
+	summaries := make([]GameSummary, 0, len(s.activeGames))
+	for gameID, gameState := range s.activeGames {
+		active[gameID] = true
+		summaries = append(summaries, gameState.summary())
+	}
+	s.mu.RUnlock()
+
+	stored, err := s.store.ListGames()
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, summary := range stored {
+		if !active[summary.Game.ID] {
+			summaries = append(summaries, summary)
+		}
+	}
+
+	matching := summaries[:0]
+	for _, summary := range summaries {
+		if filter.Matches(summary) {
+			matching = append(matching, summary)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].Created.After(matching[j].Created)
+	})
+
+	total := len(matching)
+	if offset > total {
+		offset = total
+	}
+	if limit <= 0 || offset+limit > total {
+		limit = total - offset
+	}
+	return matching[offset : offset+limit], total, nil
+}
+
+func (gameState *GameState) summary() GameSummary {
+	return NewGameSummary(gameState.game, gameState.events, gameState.created, gameState.ended)
 }
@@ -0,0 +1,414 @@
+package board_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersistentBoardServerListGames(t *testing.T) {
+	store := board.NewMemoryGameStore()
+	require.NoError(t, store.SaveGame(board.GameSummary{
+		Game:    board.Game{ID: "stored", Status: "complete", Map: "standard"},
+		Created: time.Now().Add(-time.Hour),
+	}, nil))
+
+	server := board.NewPersistentBoardServer(store)
+	server.AddGame(board.Game{ID: "finished", Status: "running", Map: "standard"})
+	server.SendEvent("finished", frameEvent(0, board.Snake{ID: "1", Name: "One"}, board.Snake{ID: "2", Name: "Two", Death: &board.Death{Cause: "wall-collision"}}))
+	server.SendEvent("finished", board.GameEvent{
+		EventType: board.EVENT_TYPE_GAME_END,
+		Data:      board.Game{ID: "finished", Status: "complete", Map: "standard"},
+	})
+	time.Sleep(time.Millisecond)
+	server.AddGame(board.Game{ID: "running", Status: "running", Map: "royale"})
+
+	games, total, err := server.ListGames(board.GameFilter{}, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 3, total)
+	require.Equal(t, "running", games[0].Game.ID)
+	require.Equal(t, "finished", games[1].Game.ID)
+	require.Equal(t, "stored", games[2].Game.ID)
+	require.Equal(t, "One", games[1].WinnerName)
+	require.Equal(t, []string{"One", "Two"}, games[1].Snakes)
+
+	games, total, err = server.ListGames(board.GameFilter{Map: "standard"}, 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, 2, total)
+	require.Len(t, games, 1)
+	require.Equal(t, "stored", games[0].Game.ID)
+
+	games, total, err = server.ListGames(board.GameFilter{Status: "complete"}, 10, 5)
+	require.NoError(t, err)
+	require.Equal(t, 2, total)
+	require.Empty(t, games)
+}
+
+func collectEvents(t *testing.T, sub *board.Subscription) []board.GameEvent {
+	t.Helper()
+	var events []board.GameEvent
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		case <-timeout:
+			require.FailNow(t, "timed out waiting for events")
+		}
+	}
+}
+
+func TestPersistentBoardServerSubscribe(t *testing.T) {
+	server := board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	server.AddGame(board.Game{ID: "GAME_ID"})
+	server.SendEvent("GAME_ID", frameEvent(0))
+	server.SendEvent("GAME_ID", frameEvent(1))
+
+	// Late joiners get the backlog followed by live events
+	sub, err := server.SubscribeToGame("GAME_ID", 0)
+	require.NoError(t, err)
+	server.SendEvent("GAME_ID", frameEvent(2))
+	gameEnd := board.GameEvent{EventType: board.EVENT_TYPE_GAME_END, Data: board.Game{ID: "GAME_ID", Status: "complete"}}
+	server.SendEvent("GAME_ID", gameEnd)
+
+	events := collectEvents(t, sub)
+	require.Equal(t, []board.GameEvent{frameEvent(0), frameEvent(1), frameEvent(2), gameEnd}, events)
+	require.False(t, sub.Dropped())
+
+	// Finished games are replayed in full
+	sub, err = server.SubscribeToGame("GAME_ID", 0)
+	require.NoError(t, err)
+	require.Len(t, collectEvents(t, sub), 4)
+
+	_, err = server.SubscribeToGame("MISSING", 0)
+	require.ErrorIs(t, err, board.ErrGameNotFound)
+}
+
+func TestPersistentBoardServerSlowSubscriber(t *testing.T) {
+	server := board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	server.AddGame(board.Game{ID: "GAME_ID"})
+
+	slow, err := server.SubscribeToGame("GAME_ID", 0)
+	require.NoError(t, err)
+	fast, err := server.SubscribeToGame("GAME_ID", 0)
+	require.NoError(t, err)
+
+	// The slow subscriber never reads, which must not block sending events to the other subscriber
+	for turn := 0; turn < 500; turn++ {
+		server.SendEvent("GAME_ID", frameEvent(turn))
+		select {
+		case event := <-fast.Events():
+			require.Equal(t, frameEvent(turn), event)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for event")
+		}
+	}
+	server.SendEvent("GAME_ID", board.GameEvent{EventType: board.EVENT_TYPE_GAME_END, Data: board.Game{ID: "GAME_ID"}})
+
+	require.Len(t, collectEvents(t, fast), 1)
+	require.False(t, fast.Dropped())
+
+	events := collectEvents(t, slow)
+	require.True(t, slow.Dropped())
+	require.Less(t, len(events), 501)
+}
+
+func TestPersistentBoardServerUnsubscribe(t *testing.T) {
+	server := board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	server.AddGame(board.Game{ID: "GAME_ID"})
+
+	sub, err := server.SubscribeToGame("GAME_ID", 0)
+	require.NoError(t, err)
+	server.SendEvent("GAME_ID", frameEvent(0))
+	sub.Close()
+	sub.Close()
+
+	// Closing stops delivery, and later events are not queued for the closed subscriber
+	require.Eventually(t, func() bool {
+		_, ok := <-sub.Events()
+		return !ok
+	}, time.Second, time.Millisecond)
+	for turn := 1; turn < 500; turn++ {
+		server.SendEvent("GAME_ID", frameEvent(turn))
+	}
+	require.False(t, sub.Dropped())
+}
+
+func TestPersistentBoardServerSubscribeFromTurn(t *testing.T) {
+	server := board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	server.AddGame(board.Game{ID: "GAME_ID"})
+	for turn := 0; turn < 5; turn++ {
+		server.SendEvent("GAME_ID", frameEvent(turn))
+	}
+
+	// Live games replay from the requested turn, then follow the live stream
+	sub, err := server.SubscribeToGame("GAME_ID", 3)
+	require.NoError(t, err)
+	server.SendEvent("GAME_ID", frameEvent(5))
+	gameEnd := board.GameEvent{EventType: board.EVENT_TYPE_GAME_END, Data: board.Game{ID: "GAME_ID"}}
+	server.SendEvent("GAME_ID", gameEnd)
+	require.Equal(t, []board.GameEvent{frameEvent(3), frameEvent(4), frameEvent(5), gameEnd}, collectEvents(t, sub))
+
+	// Stored games work in the same way
+	storedServer := board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	storedServer.AddGame(board.Game{ID: "GAME_ID"})
+	for turn := 0; turn < 5; turn++ {
+		storedServer.SendEvent("GAME_ID", frameEvent(turn))
+	}
+	storedServer.SendEvent("GAME_ID", gameEnd)
+	store := board.NewMemoryGameStore()
+	events := collectEvents(t, mustSubscribe(t, storedServer, "GAME_ID", 0))
+	require.NoError(t, store.SaveGame(board.GameSummary{Game: board.Game{ID: "GAME_ID"}}, events))
+
+	sub, err = board.NewPersistentBoardServer(store).SubscribeToGame("GAME_ID", 4)
+	require.NoError(t, err)
+	require.Equal(t, []board.GameEvent{frameEvent(4), gameEnd}, collectEvents(t, sub))
+
+	// Turns past the end of the game only get the game end event
+	sub, err = board.NewPersistentBoardServer(store).SubscribeToGame("GAME_ID", 100)
+	require.NoError(t, err)
+	require.Equal(t, []board.GameEvent{gameEnd}, collectEvents(t, sub))
+}
+
+func mustSubscribe(t *testing.T, server *board.PersistentBoardServer, gameID string, fromTurn int) *board.Subscription {
+	sub, err := server.SubscribeToGame(gameID, fromTurn)
+	require.NoError(t, err)
+	return sub
+}
+
+func TestPersistentBoardServerSubscriberCount(t *testing.T) {
+	server := board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	server.AddGame(board.Game{ID: "GAME_1"})
+	server.AddGame(board.Game{ID: "GAME_2"})
+	require.Equal(t, 0, server.SubscriberCount())
+
+	sub := mustSubscribe(t, server, "GAME_1", 0)
+	mustSubscribe(t, server, "GAME_2", 0)
+	require.Equal(t, 2, server.SubscriberCount())
+
+	sub.Close()
+	require.Equal(t, 1, server.SubscriberCount())
+
+	// Subscribers are dropped when their game ends
+	server.SendEvent("GAME_2", board.GameEvent{EventType: board.EVENT_TYPE_GAME_END, Data: board.Game{ID: "GAME_2"}})
+	require.Equal(t, 0, server.SubscriberCount())
+}
+
+func TestPersistentBoardServerGetEvents(t *testing.T) {
+	store := board.NewMemoryGameStore()
+	server := board.NewPersistentBoardServer(store)
+	server.AddGame(board.Game{ID: "GAME_ID"})
+	server.SendEvent("GAME_ID", frameEvent(0))
+
+	events, err := server.GetEvents("GAME_ID")
+	require.NoError(t, err)
+	require.Equal(t, []board.GameEvent{frameEvent(0)}, events)
+
+	gameEnd := board.GameEvent{EventType: board.EVENT_TYPE_GAME_END, Data: board.Game{ID: "GAME_ID"}}
+	server.SendEvent("GAME_ID", gameEnd)
+
+	// Finished games are read back from the store
+	events, err = board.NewPersistentBoardServer(store).GetEvents("GAME_ID")
+	require.NoError(t, err)
+	require.Equal(t, []board.GameEvent{frameEvent(0), gameEnd}, events)
+
+	_, err = server.GetEvents("MISSING")
+	require.ErrorIs(t, err, board.ErrGameNotFound)
+}
+
+func TestPersistentBoardServerGetSummary(t *testing.T) {
+	store := board.NewMemoryGameStore()
+	server := board.NewPersistentBoardServer(store)
+	server.AddGame(board.Game{ID: "GAME_ID", Status: board.GameStatusRunning})
+	server.SendEvent("GAME_ID", frameEvent(3, board.Snake{ID: "1", Name: "One"}))
+
+	summary, err := server.GetSummary("GAME_ID")
+	require.NoError(t, err)
+	require.Equal(t, board.GameStatusRunning, summary.Game.Status)
+	require.Equal(t, 3, summary.Turn)
+	require.True(t, summary.Ended.IsZero())
+
+	server.SendEvent("GAME_ID", board.GameEvent{EventType: board.EVENT_TYPE_GAME_END, Data: board.Game{ID: "GAME_ID", Status: board.GameStatusComplete}})
+
+	// Finished games are read back from the store
+	summary, err = board.NewPersistentBoardServer(store).GetSummary("GAME_ID")
+	require.NoError(t, err)
+	require.Equal(t, board.GameStatusComplete, summary.Game.Status)
+	require.Equal(t, "1", summary.WinnerID)
+	require.False(t, summary.Ended.IsZero())
+
+	_, err = server.GetSummary("MISSING")
+	require.ErrorIs(t, err, board.ErrGameNotFound)
+}
+
+func TestPersistentBoardServerOnGameEnd(t *testing.T) {
+	server := board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	var summaries []board.GameSummary
+	var eventCounts []int
+	server.OnGameEnd(func(summary board.GameSummary, events []board.GameEvent) {
+		summaries = append(summaries, summary)
+		eventCounts = append(eventCounts, len(events))
+	})
+
+	server.AddGame(board.Game{ID: "GAME_ID"})
+	server.SendEvent("GAME_ID", frameEvent(0, board.Snake{ID: "1", Name: "One"}))
+	require.Empty(t, summaries)
+
+	server.SendEvent("GAME_ID", board.GameEvent{EventType: board.EVENT_TYPE_GAME_END, Data: board.Game{ID: "GAME_ID", Status: board.GameStatusComplete}})
+	require.Len(t, summaries, 1)
+	require.Equal(t, "GAME_ID", summaries[0].Game.ID)
+	require.Equal(t, board.GameStatusComplete, summaries[0].Game.Status)
+	require.Equal(t, []string{"One"}, summaries[0].Snakes)
+	require.Equal(t, []int{2}, eventCounts)
+}
+
+// A store that can't save games, to check that unsaved games are kept as checkpoints.
+type failingGameStore struct {
+	*board.MemoryGameStore
+}
+
+func (store failingGameStore) SaveGame(summary board.GameSummary, events []board.GameEvent) error {
+	return errors.New("store unavailable")
+}
+
+// A store that records which games have been read from it.
+type readTrackingGameStore struct {
+	*board.MemoryGameStore
+	reads *[]string
+}
+
+func (store readTrackingGameStore) GetEvents(gameID string) ([]board.GameEvent, error) {
+	*store.reads = append(*store.reads, gameID)
+	return store.MemoryGameStore.GetEvents(gameID)
+}
+
+// A store whose reads wait until they are released, to check that reads don't hold up running games.
+type blockingGameStore struct {
+	*board.MemoryGameStore
+	reading chan struct{}
+	release chan struct{}
+}
+
+func (store blockingGameStore) GetGame(gameID string) (board.Game, error) {
+	store.reading <- struct{}{}
+	<-store.release
+	return store.MemoryGameStore.GetGame(gameID)
+}
+
+func TestPersistentBoardServerStoreReadsDontBlock(t *testing.T) {
+	store := blockingGameStore{board.NewMemoryGameStore(), make(chan struct{}), make(chan struct{})}
+	server := board.NewPersistentBoardServer(store)
+	server.AddGame(board.Game{ID: "RUNNING"})
+
+	done := make(chan error)
+	go func() {
+		_, err := server.GetGame("STORED")
+		done <- err
+	}()
+	<-store.reading
+
+	// The running game can still be played while the store is being read
+	server.SendEvent("RUNNING", frameEvent(0))
+	events, err := server.GetEvents("RUNNING")
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	close(store.release)
+	require.Error(t, <-done)
+}
+
+func TestPersistentBoardServerReleasesSavedGames(t *testing.T) {
+	var reads []string
+	server := board.NewPersistentBoardServer(readTrackingGameStore{board.NewMemoryGameStore(), &reads})
+	server.AddGame(board.Game{ID: "GAME_ID"})
+	server.SendEvent("GAME_ID", frameEvent(0))
+	_, err := server.GetEvents("GAME_ID")
+	require.NoError(t, err)
+	require.Empty(t, reads)
+
+	// Once saved, the game is no longer kept in memory
+	gameEnd := board.GameEvent{EventType: board.EVENT_TYPE_GAME_END, Data: board.Game{ID: "GAME_ID", Status: board.GameStatusComplete}}
+	server.SendEvent("GAME_ID", gameEnd)
+	events, err := server.GetEvents("GAME_ID")
+	require.NoError(t, err)
+	require.Equal(t, []board.GameEvent{frameEvent(0), gameEnd}, events)
+	require.Equal(t, []string{"GAME_ID"}, reads)
+
+	games, total, err := server.ListGames(board.GameFilter{}, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, total)
+	require.Equal(t, board.GameStatusComplete, games[0].Game.Status)
+
+	// Games that can't be saved are still served from memory
+	failingServer := board.NewPersistentBoardServer(failingGameStore{board.NewMemoryGameStore()})
+	failingServer.AddGame(board.Game{ID: "UNSAVED"})
+	failingServer.SendEvent("UNSAVED", frameEvent(0))
+	failingServer.SendEvent("UNSAVED", board.GameEvent{EventType: board.EVENT_TYPE_GAME_END, Data: board.Game{ID: "UNSAVED"}})
+	events, err = failingServer.GetEvents("UNSAVED")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+}
+
+func TestPersistentBoardServerRecoverGames(t *testing.T) {
+	store := board.NewMemoryGameStore()
+	server := board.NewPersistentBoardServer(store)
+
+	// A game interrupted before it was checkpointed again keeps the events from its last checkpoint
+	server.AddGame(board.Game{ID: "INTERRUPTED", Status: board.GameStatusRunning})
+	server.SendEvent("INTERRUPTED", frameEvent(0, board.Snake{ID: "1", Name: "One"}))
+	server.AddGame(board.Game{ID: "FINISHED"})
+	server.SendEvent("FINISHED", frameEvent(0))
+	require.NoError(t, server.Checkpoint())
+	server.SendEvent("INTERRUPTED", frameEvent(1, board.Snake{ID: "1", Name: "One"}))
+
+	// Games that end normally don't need to be recovered
+	gameEnd := board.GameEvent{EventType: board.EVENT_TYPE_GAME_END, Data: board.Game{ID: "FINISHED", Status: board.GameStatusComplete}}
+	server.SendEvent("FINISHED", gameEnd)
+
+	// Games that end but can't be saved are saved when they are recovered
+	failingServer := board.NewPersistentBoardServer(failingGameStore{store})
+	unsavedEnd := board.GameEvent{EventType: board.EVENT_TYPE_GAME_END, Data: board.Game{ID: "UNSAVED", Status: board.GameStatusComplete}}
+	failingServer.AddGame(board.Game{ID: "UNSAVED"})
+	failingServer.SendEvent("UNSAVED", frameEvent(0))
+	failingServer.SendEvent("UNSAVED", unsavedEnd)
+
+	restarted := board.NewPersistentBoardServer(store)
+	var summaries []board.GameSummary
+	restarted.OnGameEnd(func(summary board.GameSummary, events []board.GameEvent) {
+		summaries = append(summaries, summary)
+	})
+	recovered, err := restarted.RecoverGames()
+	require.NoError(t, err)
+	require.Equal(t, 2, recovered)
+	require.Len(t, summaries, 2)
+
+	game, err := restarted.GetGame("INTERRUPTED")
+	require.NoError(t, err)
+	require.Equal(t, board.GameStatusAborted, game.Status)
+	events, err := restarted.GetEvents("INTERRUPTED")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, frameEvent(0, board.Snake{ID: "1", Name: "One"}), events[0])
+	require.Equal(t, board.EVENT_TYPE_GAME_END, events[1].EventType)
+
+	game, err = restarted.GetGame("FINISHED")
+	require.NoError(t, err)
+	require.Equal(t, board.GameStatusComplete, game.Status)
+
+	game, err = restarted.GetGame("UNSAVED")
+	require.NoError(t, err)
+	require.Equal(t, board.GameStatusComplete, game.Status)
+	events, err = restarted.GetEvents("UNSAVED")
+	require.NoError(t, err)
+	require.Equal(t, []board.GameEvent{frameEvent(0), unsavedEnd}, events)
+
+	recovered, err = restarted.RecoverGames()
+	require.NoError(t, err)
+	require.Zero(t, recovered)
+}
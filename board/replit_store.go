@@ -0,0 +1,142 @@
+package board
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	db "github.com/replit/database-go"
+)
+
+// ReplitGameStore keeps games in the Replit database of the current repl.
+type ReplitGameStore struct{}
+
+func NewReplitGameStore() *ReplitGameStore {
+	return &ReplitGameStore{}
+}
+
+func (store *ReplitGameStore) SaveGame(summary GameSummary, events []GameEvent) error {
+	game := summary.Game
+	eventsJSON, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("unable to serialize events: %w", err)
+	}
+	if err := db.Set(fmt.Sprintf("game:%s:events", game.ID), string(eventsJSON)); err != nil {
+		return fmt.Errorf("unable to save events: %w", err)
+	}
+	gameJSON, err := json.Marshal(game)
+	if err != nil {
+		return fmt.Errorf("unable to serialize game: %w", err)
+	}
+	if err := db.Set(fmt.Sprintf("game:%s:metadata", game.ID), string(gameJSON)); err != nil {
+		return fmt.Errorf("unable to save game: %w", err)
+	}
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("unable to serialize game summary: %w", err)
+	}
+	if err := db.Set(fmt.Sprintf("game:%s:summary", game.ID), string(summaryJSON)); err != nil {
+		return fmt.Errorf("unable to save game summary: %w", err)
+	}
+	return nil
+}
+
+func (store *ReplitGameStore) GetGame(gameID string) (Game, error) {
+	var game Game
+	if err := store.get(fmt.Sprintf("game:%s:metadata", gameID), &game); err != nil {
+		return Game{}, err
+	}
+	return game, nil
+}
+
+func (store *ReplitGameStore) GetSummary(gameID string) (GameSummary, error) {
+	var summary GameSummary
+	if err := store.get(fmt.Sprintf("game:%s:summary", gameID), &summary); err != nil {
+		return GameSummary{}, err
+	}
+	return summary, nil
+}
+
+func (store *ReplitGameStore) GetEvents(gameID string) ([]GameEvent, error) {
+	var events []GameEvent
+	if err := store.get(fmt.Sprintf("game:%s:events", gameID), &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (store *ReplitGameStore) ListGames() ([]GameSummary, error) {
+	keys, err := db.ListKeys("game:")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list games: %w", err)
+	}
+
+	summaries := []GameSummary{}
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ":summary") {
+			continue
+		}
+		var summary GameSummary
+		if err := store.get(key, &summary); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+func (store *ReplitGameStore) PutRecord(collection string, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("unable to serialize record: %w", err)
+	}
+	if err := db.Set(recordKey(collection, key), string(data)); err != nil {
+		return fmt.Errorf("unable to save record: %w", err)
+	}
+	return nil
+}
+
+func (store *ReplitGameStore) GetRecord(collection string, key string, value interface{}) error {
+	err := store.get(recordKey(collection, key), value)
+	if errors.Is(err, ErrGameNotFound) {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+func (store *ReplitGameStore) DeleteRecord(collection string, key string) error {
+	if err := db.Delete(recordKey(collection, key)); err != nil && !errors.Is(err, db.ErrNotFound) {
+		return fmt.Errorf("unable to delete record: %w", err)
+	}
+	return nil
+}
+
+func (store *ReplitGameStore) ListRecords(collection string) ([]string, error) {
+	prefix := recordKey(collection, "")
+	keys, err := db.ListKeys(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list records: %w", err)
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, prefix)
+	}
+	return keys, nil
+}
+
+func recordKey(collection string, key string) string {
+	return fmt.Sprintf("record:%s:%s", collection, key)
+}
+
+func (store *ReplitGameStore) get(key string, v interface{}) error {
+	value, err := db.Get(key)
+	if errors.Is(err, db.ErrNotFound) {
+		return ErrGameNotFound
+	} else if err != nil {
+		return fmt.Errorf("unable to read %s: %w", key, err)
+	}
+	if err := json.Unmarshal([]byte(value), v); err != nil {
+		return fmt.Errorf("unable to parse %s: %w", key, err)
+	}
+	return nil
+}
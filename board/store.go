@@ -0,0 +1,178 @@
+package board
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrGameNotFound   = errors.New("game not found")
+	ErrRecordNotFound = errors.New("record not found")
+)
+
+// RecordStore persists other server data, such as ratings, as JSON records grouped into named collections.
+type RecordStore interface {
+	// Save a record, replacing any existing record with the same key.
+	PutRecord(collection string, key string, value interface{}) error
+	// Read a record into value, or return ErrRecordNotFound if it doesn't exist.
+	GetRecord(collection string, key string, value interface{}) error
+	// Delete a record. Deleting a record that doesn't exist is not an error.
+	DeleteRecord(collection string, key string) error
+	// List the keys of all records in a collection, in no particular order.
+	ListRecords(collection string) ([]string, error)
+}
+
+// GameStore persists finished games so that they can be served after they are no longer active,
+// along with any other records the server keeps.
+type GameStore interface {
+	RecordStore
+
+	// Save the game summary, which includes the game metadata, along with every event that was sent for the game.
+	SaveGame(summary GameSummary, events []GameEvent) error
+	// Get the metadata for a stored game, or ErrGameNotFound if it doesn't exist.
+	GetGame(gameID string) (Game, error)
+	// Get the summary for a stored game, or ErrGameNotFound if it doesn't exist.
+	GetSummary(gameID string) (GameSummary, error)
+	// Get the events for a stored game, or ErrGameNotFound if it doesn't exist.
+	GetEvents(gameID string) ([]GameEvent, error)
+	// List the summaries of all stored games, in no particular order.
+	ListGames() ([]GameSummary, error)
+}
+
+const (
+	StoreBackendMemory = "memory"
+	StoreBackendFile   = "file"
+	StoreBackendReplit = "replit"
+)
+
+// NewGameStore creates the GameStore for a named backend.
+// The location is only used by backends that need one, such as the directory for the file backend.
+func NewGameStore(backend string, location string) (GameStore, error) {
+	switch backend {
+	case StoreBackendMemory:
+		return NewMemoryGameStore(), nil
+	case StoreBackendFile:
+		return NewFileGameStore(location)
+	case StoreBackendReplit:
+		return NewReplitGameStore(), nil
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", backend)
+}
+
+// MemoryGameStore keeps games in memory, and loses them when the process exits.
+type MemoryGameStore struct {
+	games   map[string]GameSummary
+	events  map[string][]GameEvent
+	records map[string]map[string][]byte
+	mu      sync.RWMutex
+}
+
+func NewMemoryGameStore() *MemoryGameStore {
+	return &MemoryGameStore{
+		games:   make(map[string]GameSummary),
+		events:  make(map[string][]GameEvent),
+		records: make(map[string]map[string][]byte),
+	}
+}
+
+func (store *MemoryGameStore) SaveGame(summary GameSummary, events []GameEvent) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.games[summary.Game.ID] = summary
+	store.events[summary.Game.ID] = append([]GameEvent(nil), events...)
+	return nil
+}
+
+func (store *MemoryGameStore) GetGame(gameID string) (Game, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	summary, ok := store.games[gameID]
+	if !ok {
+		return Game{}, ErrGameNotFound
+	}
+	return summary.Game, nil
+}
+
+func (store *MemoryGameStore) GetSummary(gameID string) (GameSummary, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	summary, ok := store.games[gameID]
+	if !ok {
+		return GameSummary{}, ErrGameNotFound
+	}
+	return summary, nil
+}
+
+func (store *MemoryGameStore) GetEvents(gameID string) ([]GameEvent, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	events, ok := store.events[gameID]
+	if !ok {
+		return nil, ErrGameNotFound
+	}
+	return append([]GameEvent(nil), events...), nil
+}
+
+func (store *MemoryGameStore) ListGames() ([]GameSummary, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	summaries := make([]GameSummary, 0, len(store.games))
+	for _, summary := range store.games {
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// Records are kept as JSON, so that callers never share values with the store.
+func (store *MemoryGameStore) PutRecord(collection string, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("unable to serialize record: %w", err)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.records[collection] == nil {
+		store.records[collection] = make(map[string][]byte)
+	}
+	store.records[collection][key] = data
+	return nil
+}
+
+func (store *MemoryGameStore) GetRecord(collection string, key string, value interface{}) error {
+	store.mu.RLock()
+	data, ok := store.records[collection][key]
+	store.mu.RUnlock()
+
+	if !ok {
+		return ErrRecordNotFound
+	}
+	return json.Unmarshal(data, value)
+}
+
+func (store *MemoryGameStore) DeleteRecord(collection string, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.records[collection], key)
+	return nil
+}
+
+func (store *MemoryGameStore) ListRecords(collection string) ([]string, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	keys := make([]string, 0, len(store.records[collection]))
+	for key := range store.records[collection] {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,141 @@
+package board_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGameStores(t *testing.T) {
+	fileStore, err := board.NewFileGameStore(t.TempDir())
+	require.NoError(t, err)
+
+	stores := map[string]board.GameStore{
+		"memory": board.NewMemoryGameStore(),
+		"file":   fileStore,
+	}
+
+	game := board.Game{ID: "GAME_ID", Status: "complete", Width: 11, Height: 11, Map: "standard"}
+	events := []board.GameEvent{
+		{
+			EventType: board.EVENT_TYPE_FRAME,
+			Data: board.GameFrame{
+				Turn: 0,
+				Snakes: []board.Snake{
+					{ID: "one", Name: "One", Body: []rules.Point{{X: 1, Y: 1}}, Health: 100},
+				},
+				Food:    []rules.Point{{X: 5, Y: 5}},
+				Hazards: []rules.Point{},
+			},
+		},
+		{
+			EventType: board.EVENT_TYPE_FRAME,
+			Data: board.GameFrame{
+				Turn: 1,
+				Snakes: []board.Snake{
+					{ID: "one", Name: "One", Body: []rules.Point{{X: 1, Y: 2}}, Health: 99, Death: &board.Death{Cause: rules.EliminatedByOutOfBounds, Turn: 1}},
+				},
+				Food:    []rules.Point{{X: 5, Y: 5}},
+				Hazards: []rules.Point{},
+			},
+		},
+		{EventType: board.EVENT_TYPE_GAME_END, Data: game},
+	}
+
+	summary := board.NewGameSummary(game, events, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), time.Date(2024, 1, 2, 3, 5, 0, 0, time.UTC))
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			_, err := store.GetGame(game.ID)
+			require.ErrorIs(t, err, board.ErrGameNotFound)
+			_, err = store.GetEvents(game.ID)
+			require.ErrorIs(t, err, board.ErrGameNotFound)
+			_, err = store.GetSummary(game.ID)
+			require.ErrorIs(t, err, board.ErrGameNotFound)
+
+			summaries, err := store.ListGames()
+			require.NoError(t, err)
+			require.Empty(t, summaries)
+
+			require.NoError(t, store.SaveGame(summary, events))
+
+			storedGame, err := store.GetGame(game.ID)
+			require.NoError(t, err)
+			require.Equal(t, game, storedGame)
+
+			storedEvents, err := store.GetEvents(game.ID)
+			require.NoError(t, err)
+			require.Equal(t, events, storedEvents)
+
+			storedSummary, err := store.GetSummary(game.ID)
+			require.NoError(t, err)
+			require.Equal(t, summary, storedSummary)
+
+			summaries, err = store.ListGames()
+			require.NoError(t, err)
+			require.Equal(t, []board.GameSummary{summary}, summaries)
+		})
+	}
+}
+
+func TestFileGameStoreInvalidID(t *testing.T) {
+	store, err := board.NewFileGameStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, gameID := range []string{"", "..", "../game", `a\b`} {
+		_, err := store.GetGame(gameID)
+		require.ErrorIs(t, err, board.ErrGameNotFound)
+		_, err = store.GetSummary(gameID)
+		require.ErrorIs(t, err, board.ErrGameNotFound)
+		require.Error(t, store.SaveGame(board.GameSummary{Game: board.Game{ID: gameID}}, nil))
+	}
+}
+
+func TestRecordStores(t *testing.T) {
+	fileStore, err := board.NewFileGameStore(t.TempDir())
+	require.NoError(t, err)
+
+	stores := map[string]board.RecordStore{
+		"memory": board.NewMemoryGameStore(),
+		"file":   fileStore,
+	}
+
+	type record struct {
+		Name  string
+		Value int
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			var value record
+			require.ErrorIs(t, store.GetRecord("things", "a/b c", &value), board.ErrRecordNotFound)
+			keys, err := store.ListRecords("things")
+			require.NoError(t, err)
+			require.Empty(t, keys)
+
+			require.NoError(t, store.PutRecord("things", "a/b c", record{Name: "first", Value: 1}))
+			require.NoError(t, store.PutRecord("things", "..", record{Name: "second", Value: 2}))
+			require.NoError(t, store.PutRecord("others", "a/b c", record{Name: "other", Value: 3}))
+
+			require.NoError(t, store.GetRecord("things", "a/b c", &value))
+			require.Equal(t, record{Name: "first", Value: 1}, value)
+			keys, err = store.ListRecords("things")
+			require.NoError(t, err)
+			require.ElementsMatch(t, []string{"a/b c", ".."}, keys)
+
+			require.NoError(t, store.DeleteRecord("things", "a/b c"))
+			require.NoError(t, store.DeleteRecord("things", "missing"))
+			require.ErrorIs(t, store.GetRecord("things", "a/b c", &value), board.ErrRecordNotFound)
+			require.NoError(t, store.GetRecord("others", "a/b c", &value))
+			require.Equal(t, record{Name: "other", Value: 3}, value)
+		})
+	}
+
+	// Records don't show up as games
+	games, err := fileStore.ListGames()
+	require.NoError(t, err)
+	require.Empty(t, games)
+}
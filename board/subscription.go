@@ -0,0 +1,128 @@
+package board
+
+import "sync"
+
+// The number of live events a subscriber can fall behind by before it is dropped.
+const subscriberBufferSize = 100
+
+// Subscription delivers the events for a single game to one client, such as a websocket connection.
+// Events are queued per subscriber, so that a slow client never blocks the game or other clients.
+// A client that falls more than subscriberBufferSize live events behind is dropped: its event
+// channel is closed and Dropped reports true, and it should reconnect to replay the game.
+type Subscription struct {
+	gameID string
+	events chan GameEvent
+	notify chan struct{} // signals the delivery goroutine that there are new pending events
+	done   chan struct{} // closed when the subscriber goes away
+	server *PersistentBoardServer
+
+	mu       sync.Mutex
+	pending  []GameEvent
+	limit    int
+	finished bool // no more events will be queued
+	dropped  bool
+	close    sync.Once
+}
+
+// Create a subscription, which starts with a backlog of events that have already been sent for the game.
+func newSubscription(server *PersistentBoardServer, gameID string, backlog []GameEvent) *Subscription {
+	sub := &Subscription{
+		gameID:  gameID,
+		events:  make(chan GameEvent),
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		server:  server,
+		pending: append([]GameEvent(nil), backlog...),
+		limit:   len(backlog) + subscriberBufferSize,
+	}
+	go sub.deliver()
+	return sub
+}
+
+// The events for the game, which is closed once all events have been delivered, the subscriber is
+// dropped, or the subscription is closed.
+func (sub *Subscription) Events() <-chan GameEvent {
+	return sub.events
+}
+
+// Reports whether the subscriber was dropped for falling too far behind.
+func (sub *Subscription) Dropped() bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return sub.dropped
+}
+
+// Stop receiving events, such as when the client disconnects.
+func (sub *Subscription) Close() {
+	sub.close.Do(func() {
+		close(sub.done)
+		if sub.server != nil {
+			sub.server.unsubscribe(sub)
+		}
+	})
+}
+
+// Queue an event without blocking.
+func (sub *Subscription) push(event GameEvent) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.finished {
+		return
+	}
+	if len(sub.pending) >= sub.limit {
+		sub.dropped = true
+		sub.finished = true
+		sub.pending = nil
+	} else {
+		sub.pending = append(sub.pending, event)
+	}
+	sub.signal()
+}
+
+// Mark that no more events will be queued, so the events channel is closed once the pending events are delivered.
+func (sub *Subscription) finish() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	sub.finished = true
+	sub.signal()
+}
+
+// Must be called with the lock held.
+func (sub *Subscription) signal() {
+	select {
+	case sub.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (sub *Subscription) deliver() {
+	defer close(sub.events)
+
+	for {
+		sub.mu.Lock()
+		if len(sub.pending) == 0 {
+			finished := sub.finished
+			sub.mu.Unlock()
+			if finished {
+				return
+			}
+			select {
+			case <-sub.notify:
+				continue
+			case <-sub.done:
+				return
+			}
+		}
+		event := sub.pending[0]
+		sub.pending = sub.pending[1:]
+		sub.mu.Unlock()
+
+		select {
+		case sub.events <- event:
+		case <-sub.done:
+			return
+		}
+	}
+}
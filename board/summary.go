@@ -0,0 +1,141 @@
+package board
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GameSummary is a listing entry for a game, with the outcome derived from its events.
+type GameSummary struct {
+	Game       Game      `json:"game"`
+	Snakes     []string  `json:"snakes"`
+	WinnerID   string    `json:"winnerId"`
+	WinnerName string    `json:"winnerName"`
+	IsDraw     bool      `json:"isDraw"`
+	Turn       int       `json:"turn"`
+	Created    time.Time `json:"created"`
+	Ended      time.Time `json:"ended"` // zero while the game is still running
+}
+
+// Build the summary for a game from the events sent so far.
+func NewGameSummary(game Game, events []GameEvent, created time.Time, ended time.Time) GameSummary {
+	summary := GameSummary{
+		Game:    game,
+		Snakes:  []string{},
+		Created: created,
+		Ended:   ended,
+	}
+
+	var lastFrame *GameFrame
+	for _, event := range events {
+		if frame, ok := event.Data.(GameFrame); ok {
+			lastFrame = &frame
+		}
+	}
+	if lastFrame == nil {
+		return summary
+	}
+
+	summary.Turn = lastFrame.Turn
+	for _, snake := range lastFrame.Snakes {
+		summary.Snakes = append(summary.Snakes, snake.Name)
+	}
+
+	// Only games that were played to the end have a result
+	if ended.IsZero() || game.Status == GameStatusCancelled || game.Status == GameStatusAborted {
+		return summary
+	}
+	for _, snake := range lastFrame.Snakes {
+		if snake.Death == nil {
+			summary.WinnerID = snake.ID
+			summary.WinnerName = snake.Name
+		}
+	}
+	// A draw is possible if there is more than one snake in the game.
+	summary.IsDraw = summary.WinnerID == "" && len(lastFrame.Snakes) > 1
+
+	return summary
+}
+
+// Placement is the finishing position of a snake in a game, where 1 is first.
+type Placement struct {
+	SnakeID         string `json:"SnakeID"`
+	SnakeName       string `json:"SnakeName"`
+	Placement       int    `json:"Placement"`
+	EliminatedTurn  int    `json:"EliminatedTurn"`  // zero for snakes that were never eliminated
+	EliminatedCause string `json:"EliminatedCause"` // empty for snakes that were never eliminated
+}
+
+// Rank the snakes in a game by when they were eliminated, using the last frame of the game.
+// Snakes that survived to the end share first place, as do snakes eliminated on the same turn.
+func Placements(frame GameFrame) []Placement {
+	// Snakes that were never eliminated outlast every snake that was
+	survivedUntil := func(snake Snake) int {
+		if snake.Death == nil {
+			return math.MaxInt
+		}
+		return snake.Death.Turn
+	}
+
+	snakes := append([]Snake(nil), frame.Snakes...)
+	sort.SliceStable(snakes, func(i, j int) bool {
+		return survivedUntil(snakes[i]) > survivedUntil(snakes[j])
+	})
+
+	placements := make([]Placement, len(snakes))
+	for i, snake := range snakes {
+		placement := Placement{SnakeID: snake.ID, SnakeName: snake.Name, Placement: i + 1}
+		if i > 0 && survivedUntil(snake) == survivedUntil(snakes[i-1]) {
+			placement.Placement = placements[i-1].Placement
+		}
+		if snake.Death != nil {
+			placement.EliminatedTurn = snake.Death.Turn
+			placement.EliminatedCause = snake.Death.Cause
+		}
+		placements[i] = placement
+	}
+	return placements
+}
+
+// GameFilter selects games when listing them. Empty fields match every game.
+type GameFilter struct {
+	Status        string
+	Source        string
+	Map           string
+	Ruleset       string
+	SnakeName     string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+func (filter GameFilter) Matches(summary GameSummary) bool {
+	if filter.Status != "" && filter.Status != summary.Game.Status {
+		return false
+	}
+	if filter.Source != "" && filter.Source != summary.Game.Source {
+		return false
+	}
+	if filter.Map != "" && filter.Map != summary.Game.Map {
+		return false
+	}
+	if filter.Ruleset != "" && filter.Ruleset != summary.Game.RulesetName {
+		return false
+	}
+	if !filter.CreatedAfter.IsZero() && summary.Created.Before(filter.CreatedAfter) {
+		return false
+	}
+	if !filter.CreatedBefore.IsZero() && !summary.Created.Before(filter.CreatedBefore) {
+		return false
+	}
+	if filter.SnakeName != "" {
+		for _, name := range summary.Snakes {
+			if strings.EqualFold(name, filter.SnakeName) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+package board_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/stretchr/testify/require"
+)
+
+func frameEvent(turn int, snakes ...board.Snake) board.GameEvent {
+	return board.GameEvent{
+		EventType: board.EVENT_TYPE_FRAME,
+		Data:      board.GameFrame{Turn: turn, Snakes: snakes},
+	}
+}
+
+func TestNewGameSummary(t *testing.T) {
+	game := board.Game{ID: "GAME_ID", Status: "complete"}
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	ended := created.Add(time.Minute)
+	alive := func(id string) board.Snake { return board.Snake{ID: id, Name: "Snake " + id} }
+	dead := func(id string) board.Snake {
+		return board.Snake{ID: id, Name: "Snake " + id, Death: &board.Death{Cause: "wall-collision", Turn: 5}}
+	}
+
+	tests := []struct {
+		name     string
+		game     board.Game
+		events   []board.GameEvent
+		ended    time.Time
+		expected board.GameSummary
+	}{
+		{
+			name:     "no events",
+			events:   []board.GameEvent{},
+			ended:    ended,
+			expected: board.GameSummary{Game: game, Snakes: []string{}, Created: created, Ended: ended},
+		},
+		{
+			name:     "running",
+			events:   []board.GameEvent{frameEvent(0, alive("1"), alive("2")), frameEvent(1, alive("1"), dead("2"))},
+			expected: board.GameSummary{Game: game, Snakes: []string{"Snake 1", "Snake 2"}, Turn: 1, Created: created},
+		},
+		{
+			name:   "winner",
+			events: []board.GameEvent{frameEvent(0, alive("1"), alive("2")), frameEvent(5, alive("1"), dead("2")), {EventType: board.EVENT_TYPE_GAME_END, Data: game}},
+			ended:  ended,
+			expected: board.GameSummary{
+				Game: game, Snakes: []string{"Snake 1", "Snake 2"}, WinnerID: "1", WinnerName: "Snake 1", Turn: 5, Created: created, Ended: ended,
+			},
+		},
+		{
+			name:     "cancelled",
+			game:     board.Game{ID: "GAME_ID", Status: "cancelled"},
+			events:   []board.GameEvent{frameEvent(5, alive("1"), dead("2"))},
+			ended:    ended,
+			expected: board.GameSummary{Game: board.Game{ID: "GAME_ID", Status: "cancelled"}, Snakes: []string{"Snake 1", "Snake 2"}, Turn: 5, Created: created, Ended: ended},
+		},
+		{
+			name:     "draw",
+			events:   []board.GameEvent{frameEvent(5, dead("1"), dead("2"))},
+			ended:    ended,
+			expected: board.GameSummary{Game: game, Snakes: []string{"Snake 1", "Snake 2"}, IsDraw: true, Turn: 5, Created: created, Ended: ended},
+		},
+		{
+			name:     "solo",
+			events:   []board.GameEvent{frameEvent(5, dead("1"))},
+			ended:    ended,
+			expected: board.GameSummary{Game: game, Snakes: []string{"Snake 1"}, Turn: 5, Created: created, Ended: ended},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.game.ID == "" {
+				test.game = game
+			}
+			require.Equal(t, test.expected, board.NewGameSummary(test.game, test.events, created, test.ended))
+		})
+	}
+}
+
+func TestGameSummaryJSON(t *testing.T) {
+	summary := board.GameSummary{Game: board.Game{ID: "GAME_ID"}, Snakes: []string{"Snake 1"}, WinnerID: "1", WinnerName: "Snake 1", Turn: 5}
+	data, err := json.Marshal(summary)
+	require.NoError(t, err)
+
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &fields))
+	require.ElementsMatch(t, []string{"game", "snakes", "winnerId", "winnerName", "isDraw", "turn", "created", "ended"}, keys(fields))
+
+	// Summaries saved before the fields were renamed can still be read
+	var saved board.GameSummary
+	require.NoError(t, json.Unmarshal([]byte(`{"Game": {"ID": "GAME_ID"}, "Snakes": ["Snake 1"], "WinnerID": "1", "WinnerName": "Snake 1", "Turn": 5}`), &saved))
+	require.Equal(t, summary, saved)
+}
+
+func keys(fields map[string]json.RawMessage) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestGameFilter(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	summary := board.GameSummary{
+		Game:    board.Game{ID: "GAME_ID", Status: "complete", Source: "ladder", Map: "standard", RulesetName: "wrapped"},
+		Snakes:  []string{"Alpha", "Beta"},
+		Created: created,
+	}
+
+	require.True(t, board.GameFilter{}.Matches(summary))
+	require.True(t, board.GameFilter{Status: "complete", Source: "ladder", Map: "standard", Ruleset: "wrapped", SnakeName: "beta"}.Matches(summary))
+	require.True(t, board.GameFilter{CreatedAfter: created, CreatedBefore: created.Add(time.Second)}.Matches(summary))
+	require.False(t, board.GameFilter{Status: "running"}.Matches(summary))
+	require.False(t, board.GameFilter{Source: "API"}.Matches(summary))
+	require.False(t, board.GameFilter{Map: "royale"}.Matches(summary))
+	require.False(t, board.GameFilter{Ruleset: "standard"}.Matches(summary))
+	require.False(t, board.GameFilter{SnakeName: "Gamma"}.Matches(summary))
+	require.False(t, board.GameFilter{CreatedAfter: created.Add(time.Second)}.Matches(summary))
+	require.False(t, board.GameFilter{CreatedBefore: created}.Matches(summary))
+}
+
+func TestPlacements(t *testing.T) {
+	frame := board.GameFrame{
+		Turn: 50,
+		Snakes: []board.Snake{
+			{ID: "1", Name: "early", Death: &board.Death{Turn: 10, Cause: rules.EliminatedByOutOfBounds}},
+			{ID: "2", Name: "survivor"},
+			{ID: "3", Name: "late", Death: &board.Death{Turn: 40, Cause: rules.EliminatedByCollision}},
+			{ID: "4", Name: "also late", Death: &board.Death{Turn: 40, Cause: rules.EliminatedByHeadToHeadCollision}},
+		},
+	}
+
+	require.Equal(t, []board.Placement{
+		{SnakeID: "2", SnakeName: "survivor", Placement: 1},
+		{SnakeID: "3", SnakeName: "late", Placement: 2, EliminatedTurn: 40, EliminatedCause: rules.EliminatedByCollision},
+		{SnakeID: "4", SnakeName: "also late", Placement: 2, EliminatedTurn: 40, EliminatedCause: rules.EliminatedByHeadToHeadCollision},
+		{SnakeID: "1", SnakeName: "early", Placement: 4, EliminatedTurn: 10, EliminatedCause: rules.EliminatedByOutOfBounds},
+	}, board.Placements(frame))
+}
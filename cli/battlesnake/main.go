@@ -1,7 +1,10 @@
 package main
 
-import "github.com/BattlesnakeOfficial/rules/cli/commands"
+import (
+	"github.com/BattlesnakeOfficial/rules/cli/commands"
+	"github.com/BattlesnakeOfficial/rules/server"
+)
 
 func main() {
-	commands.Execute()
+	commands.Execute(server.NewCommand())
 }
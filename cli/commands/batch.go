@@ -0,0 +1,289 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/engine"
+	"github.com/google/uuid"
+	log "github.com/spf13/jwalterweatherman"
+)
+
+// Options for running a batch of games with `battlesnake play --games N`.
+type batchOptions struct {
+	Games     int
+	Parallel  int    // the number of games to run at once
+	OutputDir string // if set, every game is exported to its own file in this directory
+}
+
+// Run a batch of games between the same snakes, and write a table of the aggregated results.
+// Each game is a copy of the template, using the template's seed plus the game's index as its seed.
+// If the context is cancelled, the games that are running are cancelled, no more games are started,
+// and the results of the games so far are still written.
+func runBatch(ctx context.Context, template GameState, options batchOptions, w io.Writer) error {
+	if options.Games < 1 {
+		return fmt.Errorf("--games must be at least 1")
+	}
+	if options.Parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+	if options.OutputDir != "" {
+		if err := os.MkdirAll(options.OutputDir, 0755); err != nil {
+			return fmt.Errorf("Failed to create output directory: %w", err)
+		}
+	}
+
+	// Name every snake up front, so that generated names are the same in every game
+	template.Names = append([]string(nil), template.Names...)
+	for len(template.Names) < len(template.URLs) {
+		template.Names = append(template.Names, GenerateSnakeName())
+	}
+	results := newBatchResults(template.Names)
+
+	indexes := make(chan int)
+	go func() {
+		defer close(indexes)
+		for i := 0; i < options.Games; i++ {
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < options.Parallel; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				runBatchGame(ctx, template, options, i, results)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results.write(w)
+}
+
+func runBatchGame(ctx context.Context, template GameState, options batchOptions, index int, results *batchResults) {
+	gameState := template
+	gameState.Seed = template.Seed + int64(index)
+	gameState.quiet = true
+	gameState.ViewMap = false
+	gameState.ViewInBrowser = false
+	gameState.OutputPath = ""
+	if options.OutputDir != "" {
+		digits := len(fmt.Sprint(options.Games))
+		gameState.OutputPath = filepath.Join(options.OutputDir, fmt.Sprintf("game-%0*d.jsonl", digits, index+1))
+	}
+
+	// Snakes are told apart by their position in the options, since their IDs are different in every game
+	snakeIndexes := map[string]int{}
+	gameState.idGenerator = func(i int) string {
+		id := uuid.New().String()
+		if template.idGenerator != nil {
+			id = template.idGenerator(i)
+		}
+		snakeIndexes[id] = i
+		return id
+	}
+	gameState.MoveObserver = func(snakeState engine.SnakeState) {
+		results.addMove(snakeIndexes[snakeState.ID], snakeState)
+	}
+	gameState.onGameEnd = func(result engine.Result) {
+		results.addGame(result)
+		if result.Cancelled {
+			log.INFO.Printf("Game %d/%d (seed %d) cancelled after %d turns", index+1, options.Games, gameState.Seed, result.Turn)
+		} else if result.IsDraw {
+			log.INFO.Printf("Game %d/%d (seed %d) completed after %d turns. It was a draw.", index+1, options.Games, gameState.Seed, result.Turn)
+		} else if result.WinnerName != "" {
+			log.INFO.Printf("Game %d/%d (seed %d) completed after %d turns. %v was the winner.", index+1, options.Games, gameState.Seed, result.Turn, result.WinnerName)
+		} else {
+			log.INFO.Printf("Game %d/%d (seed %d) completed after %d turns.", index+1, options.Games, gameState.Seed, result.Turn)
+		}
+	}
+
+	if err := gameState.Initialize(); err != nil {
+		results.addFailure()
+		log.ERROR.Printf("Game %d/%d (seed %d) failed: %v", index+1, options.Games, gameState.Seed, err)
+		return
+	}
+	if err := gameState.Run(ctx); err != nil {
+		results.addFailure()
+		log.ERROR.Printf("Game %d/%d (seed %d) failed: %v", index+1, options.Games, gameState.Seed, err)
+	}
+}
+
+// The results of a batch of games, collected as each game ends.
+type batchResults struct {
+	mu         sync.Mutex
+	completed  int
+	cancelled  int
+	failed     int
+	draws      int
+	totalTurns int // over completed games
+	snakes     []*batchSnakeResults
+}
+
+// The results of a snake over the games in a batch. Only completed games are counted,
+// other than latencies and failed moves, which include cancelled games.
+type batchSnakeResults struct {
+	name       string
+	wins       int
+	draws      int
+	placements map[int]int    // the number of games the snake finished in each place
+	deaths     map[string]int // the number of games the snake was eliminated in, by cause
+	latencies  []time.Duration
+	moveErrors int
+}
+
+func newBatchResults(names []string) *batchResults {
+	results := &batchResults{}
+	for _, name := range names {
+		results.snakes = append(results.snakes, &batchSnakeResults{
+			name:       name,
+			placements: map[int]int{},
+			deaths:     map[string]int{},
+		})
+	}
+	return results
+}
+
+func (results *batchResults) addMove(index int, snakeState engine.SnakeState) {
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	snake := results.snakes[index]
+	snake.latencies = append(snake.latencies, snakeState.Latency)
+	if snakeState.ErrorCategory() != "" {
+		snake.moveErrors++
+	}
+}
+
+func (results *batchResults) addGame(result engine.Result) {
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	if result.Cancelled {
+		results.cancelled++
+		return
+	}
+	results.completed++
+	results.totalTurns += result.Turn
+	if result.IsDraw {
+		results.draws++
+	}
+
+	// The engine reports snakes in the order they were configured
+	for i, snakeResult := range result.Snakes {
+		snake := results.snakes[i]
+		if snakeResult.ID == result.WinnerID {
+			snake.wins++
+		} else if result.IsDraw && snakeResult.Placement == 1 {
+			snake.draws++
+		}
+		snake.placements[snakeResult.Placement]++
+		if snakeResult.EliminatedCause != "" {
+			snake.deaths[snakeResult.EliminatedCause]++
+		}
+	}
+}
+
+func (results *batchResults) addFailure() {
+	results.mu.Lock()
+	defer results.mu.Unlock()
+	results.failed++
+}
+
+func (results *batchResults) write(w io.Writer) error {
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	averageTurns := 0.0
+	if results.completed > 0 {
+		averageTurns = float64(results.totalTurns) / float64(results.completed)
+	}
+	fmt.Fprintf(w, "Games: %d completed, %d cancelled, %d failed. Draws: %d. Average turns: %.1f\n\n",
+		results.completed, results.cancelled, results.failed, results.draws, averageTurns)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SNAKE\tWINS\tDRAWS\tAVG PLACE\tPLACEMENTS\tDEATHS\tP50\tP90\tP99\tMOVE ERRORS")
+	for _, snake := range results.snakes {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n",
+			snake.name,
+			snake.wins,
+			snake.draws,
+			snake.averagePlacement(),
+			formatCounts(snake.placements),
+			formatCounts(snake.deaths),
+			formatLatency(snake.latencies, 50),
+			formatLatency(snake.latencies, 90),
+			formatLatency(snake.latencies, 99),
+			snake.moveErrors,
+		)
+	}
+	return tw.Flush()
+}
+
+func (snake *batchSnakeResults) averagePlacement() string {
+	games, total := 0, 0
+	for placement, count := range snake.placements {
+		games += count
+		total += placement * count
+	}
+	if games == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", float64(total)/float64(games))
+}
+
+// Format counts as a space-separated list of key:count, sorted by key, or "-" if there are none.
+func formatCounts[K int | string](counts map[K]int) string {
+	keys := make([]K, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return "-"
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	formatted := make([]string, 0, len(keys))
+	for _, key := range keys {
+		formatted = append(formatted, fmt.Sprintf("%v:%d", key, counts[key]))
+	}
+	return strings.Join(formatted, " ")
+}
+
+// Format a percentile of the latencies in milliseconds, or "-" if there are none.
+func formatLatency(latencies []time.Duration, percentile float64) string {
+	if len(latencies) == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%dms", latencyPercentile(latencies, percentile).Milliseconds())
+}
+
+// A percentile of the latencies, using the nearest-rank method, or 0 if there are none.
+func latencyPercentile(latencies []time.Duration, percentile float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/engine"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunBatch(t *testing.T) {
+	template := buildDefaultGameState()
+	template.Names = []string{"one"}
+	template.URLs = []string{"http://one.example.com", "http://two.example.com"}
+	template.httpClient = stubHTTPClient{nil, http.StatusOK, func(url string) string {
+		return `{"move": "up"}`
+	}, time.Millisecond * 42}
+	template.ruleset = StubRuleset{maxTurns: 2, settings: rules.NewSettings(nil)}
+	outputDir := filepath.Join(t.TempDir(), "games")
+
+	output := new(bytes.Buffer)
+	err := runBatch(context.Background(), *template, batchOptions{Games: 3, Parallel: 2, OutputDir: outputDir}, output)
+	require.NoError(t, err)
+
+	lines := strings.Split(output.String(), "\n")
+	require.Equal(t, "Games: 3 completed, 0 cancelled, 0 failed. Draws: 0. Average turns: 3.0", lines[0])
+	require.True(t, strings.HasPrefix(lines[2], "SNAKE"))
+	require.True(t, strings.HasPrefix(lines[3], "one "))
+	require.Contains(t, lines[3], "42ms")
+	require.Len(t, lines, 6, "a row for each snake, including the one with a generated name")
+
+	for i := 1; i <= 3; i++ {
+		export, err := os.ReadFile(filepath.Join(outputDir, fmt.Sprintf("game-%d.jsonl", i)))
+		require.NoError(t, err)
+		require.Len(t, strings.Split(strings.TrimSpace(string(export)), "\n"), 5)
+	}
+}
+
+func TestRunBatchCancelled(t *testing.T) {
+	template := buildDefaultGameState()
+	template.URLs = []string{"http://one.example.com"}
+	template.httpClient = stubHTTPClient{nil, http.StatusOK, func(url string) string {
+		return `{"move": "up"}`
+	}, time.Millisecond}
+	template.ruleset = StubRuleset{maxTurns: 100, settings: rules.NewSettings(nil)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	output := new(bytes.Buffer)
+	err := runBatch(ctx, *template, batchOptions{Games: 100, Parallel: 1}, output)
+	require.NoError(t, err)
+	require.NotContains(t, output.String(), "100 completed")
+}
+
+func TestRunBatchInvalidOptions(t *testing.T) {
+	template := buildDefaultGameState()
+	err := runBatch(context.Background(), *template, batchOptions{Games: 0, Parallel: 1}, new(bytes.Buffer))
+	require.Error(t, err)
+	err = runBatch(context.Background(), *template, batchOptions{Games: 2, Parallel: 0}, new(bytes.Buffer))
+	require.Error(t, err)
+}
+
+func TestBatchResults(t *testing.T) {
+	results := newBatchResults([]string{"one", "two", "three"})
+
+	results.addGame(engine.Result{
+		Turn:       10,
+		WinnerID:   "a",
+		WinnerName: "one",
+		Snakes: []engine.SnakeResult{
+			{ID: "a", Placement: 1},
+			{ID: "b", Placement: 2, EliminatedCause: rules.EliminatedByCollision},
+			{ID: "c", Placement: 2, EliminatedCause: rules.EliminatedByOutOfBounds},
+		},
+	})
+	results.addGame(engine.Result{
+		Turn:   20,
+		IsDraw: true,
+		Snakes: []engine.SnakeResult{
+			{ID: "a", Placement: 2, EliminatedCause: rules.EliminatedByOutOfBounds},
+			{ID: "b", Placement: 1, EliminatedCause: rules.EliminatedByHeadToHeadCollision},
+			{ID: "c", Placement: 1, EliminatedCause: rules.EliminatedByHeadToHeadCollision},
+		},
+	})
+	results.addGame(engine.Result{Turn: 5, Cancelled: true})
+	results.addFailure()
+	for _, latency := range []time.Duration{10, 20, 30, 40, 500} {
+		results.addMove(0, engine.SnakeState{ID: "a", Latency: latency * time.Millisecond})
+	}
+	results.addMove(1, engine.SnakeState{ID: "b", Latency: 500 * time.Millisecond, StatusCode: http.StatusInternalServerError})
+
+	output := new(bytes.Buffer)
+	require.NoError(t, results.write(output))
+	require.Equal(t, strings.Join([]string{
+		"Games: 2 completed, 1 cancelled, 1 failed. Draws: 1. Average turns: 15.0",
+		"",
+		"SNAKE  WINS  DRAWS  AVG PLACE  PLACEMENTS  DEATHS                              P50    P90    P99    MOVE ERRORS",
+		"one    1     0      1.50       1:1 2:1     wall-collision:1                    30ms   500ms  500ms  0",
+		"two    0     1      1.50       1:1 2:1     head-collision:1 snake-collision:1  500ms  500ms  500ms  1",
+		"three  0     1      1.50       1:1 2:1     head-collision:1 wall-collision:1   -      -      -      0",
+		"",
+	}, "\n"), output.String())
+}
+
+func TestFormatLatency(t *testing.T) {
+	latencies := []time.Duration{}
+	require.Equal(t, "-", formatLatency(latencies, 50))
+
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	require.Equal(t, "50ms", formatLatency(latencies, 50))
+	require.Equal(t, "90ms", formatLatency(latencies, 90))
+	require.Equal(t, "99ms", formatLatency(latencies, 99))
+	require.Equal(t, "1ms", formatLatency(latencies, 0))
+	require.Equal(t, time.Millisecond*100, latencies[0], "the latencies aren't sorted in place")
+}
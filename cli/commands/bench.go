@@ -0,0 +1,354 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/client"
+	"github.com/BattlesnakeOfficial/rules/engine"
+	"github.com/spf13/cobra"
+	log "github.com/spf13/jwalterweatherman"
+)
+
+// The number of games simulated to build boards when no input file is given.
+const benchmarkGames = 10
+
+// The most turns played in each simulated game.
+const benchmarkTurns = 150
+
+type Benchmark struct {
+	// Options
+	URL         string
+	Requests    int
+	Concurrency int
+	Rate        float64 // requests per second, or 0 for no limit
+	Timeout     int
+	InputPath   string // an output file from battlesnake play, to take the requests from
+	Width       int
+	Height      int
+	GameType    string
+	MapName     string
+	Snakes      int
+	Seed        int64
+	JSON        bool
+
+	// Internal state
+	httpClient engine.TimedHttpClient // optional, replaces the client with the request timeout
+}
+
+// The results of sending move requests to a snake.
+type BenchmarkReport struct {
+	URL               string             `json:"url"`
+	Requests          int                `json:"requests"`
+	DurationMS        int64              `json:"durationMs"`
+	RequestsPerSecond float64            `json:"requestsPerSecond"`
+	Latency           LatencyPercentiles `json:"latency"`     // not including requests that failed to connect
+	TimeoutRate       float64            `json:"timeoutRate"` // the fraction of requests that timed out
+	Errors            map[string]int     `json:"errors"`      // the number of failed requests, by engine.MoveError* category
+}
+
+type LatencyPercentiles struct {
+	P50MS int64 `json:"p50Ms"`
+	P90MS int64 `json:"p90Ms"`
+	P99MS int64 `json:"p99Ms"`
+	MaxMS int64 `json:"maxMs"`
+}
+
+func NewBenchCommand() *cobra.Command {
+	bench := &Benchmark{}
+
+	var benchCmd = &cobra.Command{
+		Use:   "bench <url>",
+		Short: "Measure how quickly a Battlesnake responds to move requests.",
+		Long: "Measure how quickly a Battlesnake responds to move requests, by sending requests at a configured " +
+			"concurrency and rate. The requests are taken from an output file from battlesnake play, or built from simulated games.",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			bench.URL = args[0]
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			report, err := bench.Run(ctx)
+			if err != nil {
+				log.ERROR.Fatalf("Error running benchmark: %v", err)
+			}
+			if err := bench.writeReport(cmd.OutOrStdout(), report); err != nil {
+				log.ERROR.Fatalf("Error writing report: %v", err)
+			}
+		},
+	}
+
+	benchCmd.Flags().IntVar(&bench.Requests, "requests", 100, "Number of move requests to send")
+	benchCmd.Flags().IntVar(&bench.Concurrency, "concurrency", 1, "Number of requests to send at once")
+	benchCmd.Flags().Float64Var(&bench.Rate, "rate", 0, "Requests to send per second, or 0 to send them as quickly as the snake responds")
+	benchCmd.Flags().IntVarP(&bench.Timeout, "timeout", "t", 500, "Request Timeout")
+	benchCmd.Flags().StringVarP(&bench.InputPath, "input", "i", "", "Output file from battlesnake play --output to take the requests from, instead of simulating games")
+	benchCmd.Flags().IntVarP(&bench.Width, "width", "W", 11, "Width of Board in simulated games")
+	benchCmd.Flags().IntVarP(&bench.Height, "height", "H", 11, "Height of Board in simulated games")
+	benchCmd.Flags().StringVarP(&bench.GameType, "gametype", "g", "standard", "Type of Game Rules in simulated games")
+	benchCmd.Flags().StringVarP(&bench.MapName, "map", "m", "standard", "Game map to use to populate the board in simulated games")
+	benchCmd.Flags().IntVar(&bench.Snakes, "snakes", 2, "Number of snakes in simulated games")
+	benchCmd.Flags().Int64VarP(&bench.Seed, "seed", "r", time.Now().UTC().UnixNano(), "Random Seed, used to simulate games and pick requests")
+	benchCmd.Flags().BoolVar(&bench.JSON, "json", false, "Write the report as JSON")
+
+	benchCmd.Flags().SortFlags = false
+
+	return benchCmd
+}
+
+// Send move requests to the snake until they have all been sent or the context is cancelled,
+// and report on the responses. The returned error is only for problems building the requests.
+func (bench *Benchmark) Run(ctx context.Context) (BenchmarkReport, error) {
+	if bench.Requests < 1 {
+		return BenchmarkReport{}, fmt.Errorf("--requests must be at least 1")
+	}
+	if bench.Concurrency < 1 {
+		return BenchmarkReport{}, fmt.Errorf("--concurrency must be at least 1")
+	}
+	if bench.Rate < 0 {
+		return BenchmarkReport{}, fmt.Errorf("--rate can't be negative")
+	}
+	if bench.Timeout == 0 {
+		bench.Timeout = 500
+	}
+	if bench.httpClient == nil {
+		bench.httpClient = engine.NewTimedHTTPClient(time.Duration(bench.Timeout) * time.Millisecond)
+	}
+	u, err := url.ParseRequestURI(bench.URL)
+	if err != nil {
+		return BenchmarkReport{}, fmt.Errorf("URL %v is not valid: %w", bench.URL, err)
+	}
+	u.Path = path.Join(u.Path, "move")
+	moveURL := u.String()
+
+	requests, err := bench.buildRequests()
+	if err != nil {
+		return BenchmarkReport{}, err
+	}
+	bodies := make([][]byte, 0, len(requests))
+	for _, request := range requests {
+		body, err := json.Marshal(request)
+		if err != nil {
+			return BenchmarkReport{}, fmt.Errorf("Error marshalling JSON from request: %w", err)
+		}
+		bodies = append(bodies, body)
+	}
+	log.INFO.Printf("Sending %d move requests to %v from %d boards, Concurrency: %d, Seed: %d", bench.Requests, moveURL, len(bodies), bench.Concurrency, bench.Seed)
+
+	// Requests are picked at random, and held back to keep to the rate
+	jobs := make(chan []byte)
+	go func() {
+		defer close(jobs)
+		picker := rand.New(rand.NewSource(bench.Seed))
+		var ticker *time.Ticker
+		if bench.Rate > 0 {
+			ticker = time.NewTicker(time.Duration(float64(time.Second) / bench.Rate))
+			defer ticker.Stop()
+		}
+		for i := 0; i < bench.Requests; i++ {
+			if ticker != nil {
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case jobs <- bodies[picker.Intn(len(bodies))]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	results := &benchmarkResults{errors: map[string]int{}}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for worker := 0; worker < bench.Concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for body := range jobs {
+				results.add(bench.sendMove(moveURL, body))
+			}
+		}()
+	}
+	wg.Wait()
+
+	report := results.report(time.Since(start))
+	report.URL = moveURL
+	return report, nil
+}
+
+// The requests to pick from, either from the input file, or from the boards of simulated games.
+func (bench *Benchmark) buildRequests() ([]client.SnakeRequest, error) {
+	if bench.InputPath != "" {
+		f, err := os.Open(bench.InputPath)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open input file: %w", err)
+		}
+		defer f.Close()
+		exported, err := readExportedGame(f)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read input file %v: %w", bench.InputPath, err)
+		}
+		for i := range exported.requests {
+			exported.requests[i].Game.Timeout = bench.Timeout
+		}
+		return exported.requests, nil
+	}
+
+	if !isValidationRuleset(bench.GameType) {
+		return nil, fmt.Errorf("Unknown game type %v, expected one of %v", bench.GameType, strings.Join(validationRulesets, ", "))
+	}
+	if bench.Snakes < 1 {
+		return nil, fmt.Errorf("--snakes must be at least 1")
+	}
+	snakeStates := map[string]engine.SnakeState{}
+	snakeIDs := []string{}
+	for i := 0; i < bench.Snakes; i++ {
+		snakeState := engine.SnakeState{ID: "you", Name: "You"}
+		if i > 0 {
+			snakeState = engine.SnakeState{ID: fmt.Sprintf("snake-%d", i+1), Name: fmt.Sprintf("Snake %d", i+1)}
+		}
+		snakeStates[snakeState.ID] = snakeState
+		snakeIDs = append(snakeIDs, snakeState.ID)
+	}
+
+	var requests []client.SnakeRequest
+	for i := 0; i < benchmarkGames; i++ {
+		simulated, err := simulateGame(bench.GameType, bench.MapName, bench.Width, bench.Height, snakeIDs, benchmarkTurns, bench.Seed+int64(i))
+		if err != nil {
+			return nil, err
+		}
+		game := simulated.clientGame(fmt.Sprintf("bench-%d", i+1), bench.Timeout)
+		game.Source = "bench"
+		for _, boardState := range simulated.boards {
+			// Boards part way through a game are more realistic than the start of a game
+			if boardState.Turn > 0 || len(simulated.boards) == 1 {
+				requests = append(requests, engine.NewSnakeRequest(game, boardState, snakeStates, snakeStates["you"]))
+			}
+		}
+	}
+	return requests, nil
+}
+
+// Send a move request, recording the result in the same way as the engine does.
+func (bench *Benchmark) sendMove(moveURL string, body []byte) engine.SnakeState {
+	snakeState := engine.SnakeState{}
+	res, latency, err := bench.httpClient.Post(moveURL, "application/json", bytes.NewBuffer(body))
+	snakeState.Latency = latency
+	if err != nil {
+		snakeState.Error = err
+		return snakeState
+	}
+	defer res.Body.Close()
+
+	snakeState.StatusCode = res.StatusCode
+	responseBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		snakeState.Error = err
+		return snakeState
+	}
+	if res.StatusCode != http.StatusOK {
+		return snakeState
+	}
+
+	var moveResponse client.MoveResponse
+	if err := json.Unmarshal(responseBody, &moveResponse); err != nil {
+		snakeState.Error = err
+		return snakeState
+	}
+	switch moveResponse.Move {
+	case rules.MoveUp, rules.MoveDown, rules.MoveLeft, rules.MoveRight:
+	default:
+		snakeState.InvalidMove = true
+	}
+	return snakeState
+}
+
+// The results of the requests sent so far, collected from every worker.
+type benchmarkResults struct {
+	mu        sync.Mutex
+	requests  int
+	latencies []time.Duration
+	errors    map[string]int
+}
+
+func (results *benchmarkResults) add(snakeState engine.SnakeState) {
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	results.requests++
+	category := snakeState.ErrorCategory()
+	if category != "" {
+		results.errors[category]++
+	}
+	if category != engine.MoveErrorConnection {
+		results.latencies = append(results.latencies, snakeState.Latency)
+	}
+}
+
+func (results *benchmarkResults) report(duration time.Duration) BenchmarkReport {
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	report := BenchmarkReport{
+		Requests:   results.requests,
+		DurationMS: duration.Milliseconds(),
+		Latency: LatencyPercentiles{
+			P50MS: latencyPercentile(results.latencies, 50).Milliseconds(),
+			P90MS: latencyPercentile(results.latencies, 90).Milliseconds(),
+			P99MS: latencyPercentile(results.latencies, 99).Milliseconds(),
+			MaxMS: latencyPercentile(results.latencies, 100).Milliseconds(),
+		},
+		Errors: map[string]int{},
+	}
+	for category, count := range results.errors {
+		report.Errors[category] = count
+	}
+	if duration > 0 {
+		report.RequestsPerSecond = float64(results.requests) / duration.Seconds()
+	}
+	if results.requests > 0 {
+		report.TimeoutRate = float64(results.errors[engine.MoveErrorTimeout]) / float64(results.requests)
+	}
+	return report
+}
+
+func (bench *Benchmark) writeReport(w io.Writer, report BenchmarkReport) error {
+	if bench.JSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	errors := "none"
+	if len(report.Errors) > 0 {
+		errors = formatCounts(report.Errors)
+	}
+	_, err := fmt.Fprintf(w,
+		"Sent %d move requests to %s in %.1fs (%.1f requests/s)\n"+
+			"Latency: p50 %dms, p90 %dms, p99 %dms, max %dms\n"+
+			"Timeouts: %d (%.1f%%)\n"+
+			"Errors: %s\n",
+		report.Requests, report.URL, float64(report.DurationMS)/1000, report.RequestsPerSecond,
+		report.Latency.P50MS, report.Latency.P90MS, report.Latency.P99MS, report.Latency.MaxMS,
+		report.Errors[engine.MoveErrorTimeout], report.TimeoutRate*100,
+		errors,
+	)
+	return err
+}
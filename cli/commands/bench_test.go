@@ -0,0 +1,207 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/client"
+	"github.com/BattlesnakeOfficial/rules/engine"
+	"github.com/stretchr/testify/require"
+)
+
+func buildDefaultBenchmark(url string) *Benchmark {
+	return &Benchmark{
+		URL:         url,
+		Requests:    20,
+		Concurrency: 4,
+		Timeout:     500,
+		Width:       11,
+		Height:      11,
+		GameType:    "standard",
+		MapName:     "standard",
+		Snakes:      2,
+		Seed:        1,
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	var mu sync.Mutex
+	var moveRequests []client.SnakeRequest
+	snakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request client.SnakeRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		mu.Lock()
+		moveRequests = append(moveRequests, request)
+		mu.Unlock()
+		require.Equal(t, "/move", r.URL.Path)
+		w.Write([]byte(`{"move": "up"}`))
+	}))
+	t.Cleanup(snakeServer.Close)
+
+	report, err := buildDefaultBenchmark(snakeServer.URL).Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, snakeServer.URL+"/move", report.URL)
+	require.Equal(t, 20, report.Requests)
+	require.Empty(t, report.Errors)
+	require.Zero(t, report.TimeoutRate)
+
+	require.Len(t, moveRequests, 20)
+	for _, request := range moveRequests {
+		require.Equal(t, "standard", request.Game.Ruleset.Name)
+		require.Equal(t, "bench", request.Game.Source)
+		require.Equal(t, 500, request.Game.Timeout)
+		require.Greater(t, request.Turn, 0)
+		require.Equal(t, "you", request.You.ID)
+		require.Len(t, request.Board.Snakes, 2)
+	}
+}
+
+func TestBenchmarkInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(buildExportFromFixtures(t)), 0644))
+
+	bench := buildDefaultBenchmark("http://example.com")
+	bench.InputPath = path
+	bench.Timeout = 100
+	bench.Rate = 1000
+	bench.httpClient = stubHTTPClient{nil, http.StatusOK, func(url string) string {
+		return `{"move": "up"}`
+	}, 42 * time.Millisecond}
+	requests, err := bench.buildRequests()
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+	for _, request := range requests {
+		require.Equal(t, "GAME_ID", request.Game.ID)
+		require.Equal(t, 100, request.Game.Timeout)
+	}
+
+	report, err := bench.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 20, report.Requests)
+	require.Equal(t, LatencyPercentiles{P50MS: 42, P90MS: 42, P99MS: 42, MaxMS: 42}, report.Latency)
+
+	bench.InputPath = filepath.Join(t.TempDir(), "missing.jsonl")
+	_, err = bench.Run(context.Background())
+	require.ErrorContains(t, err, "Failed to open input file")
+}
+
+func TestBenchmarkErrors(t *testing.T) {
+	bench := buildDefaultBenchmark("http://example.com")
+	bench.httpClient = stubHTTPClient{&url.Error{Op: "Post", URL: "http://example.com/move", Err: context.DeadlineExceeded}, 0, nil, 500 * time.Millisecond}
+	report, err := bench.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{engine.MoveErrorTimeout: 20}, report.Errors)
+	require.Equal(t, 1.0, report.TimeoutRate)
+	require.Equal(t, int64(500), report.Latency.P99MS)
+
+	// Requests that never reached the snake aren't included in the latency
+	bench.httpClient = stubHTTPClient{errors.New("connection refused"), 0, nil, time.Millisecond}
+	report, err = bench.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{engine.MoveErrorConnection: 20}, report.Errors)
+	require.Zero(t, report.TimeoutRate)
+	require.Equal(t, LatencyPercentiles{}, report.Latency)
+
+	bench.httpClient = stubHTTPClient{nil, http.StatusOK, func(url string) string {
+		return `{"move": "north"}`
+	}, time.Millisecond}
+	report, err = bench.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{engine.MoveErrorInvalidMove: 20}, report.Errors)
+
+	bench.httpClient = stubHTTPClient{nil, http.StatusInternalServerError, func(url string) string {
+		return ""
+	}, time.Millisecond}
+	report, err = bench.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{engine.MoveErrorBadStatus: 20}, report.Errors)
+}
+
+func TestBenchmarkCancelled(t *testing.T) {
+	bench := buildDefaultBenchmark("http://example.com")
+	bench.Rate = 1
+	bench.httpClient = stubHTTPClient{nil, http.StatusOK, func(url string) string {
+		return `{"move": "up"}`
+	}, time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := bench.Run(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, report.Requests)
+}
+
+func TestBenchmarkInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		update   func(*Benchmark)
+		expected string
+	}{
+		{"requests", func(bench *Benchmark) { bench.Requests = 0 }, "--requests must be at least 1"},
+		{"concurrency", func(bench *Benchmark) { bench.Concurrency = 0 }, "--concurrency must be at least 1"},
+		{"rate", func(bench *Benchmark) { bench.Rate = -1 }, "--rate can't be negative"},
+		{"snakes", func(bench *Benchmark) { bench.Snakes = 0 }, "--snakes must be at least 1"},
+		{"url", func(bench *Benchmark) { bench.URL = "example.com" }, "URL example.com is not valid"},
+		{"game type", func(bench *Benchmark) { bench.GameType = "unknown" }, "Unknown game type unknown"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bench := buildDefaultBenchmark("http://example.com")
+			test.update(bench)
+			_, err := bench.Run(context.Background())
+			require.ErrorContains(t, err, test.expected)
+		})
+	}
+}
+
+func TestWriteBenchmarkReport(t *testing.T) {
+	report := BenchmarkReport{
+		URL:               "http://example.com/move",
+		Requests:          200,
+		DurationMS:        4000,
+		RequestsPerSecond: 50,
+		Latency:           LatencyPercentiles{P50MS: 21, P90MS: 48, P99MS: 97, MaxMS: 510},
+		TimeoutRate:       0.01,
+		Errors:            map[string]int{engine.MoveErrorTimeout: 2, engine.MoveErrorBadStatus: 1},
+	}
+
+	output := new(bytes.Buffer)
+	require.NoError(t, (&Benchmark{}).writeReport(output, report))
+	require.Equal(t, strings.Join([]string{
+		"Sent 200 move requests to http://example.com/move in 4.0s (50.0 requests/s)",
+		"Latency: p50 21ms, p90 48ms, p99 97ms, max 510ms",
+		"Timeouts: 2 (1.0%)",
+		"Errors: bad_status:1 timeout:2",
+		"",
+	}, "\n"), output.String())
+
+	output.Reset()
+	require.NoError(t, (&Benchmark{}).writeReport(output, BenchmarkReport{Errors: map[string]int{}}))
+	require.Contains(t, output.String(), "Errors: none\n")
+
+	output.Reset()
+	require.NoError(t, (&Benchmark{JSON: true}).writeReport(output, report))
+	data, err := ioutil.ReadAll(output)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"url": "http://example.com/move",
+		"requests": 200,
+		"durationMs": 4000,
+		"requestsPerSecond": 50,
+		"latency": {"p50Ms": 21, "p90Ms": 48, "p99Ms": 97, "maxMs": 510},
+		"timeoutRate": 0.01,
+		"errors": {"timeout": 2, "bad_status": 1}
+	}`, string(data))
+}
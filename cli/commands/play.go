@@ -2,23 +2,21 @@ package commands
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/BattlesnakeOfficial/rules"
 	"github.com/BattlesnakeOfficial/rules/board"
-	"github.com/BattlesnakeOfficial/rules/client"
+	"github.com/BattlesnakeOfficial/rules/engine"
 	"github.com/BattlesnakeOfficial/rules/maps"
 	"github.com/google/uuid"
 	"github.com/pkg/browser"
@@ -26,23 +24,6 @@ import (
 	log "github.com/spf13/jwalterweatherman"
 )
 
-// Used to store state for each SnakeState while running a local game
-type SnakeState struct {
-	URL        string
-	Name       string
-	ID         string
-	LastMove   string
-	Character  rune
-	Color      string
-	Head       string
-	Tail       string
-	Author     string
-	Version    string
-	Error      error
-	StatusCode int
-	Latency    time.Duration
-}
-
 type GameState struct {
 	// Options
 	Width               int
@@ -65,86 +46,50 @@ type GameState struct {
 	MinimumFood         int
 	HazardDamagePerTurn int
 	ShrinkEveryNTurns   int
+	Settings            map[string]string       // Additional ruleset settings, which take precedence over the options above
+	MoveObserver        func(engine.SnakeState) // Called with the result of every move request, such as to record metrics
 
 	// Internal game state
 	settings    map[string]string
-	snakeStates map[string]SnakeState
+	snakeStates map[string]engine.SnakeState // as of the last turn played
+	characters  map[string]rune              // used to draw each snake with --viewmap
 	gameID      string
-	httpClient  TimedHttpClient
-	ruleset     rules.Ruleset
-	gameMap     maps.GameMap
+	httpClient  engine.TimedHttpClient // optional, replaces the engine's HTTP client
+	ruleset     rules.Ruleset          // optional, replaces the engine's ruleset
 	outputFile  io.WriteCloser
 	idGenerator func(int) string
-}
-type Player struct {
-	Name string `json:"name"`
-	URL  string `json:"url"`
-}
-
-// Plain method interface to launching a new game
-func PlayBattlesnakeGame(players []Player, outputPath string) (string, error) {
-	// Get Board_URL from env variable
-	boardURL := os.Getenv("BOARD_URL")
-	if boardURL == "" {
-		boardURL = "https://board.battlesnake.com"
-	}
-	// Initialize a new GameState
-	gameState := &GameState{
-		// Set default values for the game configuration
-		Width:               11,
-		Height:              11,
-		Timeout:             500,
-		Sequential:          false,
-		GameType:            "standard",
-		MapName:             "standard",
-		ViewMap:             false,
-		UseColor:            false,
-		Seed:                time.Now().UTC().UnixNano(),
-		TurnDelay:           0,
-		TurnDuration:        0,
-		OutputPath:          outputPath,
-		ViewInBrowser:       false,
-		BoardURL:            boardURL,
-		FoodSpawnChance:     15,
-		MinimumFood:         1,
-		HazardDamagePerTurn: 14,
-		ShrinkEveryNTurns:   25,
-	}
-
-	// Populate names and URLs from the players slice
-	for _, player := range players {
-		gameState.Names = append(gameState.Names, player.Name)
-		gameState.URLs = append(gameState.URLs, player.URL)
-	}
-
-	// Initialize the game state
-	if err := gameState.Initialize(); err != nil {
-		return "", fmt.Errorf("error initializing game: %v", err)
-	}
-
-	// Run the game in a goroutine
-	go func() {
-		if err := gameState.Run(); err != nil {
-			log.ERROR.Printf("Error running game: %v", err)
-		}
-		fmt.Printf("Game %v has finished\n", gameState.gameID)
-	}()
-
-	return gameState.gameID, nil
+	quiet       bool                // don't log each turn or the result, such as when running a batch of games
+	onGameEnd   func(engine.Result) // optional, called with the result once the game has ended
 }
 
 func NewPlayCommand() *cobra.Command {
 	gameState := &GameState{}
+	batch := batchOptions{}
 
 	var playCmd = &cobra.Command{
 		Use:   "play",
 		Short: "Play a game of Battlesnake locally.",
-		Long:  "Play a game of Battlesnake locally.",
+		Long:  "Play a game of Battlesnake locally, or a batch of games with --games to compare snakes over many seeds.",
 		Run: func(cmd *cobra.Command, args []string) {
+			if batch.Games > 1 || batch.OutputDir != "" {
+				if gameState.ViewMap || gameState.ViewInBrowser {
+					log.ERROR.Fatalf("--viewmap and --browser can't be used with --games or --output-dir")
+				}
+				if gameState.OutputPath != "" {
+					log.ERROR.Fatalf("--output can't be used with --games or --output-dir, use --output-dir to export every game")
+				}
+				ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+				defer stop()
+				if err := runBatch(ctx, *gameState, batch, cmd.OutOrStdout()); err != nil {
+					log.ERROR.Fatalf("Error running games: %v", err)
+				}
+				return
+			}
+
 			if err := gameState.Initialize(); err != nil {
 				log.ERROR.Fatalf("Error initializing game: %v", err)
 			}
-			if err := gameState.Run(); err != nil {
+			if err := gameState.Run(context.Background()); err != nil {
 				log.ERROR.Fatalf("Error running game: %v", err)
 			}
 		},
@@ -167,6 +112,10 @@ func NewPlayCommand() *cobra.Command {
 	playCmd.Flags().BoolVar(&gameState.ViewInBrowser, "browser", false, "View the game in the browser using the Battlesnake game board")
 	playCmd.Flags().StringVar(&gameState.BoardURL, "board-url", "https://board.battlesnake.com", "Base URL for the game board when using --browser")
 
+	playCmd.Flags().IntVar(&batch.Games, "games", 1, "Number of games to play, printing a table of the results once they have all ended")
+	playCmd.Flags().IntVar(&batch.Parallel, "parallel", 1, "Number of games to play at once when using --games")
+	playCmd.Flags().StringVar(&batch.OutputDir, "output-dir", "", "Directory to output every game's state to when using --games. Existing files will be overwritten")
+
 	playCmd.Flags().IntVar(&gameState.FoodSpawnChance, "foodSpawnChance", 15, "Percentage chance of spawning a new food every round")
 	playCmd.Flags().IntVar(&gameState.MinimumFood, "minimumFood", 1, "Minimum food to keep on the board every turn")
 	playCmd.Flags().IntVar(&gameState.HazardDamagePerTurn, "hazardDamagePerTurn", 14, "Health damage a snake will take when ending its turn in a hazard")
@@ -182,22 +131,14 @@ func (gameState *GameState) Initialize() error {
 	// Generate game ID
 	gameState.gameID = uuid.New().String()
 
-	// Set up HTTP client with request timeout
 	if gameState.Timeout == 0 {
 		gameState.Timeout = 500
 	}
-	gameState.httpClient = timedHTTPClient{
-		&http.Client{
-			Timeout: time.Duration(gameState.Timeout) * time.Millisecond,
-		},
-	}
 
-	// Load game map
-	gameMap, err := maps.GetMap(gameState.MapName)
-	if err != nil {
+	// Check the game map exists before the game is run
+	if _, err := maps.GetMap(gameState.MapName); err != nil {
 		return fmt.Errorf("Failed to load game map %#v: %v", gameState.MapName, err)
 	}
-	gameState.gameMap = gameMap
 
 	// Create settings object
 	gameState.settings = map[string]string{
@@ -206,17 +147,12 @@ func (gameState *GameState) Initialize() error {
 		rules.ParamHazardDamagePerTurn: fmt.Sprint(gameState.HazardDamagePerTurn),
 		rules.ParamShrinkEveryNTurns:   fmt.Sprint(gameState.ShrinkEveryNTurns),
 	}
+	for param, value := range gameState.Settings {
+		gameState.settings[param] = value
+	}
 
-	// Build ruleset from settings
-	ruleset := rules.NewRulesetBuilder().
-		WithSeed(gameState.Seed).
-		WithParams(gameState.settings).
-		WithSolo(len(gameState.URLs) < 2).
-		NamedRuleset(gameState.GameType)
-	gameState.ruleset = ruleset
-
-	// Initialize snake states as empty until we can ping the snake URLs
-	gameState.snakeStates = map[string]SnakeState{}
+	// Initialize snake states as empty until the game starts
+	gameState.snakeStates = map[string]engine.SnakeState{}
 
 	if gameState.OutputPath != "" {
 		f, err := os.OpenFile(gameState.OutputPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
@@ -229,158 +165,118 @@ func (gameState *GameState) Initialize() error {
 	return nil
 }
 
-// Setup and run a full game.
-func (gameState *GameState) Run() error {
-	var gameOver bool
-	var err error
-
-	// Setup local state for snakes
-	gameState.snakeStates, err = gameState.buildSnakesFromOptions()
+// Setup and run a full game, printing each turn and sending it to the board.
+// The game stops early if the context is cancelled, in which case the game ends with the "cancelled" status.
+func (gameState *GameState) Run(ctx context.Context) error {
+	snakes, err := gameState.buildSnakesFromOptions()
 	if err != nil {
 		return fmt.Errorf("Error getting snake metadata: %w", err)
 	}
 
-	rand.Seed(gameState.Seed)
-
-	gameOver, boardState, err := gameState.initializeBoardFromArgs()
-	if err != nil {
-		return fmt.Errorf("Error initializing board: %w", err)
-	}
-
-	gameExporter := GameExporter{
-		game:          gameState.createClientGame(),
-		snakeRequests: make([]client.SnakeRequest, 0),
-		winner:        SnakeState{},
-		isDraw:        false,
-	}
+	var gameExporter *engine.GameExporter
 	exportGame := gameState.outputFile != nil
 	if exportGame {
 		defer gameState.outputFile.Close()
 	}
 
-	boardGame := board.Game{
-		ID:     gameState.gameID,
-		Status: "running",
-		Width:  gameState.Width,
-		Height: gameState.Height,
-		Ruleset: map[string]string{
-			rules.ParamGameType: gameState.GameType,
-		},
-		RulesetName: gameState.GameType,
-		RulesStages: []string{},
-		Map:         gameState.MapName,
-	}
+	boardGame := gameState.createBoardGame()
 	boardServer := board.NewBoardServer(boardGame)
 
 	if gameState.ViewInBrowser {
-		serverURL, err := boardServer.Listen()
-		if err != nil {
-			return fmt.Errorf("Error starting HTTP server: %w", err)
+		if err := gameState.openInBrowser(boardServer); err != nil {
+			return err
 		}
 		defer boardServer.Shutdown()
-		log.INFO.Printf("Board server listening on %s", serverURL)
-
-		boardURL := fmt.Sprintf(gameState.BoardURL+"?engine=%s&game=%s&autoplay=true", serverURL, gameState.gameID)
-
-		log.INFO.Printf("Opening board URL: %s", boardURL)
-		if err := browser.OpenURL(boardURL); err != nil {
-			log.ERROR.Printf("Failed to open browser: %v", err)
-		}
-
-		// send turn zero to websocket server
-		boardServer.SendEvent(gameState.buildFrameEvent(boardState))
-	}
-
-	log.INFO.Printf("Ruleset: %v, Seed: %v", gameState.GameType, gameState.Seed)
-
-	if gameState.ViewMap {
-		gameState.printMap(boardState)
-	} else {
-		gameState.printState(boardState)
-	}
-
-	// Export game first, if enabled, so that we capture the request for turn zero.
-	if exportGame {
-		// The output file was designed in a way so that (nearly) every entry is equivalent to a valid API request.
-		// This is meant to help unlock further development of tools such as replaying a saved game by simply copying each line and sending it as a POST request.
-		// There was a design choice to be made here: the difference between SnakeRequest and BoardState is the `you` key.
-		// We could choose to either store the SnakeRequest of each snake OR to omit the `you` key OR fill the `you` key with one of the snakes
-		// In all cases the API request is technically non-compliant with how the actual API request should be.
-		// The third option (filling the `you` key with an arbitrary snake) is the closest to the actual API request that would need the least manipulation to
-		// be adjusted to look like an API call for a specific snake in the game.
-		for _, snakeState := range gameState.snakeStates {
-			snakeRequest := gameState.getRequestBodyForSnake(boardState, snakeState)
-			gameExporter.AddSnakeRequest(snakeRequest)
-			break
-		}
 	}
 
-	var endTime time.Time
-	for !gameOver {
-		if gameState.TurnDuration > 0 {
-			endTime = time.Now().Add(time.Duration(gameState.TurnDuration) * time.Millisecond)
-		}
+	var runner *engine.GameRunner
+	onTurn := func(boardState *rules.BoardState, snakeStates map[string]engine.SnakeState) {
+		gameState.snakeStates = snakeStates
 
-		gameOver, boardState, err = gameState.createNextBoardState(boardState)
-		if err != nil {
-			return fmt.Errorf("Error processing game: %w", err)
-		}
-
-		if gameOver {
-			// Stop processing here - because game over is detected at the start of the pipeline, nothing will have changed.
-			break
-		}
+		if !gameState.quiet {
+			if boardState.Turn == 0 {
+				log.INFO.Printf("Ruleset: %v, Seed: %v", gameState.GameType, gameState.Seed)
+			}
 
-		if gameState.ViewMap {
-			gameState.printMap(boardState)
-		} else {
-			gameState.printState(boardState)
+			if gameState.ViewMap {
+				gameState.printMap(boardState)
+			} else {
+				gameState.printState(boardState)
+			}
 		}
 
-		if gameState.TurnDelay > 0 {
+		if boardState.Turn > 0 && gameState.TurnDelay > 0 {
 			time.Sleep(time.Duration(gameState.TurnDelay) * time.Millisecond)
 		}
 
-		if gameState.TurnDuration > 0 {
-			time.Sleep(time.Until(endTime))
-		}
-
 		if gameState.ViewInBrowser {
-			boardServer.SendEvent(gameState.buildFrameEvent(boardState))
+			boardServer.SendEvent(engine.NewFrameEvent(boardState, snakeStates))
 		}
 
 		if exportGame {
-			for _, snakeState := range gameState.snakeStates {
-				snakeRequest := gameState.getRequestBodyForSnake(boardState, snakeState)
-				gameExporter.AddSnakeRequest(snakeRequest)
+			// The output file was designed in a way so that (nearly) every entry is equivalent to a valid API request.
+			// This is meant to help unlock further development of tools such as replaying a saved game by simply copying each line and sending it as a POST request.
+			// There was a design choice to be made here: the difference between SnakeRequest and BoardState is the `you` key.
+			// We could choose to either store the SnakeRequest of each snake OR to omit the `you` key OR fill the `you` key with one of the snakes
+			// In all cases the API request is technically non-compliant with how the actual API request should be.
+			// The third option (filling the `you` key with an arbitrary snake) is the closest to the actual API request that would need the least manipulation to
+			// be adjusted to look like an API call for a specific snake in the game.
+			for _, snakeState := range snakeStates {
+				gameExporter.AddSnakeRequest(runner.SnakeRequest(boardState, snakeState.ID))
 				break
 			}
 		}
 	}
-
-	gameExporter.isDraw = false
-
-	if len(gameState.snakeStates) > 1 {
-		// A draw is possible if there is more than one snake in the game.
-		gameExporter.isDraw = true
+	onSnakeResponse := func(snakeState engine.SnakeState) {
+		if !gameState.quiet {
+			logSnakeResponse(snakeState)
+		}
+		if gameState.MoveObserver != nil {
+			gameState.MoveObserver(snakeState)
+		}
+	}
+
+	runner, err = engine.NewGameRunner(engine.Config{
+		GameID:       gameState.gameID,
+		Snakes:       snakes,
+		Width:        gameState.Width,
+		Height:       gameState.Height,
+		GameType:     gameState.GameType,
+		MapName:      gameState.MapName,
+		Seed:         gameState.Seed,
+		Settings:     gameState.settings,
+		Timeout:      gameState.Timeout,
+		TurnDuration: gameState.TurnDuration,
+		Sequential:   gameState.Sequential,
+		HTTPClient:   gameState.httpClient,
+		Ruleset:      gameState.ruleset,
+	}, engine.Observers{
+		OnTurn:          onTurn,
+		OnSnakeResponse: onSnakeResponse,
+		OnGameEnd:       gameState.onGameEnd,
+	})
+	if err != nil {
+		return err
 	}
+	gameExporter = engine.NewGameExporter(runner.ClientGame())
 
-	for _, snake := range boardState.Snakes {
-		snakeState := gameState.snakeStates[snake.ID]
-		if snake.EliminatedCause == rules.NotEliminated {
-			gameExporter.isDraw = false
-			gameExporter.winner = snakeState
-		}
-
-		gameState.sendEndRequest(boardState, snakeState)
+	result, err := runner.Run(ctx)
+	if err != nil {
+		return err
 	}
 
-	if gameExporter.isDraw {
-		log.INFO.Printf("Game completed after %v turns. It was a draw.", boardState.Turn)
-	} else if gameExporter.winner.Name != "" {
-		log.INFO.Printf("Game completed after %v turns. %v was the winner.", boardState.Turn, gameExporter.winner.Name)
+	gameExporter.SetResult(result)
+
+	if gameState.quiet {
+		// The caller reports the result
+	} else if result.Cancelled {
+		log.INFO.Printf("Game cancelled after %v turns.", result.Turn)
+	} else if result.IsDraw {
+		log.INFO.Printf("Game completed after %v turns. It was a draw.", result.Turn)
+	} else if result.WinnerName != "" {
+		log.INFO.Printf("Game completed after %v turns. %v was the winner.", result.Turn, result.WinnerName)
 	} else {
-		log.INFO.Printf("Game completed after %v turns.", boardState.Turn)
+		log.INFO.Printf("Game completed after %v turns.", result.Turn)
 	}
 
 	if gameState.ViewInBrowser {
@@ -395,225 +291,94 @@ func (gameState *GameState) Run() error {
 		if err != nil {
 			return fmt.Errorf("Unable to export game: %w", err)
 		}
-		log.INFO.Printf("Wrote %d lines to output file: %s", lines, gameState.OutputPath)
+		if !gameState.quiet {
+			log.INFO.Printf("Wrote %d lines to output file: %s", lines, gameState.OutputPath)
+		}
 	}
 
 	return nil
 }
 
-func (gameState *GameState) initializeBoardFromArgs() (bool, *rules.BoardState, error) {
-	snakeIds := []string{}
-	for _, snakeState := range gameState.snakeStates {
-		snakeIds = append(snakeIds, snakeState.ID)
-	}
-	boardState, err := maps.SetupBoard(gameState.gameMap.ID(), gameState.ruleset.Settings(), gameState.Width, gameState.Height, snakeIds)
+// Start serving the game to the board, and open the board in the browser.
+// Shutting down the board server waits for the board to receive every event.
+func (gameState *GameState) openInBrowser(boardServer *board.BoardServer) error {
+	serverURL, err := boardServer.Listen()
 	if err != nil {
-		return false, nil, fmt.Errorf("Error initializing BoardState with map: %w", err)
-	}
-	gameOver, boardState, err := gameState.ruleset.Execute(boardState, nil)
-	if err != nil {
-		return false, nil, fmt.Errorf("Error initializing BoardState with ruleset: %w", err)
-	}
-
-	for _, snakeState := range gameState.snakeStates {
-		snakeRequest := gameState.getRequestBodyForSnake(boardState, snakeState)
-		requestBody := serialiseSnakeRequest(snakeRequest)
-		u, _ := url.ParseRequestURI(snakeState.URL)
-		u.Path = path.Join(u.Path, "start")
-		log.DEBUG.Printf("POST %s: %v", u, string(requestBody))
-		_, _, err = gameState.httpClient.Post(u.String(), "application/json", bytes.NewBuffer(requestBody))
-		if err != nil {
-			log.WARN.Printf("Request to %v failed", u.String())
-		}
-	}
-	return gameOver, boardState, nil
-}
-
-func (gameState *GameState) createNextBoardState(boardState *rules.BoardState) (bool, *rules.BoardState, error) {
-	// apply PreUpdateBoard before making requests to snakes
-	boardState, err := maps.PreUpdateBoard(gameState.gameMap, boardState, gameState.ruleset.Settings())
-	if err != nil {
-		return false, boardState, fmt.Errorf("Error pre-updating board with game map: %w", err)
-	}
-
-	// get moves from snakes
-	stateUpdates := make(chan SnakeState, len(gameState.snakeStates))
-	if gameState.Sequential {
-		for _, snakeState := range gameState.snakeStates {
-			for _, snake := range boardState.Snakes {
-				if snakeState.ID == snake.ID && snake.EliminatedCause == rules.NotEliminated {
-					nextSnakeState := gameState.getSnakeUpdate(boardState, snakeState)
-					stateUpdates <- nextSnakeState
-				}
-			}
-		}
-		close(stateUpdates)
-	} else {
-		var wg sync.WaitGroup
-
-		for _, snakeState := range gameState.snakeStates {
-			for _, snake := range boardState.Snakes {
-				if snakeState.ID == snake.ID && snake.EliminatedCause == rules.NotEliminated {
-					wg.Add(1)
-					go func(snakeState SnakeState) {
-						defer wg.Done()
-						nextSnakeState := gameState.getSnakeUpdate(boardState, snakeState)
-						stateUpdates <- nextSnakeState
-					}(snakeState)
-				}
-			}
-		}
-
-		wg.Wait()
-		close(stateUpdates)
-	}
-
-	var moves []rules.SnakeMove
-	for snakeState := range stateUpdates {
-		gameState.snakeStates[snakeState.ID] = snakeState
-		moves = append(moves, rules.SnakeMove{ID: snakeState.ID, Move: snakeState.LastMove})
+		return fmt.Errorf("Error starting HTTP server: %w", err)
 	}
+	log.INFO.Printf("Board server listening on %s", serverURL)
 
-	gameOver, boardState, err := gameState.ruleset.Execute(boardState, moves)
-	if err != nil {
-		return false, boardState, fmt.Errorf("Error updating board state from ruleset: %w", err)
-	}
+	boardURL := fmt.Sprintf(gameState.BoardURL+"?engine=%s&game=%s&autoplay=true", serverURL, gameState.gameID)
 
-	// apply PostUpdateBoard after ruleset operates on snake moves
-	boardState, err = maps.PostUpdateBoard(gameState.gameMap, boardState, gameState.ruleset.Settings())
-	if err != nil {
-		return false, boardState, fmt.Errorf("Error post-updating board with game map: %w", err)
+	log.INFO.Printf("Opening board URL: %s", boardURL)
+	if err := browser.OpenURL(boardURL); err != nil {
+		log.ERROR.Printf("Failed to open browser: %v", err)
 	}
-
-	boardState.Turn += 1
-
-	return gameOver, boardState, nil
+	return nil
 }
 
-func (gameState *GameState) getSnakeUpdate(boardState *rules.BoardState, snakeState SnakeState) SnakeState {
-	snakeState.StatusCode = 0
-	snakeState.Error = nil
-	snakeState.Latency = 0
-
-	snakeRequest := gameState.getRequestBodyForSnake(boardState, snakeState)
-	requestBody := serialiseSnakeRequest(snakeRequest)
-
+// Log why a move request failed, since the engine only records it in the snake state.
+func logSnakeResponse(snakeState engine.SnakeState) {
 	u, err := url.ParseRequestURI(snakeState.URL)
 	if err != nil {
 		log.ERROR.Printf("Error parsing snake URL %#v: %v", snakeState.URL, err)
-		snakeState.Error = err
-		return snakeState
+		return
 	}
 	u.Path = path.Join(u.Path, "move")
-	log.DEBUG.Printf("POST %s: %v", u, string(requestBody))
-	res, responseTime, err := gameState.httpClient.Post(u.String(), "application/json", bytes.NewBuffer(requestBody))
 
-	snakeState.Latency = responseTime
-
-	if err != nil {
+	switch snakeState.ErrorCategory() {
+	case engine.MoveErrorTimeout, engine.MoveErrorConnection:
 		log.WARN.Printf(
 			"Request to %v failed\n"+
-				"\tError: %s", u.String(), err)
-		snakeState.Error = err
-		return snakeState
-	}
-
-	snakeState.StatusCode = res.StatusCode
-
-	if res.Body == nil {
-		log.WARN.Printf(
-			"Failed to parse response from %v\n"+
-				"\tError: body is empty", u.String())
-		return snakeState
-	}
-	defer res.Body.Close()
-	body, readErr := ioutil.ReadAll(res.Body)
-	if readErr != nil {
-		log.WARN.Printf(
-			"Failed to read response body from %v\n"+
-				"\tError: %v", u.String(), readErr)
-		snakeState.Error = readErr
-		return snakeState
-	}
-	if res.StatusCode != http.StatusOK {
+				"\tError: %s", u.String(), snakeState.Error)
+	case engine.MoveErrorBadStatus:
 		log.WARN.Printf(
 			"Got non-ok status code from %v\n"+
 				"\tStatusCode: %d (expected %d)\n"+
-				"\tBody: %q", u.String(), res.StatusCode, http.StatusOK, body)
-		return snakeState
-	}
-
-	playerResponse := client.MoveResponse{}
-	jsonErr := json.Unmarshal(body, &playerResponse)
-	if jsonErr != nil {
+				"\tBody: %q", u.String(), snakeState.StatusCode, http.StatusOK, snakeState.ResponseBody)
+	case engine.MoveErrorInvalidResponse:
 		log.WARN.Printf(
 			"Failed to decode JSON from %v\n"+
 				"\tError: %v\n"+
 				"\tBody: %q\n"+
-				"\tSee https://docs.battlesnake.com/references/api#post-move", u.String(), jsonErr, body)
-		snakeState.Error = jsonErr
-		return snakeState
-	}
-	if playerResponse.Move != "up" && playerResponse.Move != "down" && playerResponse.Move != "left" && playerResponse.Move != "right" {
+				"\tSee https://docs.battlesnake.com/references/api#post-move", u.String(), snakeState.Error, snakeState.ResponseBody)
+	case engine.MoveErrorInvalidMove:
 		log.WARN.Printf(
 			"Failed to parse JSON data from %v\n"+
 				"\tError: invalid move %q, valid moves are \"up\", \"down\", \"left\" or \"right\"\n"+
 				"\tBody: %q\n"+
-				"\tSee https://docs.battlesnake.com/references/api#post-move", u.String(), playerResponse.Move, body)
-		return snakeState
+				"\tSee https://docs.battlesnake.com/references/api#post-move", u.String(), snakeState.RejectedMove, snakeState.ResponseBody)
 	}
-
-	snakeState.LastMove = playerResponse.Move
-
-	return snakeState
 }
 
-func (gameState *GameState) sendEndRequest(boardState *rules.BoardState, snakeState SnakeState) {
-	snakeRequest := gameState.getRequestBodyForSnake(boardState, snakeState)
-	requestBody := serialiseSnakeRequest(snakeRequest)
-	u, _ := url.ParseRequestURI(snakeState.URL)
-	u.Path = path.Join(u.Path, "end")
-	log.DEBUG.Printf("POST %s: %v", u, string(requestBody))
-	_, _, err := gameState.httpClient.Post(u.String(), "application/json", bytes.NewBuffer(requestBody))
-	if err != nil {
-		log.WARN.Printf("Request to %v failed", u.String())
+func (gameState *GameState) createBoardGame() board.Game {
+	ruleset := map[string]string{
+		rules.ParamGameType: gameState.GameType,
 	}
-}
-
-func (gameState *GameState) getRequestBodyForSnake(boardState *rules.BoardState, snakeState SnakeState) client.SnakeRequest {
-	var youSnake rules.Snake
-	for _, snk := range boardState.Snakes {
-		if snakeState.ID == snk.ID {
-			youSnake = snk
-			break
-		}
+	for param, value := range gameState.settings {
+		ruleset[param] = value
 	}
-	request := client.SnakeRequest{
-		Game:  gameState.createClientGame(),
-		Turn:  boardState.Turn,
-		Board: convertStateToBoard(boardState, gameState.snakeStates),
-		You:   convertRulesSnake(youSnake, snakeState),
+	return board.Game{
+		ID:           gameState.gameID,
+		Status:       board.GameStatusRunning,
+		Width:        gameState.Width,
+		Height:       gameState.Height,
+		Ruleset:      ruleset,
+		SnakeTimeout: gameState.Timeout,
+		RulesetName:  gameState.GameType,
+		RulesStages:  []string{},
+		Map:          gameState.MapName,
 	}
-	return request
 }
 
-func (gameState *GameState) createClientGame() client.Game {
-	return client.Game{
-		ID:      gameState.gameID,
-		Timeout: gameState.Timeout,
-		Ruleset: client.Ruleset{
-			Name:     gameState.ruleset.Name(),
-			Version:  "cli", // TODO: Use GitHub Release Version
-			Settings: client.ConvertRulesetSettings(gameState.ruleset.Settings()),
-		},
-		Map: gameState.gameMap.ID(),
-	}
-}
+// The characters used to draw each snake with --viewmap, in the order the snakes are given.
+var snakeCharacters = []rune{'■', '⌀', '●', '☻', '◘', '☺', '□', '⍟'}
 
-func (gameState *GameState) buildSnakesFromOptions() (map[string]SnakeState, error) {
-	bodyChars := []rune{'■', '⌀', '●', '☻', '◘', '☺', '□', '⍟'}
+// Pair up the snake names and URLs given as options, generating any missing names.
+func (gameState *GameState) buildSnakesFromOptions() ([]engine.SnakeConfig, error) {
 	var numSnakes int
-	snakes := map[string]SnakeState{}
+	snakes := []engine.SnakeConfig{}
+	gameState.characters = map[string]rune{}
 	numNames := len(gameState.Names)
 	numURLs := len(gameState.URLs)
 	if numNames > numURLs {
@@ -649,46 +414,12 @@ func (gameState *GameState) buildSnakesFromOptions() (map[string]SnakeState, err
 			return nil, fmt.Errorf("URL for name %v is missing", gameState.Names[i])
 		}
 
-		snakeState := SnakeState{
-			Name: snakeName, URL: snakeURL, ID: id, LastMove: "up", Character: bodyChars[i%8],
-		}
-		var snakeErr error
-		res, _, err := gameState.httpClient.Get(snakeURL)
-		if err != nil {
-			return nil, fmt.Errorf("Snake metadata request to %v failed: %w", snakeURL, err)
-		}
-
-		snakeState.StatusCode = res.StatusCode
-
-		if res.Body == nil {
-			return nil, fmt.Errorf("Empty response body from snake metadata URL: %v", snakeURL)
-		}
-
-		defer res.Body.Close()
-		body, readErr := ioutil.ReadAll(res.Body)
-		if readErr != nil {
-			return nil, fmt.Errorf("Error reading from snake metadata URL %v: %w", snakeURL, readErr)
-		}
-
-		pingResponse := client.SnakeMetadataResponse{}
-		jsonErr := json.Unmarshal(body, &pingResponse)
-		if jsonErr != nil {
-			return nil, fmt.Errorf("Failed to parse response from %v: %w", snakeURL, jsonErr)
-		}
-
-		snakeState.Head = pingResponse.Head
-		snakeState.Tail = pingResponse.Tail
-		snakeState.Color = pingResponse.Color
-		snakeState.Author = pingResponse.Author
-		snakeState.Version = pingResponse.Version
+		snakes = append(snakes, engine.SnakeConfig{ID: id, Name: snakeName, URL: snakeURL})
+		gameState.characters[id] = snakeCharacters[i%len(snakeCharacters)]
 
-		if snakeErr != nil {
-			snakeState.Error = snakeErr
+		if !gameState.quiet {
+			log.INFO.Printf("Snake ID: %v URL: %v, Name: \"%v\"", id, snakeURL, snakeName)
 		}
-
-		snakes[snakeState.ID] = snakeState
-
-		log.INFO.Printf("Snake ID: %v URL: %v, Name: \"%v\"", snakeState.ID, snakeURL, snakeState.Name)
 	}
 	return snakes, nil
 }
@@ -755,14 +486,14 @@ func (gameState *GameState) printMap(boardState *rules.BoardState) {
 				if gameState.UseColor {
 					board[b.X][b.Y] = fmt.Sprintf(TERM_FG_RGB+"■", red, green, blue)
 				} else {
-					board[b.X][b.Y] = string(state.Character)
+					board[b.X][b.Y] = string(gameState.characters[s.ID])
 				}
 			}
 		}
 		if gameState.UseColor {
 			o.WriteString(fmt.Sprintf("%v "+TERM_FG_RGB+TERM_BG_WHITE+"■■■"+TERM_RESET+": ", state.Name, red, green, blue))
 		} else {
-			o.WriteString(fmt.Sprintf("%v %c: ", state.Name, state.Character))
+			o.WriteString(fmt.Sprintf("%v %c: ", state.Name, gameState.characters[s.ID]))
 		}
 		o.WriteString(fmt.Sprintf("Health: %d", s.Health))
 		if s.EliminatedCause != rules.NotEliminated {
@@ -785,110 +516,6 @@ func (gameState *GameState) printMap(boardState *rules.BoardState) {
 	fmt.Println(o.String())
 }
 
-func (gameState *GameState) buildFrameEvent(boardState *rules.BoardState) board.GameEvent {
-	snakes := []board.Snake{}
-
-	for _, snake := range boardState.Snakes {
-		snakeState := gameState.snakeStates[snake.ID]
-
-		latencyMS := snakeState.Latency.Milliseconds()
-		// round up latency of 0 to 1, to avoid legacy error display in board
-		if latencyMS == 0 {
-			latencyMS = 1
-		}
-		convertedSnake := board.Snake{
-			ID:            snake.ID,
-			Name:          snakeState.Name,
-			Body:          snake.Body,
-			Health:        snake.Health,
-			Color:         snakeState.Color,
-			HeadType:      snakeState.Head,
-			TailType:      snakeState.Tail,
-			Author:        snakeState.Author,
-			StatusCode:    snakeState.StatusCode,
-			IsBot:         false,
-			IsEnvironment: false,
-			Latency:       fmt.Sprint(latencyMS),
-		}
-		if snakeState.Error != nil {
-			// Instead of trying to keep in sync with the production engine's
-			// error detection and messages, just show a generic error and rely
-			// on the CLI logs to show what really happened.
-			convertedSnake.Error = "0:Error communicating with server"
-		} else if snakeState.StatusCode != http.StatusOK {
-			convertedSnake.Error = fmt.Sprintf("7:Bad HTTP status code %d", snakeState.StatusCode)
-		}
-		if snake.EliminatedCause != rules.NotEliminated {
-			convertedSnake.Death = &board.Death{
-				Cause:        snake.EliminatedCause,
-				Turn:         snake.EliminatedOnTurn,
-				EliminatedBy: snake.EliminatedBy,
-			}
-		}
-		snakes = append(snakes, convertedSnake)
-	}
-
-	gameFrame := board.GameFrame{
-		Turn:    boardState.Turn,
-		Snakes:  snakes,
-		Food:    boardState.Food,
-		Hazards: boardState.Hazards,
-	}
-
-	return board.GameEvent{
-		EventType: board.EVENT_TYPE_FRAME,
-		Data:      gameFrame,
-	}
-}
-
-func serialiseSnakeRequest(snakeRequest client.SnakeRequest) []byte {
-	requestJSON, err := json.Marshal(snakeRequest)
-	if err != nil {
-		// This is likely to be a programming error like a unsupported type or cyclical reference
-		log.ERROR.Panicf("Error marshalling JSON from State: %v", err)
-	}
-	return requestJSON
-}
-
-func convertRulesSnake(snake rules.Snake, snakeState SnakeState) client.Snake {
-	latencyMS := snakeState.Latency.Milliseconds()
-	return client.Snake{
-		ID:      snake.ID,
-		Name:    snakeState.Name,
-		Health:  snake.Health,
-		Body:    client.CoordFromPointArray(snake.Body),
-		Latency: fmt.Sprint(latencyMS),
-		Head:    client.CoordFromPoint(snake.Body[0]),
-		Length:  int(len(snake.Body)),
-		Shout:   "",
-		Customizations: client.Customizations{
-			Head:  snakeState.Head,
-			Tail:  snakeState.Tail,
-			Color: snakeState.Color,
-		},
-	}
-}
-
-func convertRulesSnakes(snakes []rules.Snake, snakeStates map[string]SnakeState) []client.Snake {
-	a := make([]client.Snake, 0)
-	for _, snake := range snakes {
-		if snake.EliminatedCause == rules.NotEliminated {
-			a = append(a, convertRulesSnake(snake, snakeStates[snake.ID]))
-		}
-	}
-	return a
-}
-
-func convertStateToBoard(boardState *rules.BoardState, snakeStates map[string]SnakeState) client.Board {
-	return client.Board{
-		Height:  boardState.Height,
-		Width:   boardState.Width,
-		Food:    client.CoordFromPointArray(boardState.Food),
-		Hazards: client.CoordFromPointArray(boardState.Hazards),
-		Snakes:  convertRulesSnakes(boardState.Snakes, snakeStates),
-	}
-}
-
 // Parses a color string like "#ef03d3" to rgb values from 0 to 255 or returns
 // the default gray if any errors occure
 func parseSnakeColor(color string) (int64, int64, int64) {
@@ -0,0 +1,248 @@
+package commands
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/BattlesnakeOfficial/rules/client"
+	"github.com/BattlesnakeOfficial/rules/engine"
+	"github.com/spf13/cobra"
+	log "github.com/spf13/jwalterweatherman"
+)
+
+// The longest line expected in an output file, which holds the request for a single turn.
+const maxExportLineLength = 10 * 1024 * 1024
+
+type GameReplay struct {
+	// Options
+	TurnDelay     int
+	StartTurn     int
+	UseColor      bool
+	ViewInBrowser bool
+	BoardURL      string
+}
+
+func NewReplayCommand() *cobra.Command {
+	replay := &GameReplay{}
+
+	var replayCmd = &cobra.Command{
+		Use:   "replay <file>",
+		Short: "Replay a game saved with battlesnake play --output.",
+		Long:  "Replay a game saved with battlesnake play --output, in the terminal or in the browser, without sending any requests to the snakes.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := replay.Run(args[0]); err != nil {
+				log.ERROR.Fatalf("Error replaying game: %v", err)
+			}
+		},
+	}
+
+	replayCmd.Flags().IntVarP(&replay.TurnDelay, "delay", "d", 250, "Turn Delay in Milliseconds when replaying in the terminal")
+	replayCmd.Flags().IntVar(&replay.StartTurn, "turn", 0, "Turn to start the replay from")
+	replayCmd.Flags().BoolVarP(&replay.UseColor, "color", "c", false, "Use color to draw the map")
+	replayCmd.Flags().BoolVar(&replay.ViewInBrowser, "browser", false, "View the game in the browser using the Battlesnake game board")
+	replayCmd.Flags().StringVar(&replay.BoardURL, "board-url", "https://board.battlesnake.com", "Base URL for the game board when using --browser")
+
+	replayCmd.Flags().SortFlags = false
+
+	return replayCmd
+}
+
+// Replay the game in the output file at the given path, drawing each turn with the map
+// used by `battlesnake play --viewmap`, or serving the turns to the board.
+func (replay *GameReplay) Run(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Failed to open game file: %w", err)
+	}
+	defer f.Close()
+
+	exported, err := readExportedGame(f)
+	if err != nil {
+		return fmt.Errorf("Failed to read game file %v: %w", path, err)
+	}
+
+	lastTurn := exported.requests[len(exported.requests)-1].Turn
+	start := -1
+	for i, request := range exported.requests {
+		if request.Turn >= replay.StartTurn {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return fmt.Errorf("Turn %d is after the end of the game, which has turns 0 to %d", replay.StartTurn, lastTurn)
+	}
+	requests := exported.requests[start:]
+
+	gameState := replay.buildGameState(exported)
+	log.INFO.Printf("Replaying game %v, Ruleset: %v, Map: %v", gameState.gameID, gameState.GameType, gameState.MapName)
+
+	if replay.ViewInBrowser {
+		boardGame := gameState.createBoardGame()
+		boardServer := board.NewBoardServer(boardGame)
+		if err := gameState.openInBrowser(boardServer); err != nil {
+			return err
+		}
+		defer boardServer.Shutdown()
+
+		// The board controls the playback speed, so every turn is sent at once
+		for _, request := range requests {
+			boardServer.SendEvent(engine.NewFrameEvent(gameState.replayTurn(request), gameState.snakeStates))
+		}
+		boardServer.SendEvent(board.GameEvent{
+			EventType: board.EVENT_TYPE_GAME_END,
+			Data:      boardGame,
+		})
+	} else {
+		for i, request := range requests {
+			if i > 0 && replay.TurnDelay > 0 {
+				time.Sleep(time.Duration(replay.TurnDelay) * time.Millisecond)
+			}
+			gameState.printMap(gameState.replayTurn(request))
+		}
+	}
+
+	if exported.result.IsDraw {
+		log.INFO.Printf("Game ended on turn %v. It was a draw.", lastTurn)
+	} else if exported.result.WinnerName != "" {
+		log.INFO.Printf("Game ended on turn %v. %v was the winner.", lastTurn, exported.result.WinnerName)
+	} else {
+		log.INFO.Printf("Game ended on turn %v.", lastTurn)
+	}
+	return nil
+}
+
+// Build the state used to draw the game, with every snake that appears in it.
+func (replay *GameReplay) buildGameState(exported *exportedGame) *GameState {
+	firstBoard := exported.requests[0].Board
+	gameState := &GameState{
+		Width:         firstBoard.Width,
+		Height:        firstBoard.Height,
+		Timeout:       exported.game.Timeout,
+		GameType:      exported.game.Ruleset.Name,
+		MapName:       exported.game.Map,
+		UseColor:      replay.UseColor,
+		ViewInBrowser: replay.ViewInBrowser,
+		BoardURL:      replay.BoardURL,
+		gameID:        exported.game.ID,
+		settings:      rulesetParams(exported.game.Ruleset.Settings),
+		snakeStates:   map[string]engine.SnakeState{},
+		characters:    map[string]rune{},
+	}
+
+	for _, request := range exported.requests {
+		for _, snake := range request.Board.Snakes {
+			if _, ok := gameState.snakeStates[snake.ID]; ok {
+				continue
+			}
+			gameState.characters[snake.ID] = snakeCharacters[len(gameState.snakeStates)%len(snakeCharacters)]
+			gameState.snakeStates[snake.ID] = engine.SnakeState{
+				ID:         snake.ID,
+				Name:       snake.Name,
+				Color:      snake.Customizations.Color,
+				Head:       snake.Customizations.Head,
+				Tail:       snake.Customizations.Tail,
+				StatusCode: http.StatusOK, // failed requests aren't recorded in the output file
+			}
+		}
+	}
+	return gameState
+}
+
+// Convert a turn from the output file to a board, updating the snakes' latency to match.
+// Only the snakes that were still in the game are recorded for each turn.
+func (gameState *GameState) replayTurn(request client.SnakeRequest) *rules.BoardState {
+	snakes := make([]rules.Snake, 0, len(request.Board.Snakes))
+	for _, snake := range request.Board.Snakes {
+		snakeState := gameState.snakeStates[snake.ID]
+		latencyMS, _ := strconv.Atoi(snake.Latency)
+		snakeState.Latency = time.Duration(latencyMS) * time.Millisecond
+		gameState.snakeStates[snake.ID] = snakeState
+
+		snakes = append(snakes, rules.Snake{
+			ID:     snake.ID,
+			Body:   pointsFromCoords(snake.Body),
+			Health: snake.Health,
+		})
+	}
+
+	return rules.NewBoardState(request.Board.Width, request.Board.Height).
+		WithTurn(request.Turn).
+		WithFood(pointsFromCoords(request.Board.Food)).
+		WithHazards(pointsFromCoords(request.Board.Hazards)).
+		WithSnakes(snakes)
+}
+
+// A game read back from an output file written by engine.GameExporter.
+type exportedGame struct {
+	game     client.Game
+	requests []client.SnakeRequest // one for each turn, in order
+	result   engine.ExportResult
+}
+
+// Read an output file, which has the game on the first line, the request for each turn on the
+// lines that follow, and the result on the last line.
+func readExportedGame(r io.Reader) (*exportedGame, error) {
+	type exportLine struct {
+		number int
+		data   []byte
+	}
+	var lines []exportLine
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxExportLineLength)
+	for number := 1; scanner.Scan(); number++ {
+		if len(scanner.Bytes()) > 0 {
+			lines = append(lines, exportLine{number, append([]byte(nil), scanner.Bytes()...)})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) < 3 {
+		return nil, fmt.Errorf("expected the game, at least one turn and the result, but found %d lines", len(lines))
+	}
+
+	exported := &exportedGame{}
+	if err := json.Unmarshal(lines[0].data, &exported.game); err != nil {
+		return nil, fmt.Errorf("invalid game on line %d: %w", lines[0].number, err)
+	}
+	for _, line := range lines[1 : len(lines)-1] {
+		var request client.SnakeRequest
+		if err := json.Unmarshal(line.data, &request); err != nil {
+			return nil, fmt.Errorf("invalid turn on line %d: %w", line.number, err)
+		}
+		exported.requests = append(exported.requests, request)
+	}
+	last := lines[len(lines)-1]
+	if err := json.Unmarshal(last.data, &exported.result); err != nil {
+		return nil, fmt.Errorf("invalid result on line %d: %w", last.number, err)
+	}
+	return exported, nil
+}
+
+// Convert the settings sent to snakes back to ruleset parameters, as shown by the board.
+func rulesetParams(settings client.RulesetSettings) map[string]string {
+	return map[string]string{
+		rules.ParamFoodSpawnChance:     fmt.Sprint(settings.FoodSpawnChance),
+		rules.ParamMinimumFood:         fmt.Sprint(settings.MinimumFood),
+		rules.ParamHazardDamagePerTurn: fmt.Sprint(settings.HazardDamagePerTurn),
+		rules.ParamShrinkEveryNTurns:   fmt.Sprint(settings.RoyaleSettings.ShrinkEveryNTurns),
+	}
+}
+
+func pointsFromCoords(coords []client.Coord) []rules.Point {
+	points := make([]rules.Point, 0, len(coords))
+	for _, coord := range coords {
+		points = append(points, rules.Point{X: coord.X, Y: coord.Y})
+	}
+	return points
+}
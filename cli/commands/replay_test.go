@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/BattlesnakeOfficial/rules/engine"
+	"github.com/stretchr/testify/require"
+)
+
+// Build an output file from the fixtures written by TestOutputFile.
+func buildExportFromFixtures(t *testing.T) string {
+	t.Helper()
+	var export bytes.Buffer
+	for _, fixture := range []string{"jsonl_game.json", "jsonl_turn_0.json", "jsonl_turn_1.json", "jsonl_game_complete.json"} {
+		data, err := os.ReadFile(filepath.Join("testdata", fixture))
+		require.NoError(t, err)
+		require.NoError(t, json.Compact(&export, data))
+		export.WriteString("\n")
+	}
+	return export.String()
+}
+
+func TestReadExportedGame(t *testing.T) {
+	exported, err := readExportedGame(strings.NewReader(buildExportFromFixtures(t)))
+	require.NoError(t, err)
+
+	require.Equal(t, "GAME_ID", exported.game.ID)
+	require.Equal(t, "standard", exported.game.Ruleset.Name)
+	require.Len(t, exported.requests, 2)
+	require.Equal(t, 0, exported.requests[0].Turn)
+	require.Equal(t, 1, exported.requests[1].Turn)
+	require.Equal(t, "snk_0", exported.requests[1].Board.Snakes[0].ID)
+	require.Equal(t, engine.ExportResult{WinnerID: "snk_0", WinnerName: "example snake"}, exported.result)
+}
+
+func TestReadExportedGameErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		export   string
+		expected string
+	}{
+		{"empty", "", "found 0 lines"},
+		{"no turns", "{}\n{}\n", "found 2 lines"},
+		{"invalid game", "[]\n{}\n{}\n", "invalid game on line 1"},
+		{"invalid turn", "{}\n\n{}\n{\"turn\": \"one\"}\n{}\n", "invalid turn on line 4"},
+		{"invalid result", "{}\n{}\nnull,\n", "invalid result on line 3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := readExportedGame(strings.NewReader(test.export))
+			require.ErrorContains(t, err, test.expected)
+		})
+	}
+}
+
+func TestReplayTurn(t *testing.T) {
+	exported, err := readExportedGame(strings.NewReader(buildExportFromFixtures(t)))
+	require.NoError(t, err)
+
+	replay := &GameReplay{UseColor: true}
+	gameState := replay.buildGameState(exported)
+	require.Equal(t, 11, gameState.Width)
+	require.Equal(t, "standard", gameState.GameType)
+	require.Equal(t, "2", gameState.settings[rules.ParamMinimumFood])
+	require.True(t, gameState.UseColor)
+	require.Equal(t, '■', gameState.characters["snk_0"])
+
+	boardState := gameState.replayTurn(exported.requests[1])
+	require.Equal(t, 1, boardState.Turn)
+	require.Equal(t, []rules.Point{{X: 0, Y: 4}, {X: 5, Y: 5}}, boardState.Food)
+	require.Equal(t, []rules.Snake{{
+		ID:     "snk_0",
+		Body:   []rules.Point{{X: 1, Y: 5}, {X: 1, Y: 5}, {X: 1, Y: 5}},
+		Health: 100,
+	}}, boardState.Snakes)
+	require.Equal(t, 42*time.Millisecond, gameState.snakeStates["snk_0"].Latency)
+
+	frame := engine.NewFrameEvent(boardState, gameState.snakeStates).Data.(board.GameFrame)
+	require.Equal(t, "example snake", frame.Snakes[0].Name)
+	require.Equal(t, "#123456", frame.Snakes[0].Color)
+	require.Equal(t, "42", frame.Snakes[0].Latency)
+	require.Empty(t, frame.Snakes[0].Error)
+}
+
+func TestReplayRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(buildExportFromFixtures(t)), 0644))
+
+	replay := &GameReplay{StartTurn: 1}
+	require.NoError(t, replay.Run(path))
+
+	replay = &GameReplay{StartTurn: 2}
+	require.ErrorContains(t, replay.Run(path), "Turn 2 is after the end of the game, which has turns 0 to 1")
+
+	replay = &GameReplay{}
+	require.Error(t, replay.Run(filepath.Join(t.TempDir(), "missing.jsonl")))
+}
@@ -21,14 +21,20 @@ var rootCmd = &cobra.Command{
 	Long:  "Tools and utilities for Battlesnake games.",
 }
 
-func Execute() {
+// Run the CLI. Extra commands come from packages that build on this one, such as the server,
+// which can't be imported here without an import cycle.
+func Execute(extraCommands ...*cobra.Command) {
 	rootCmd.AddCommand(NewPlayCommand())
+	rootCmd.AddCommand(NewReplayCommand())
+	rootCmd.AddCommand(NewValidateCommand())
+	rootCmd.AddCommand(NewBenchCommand())
 
 	mapCommand := NewMapCommand()
 	mapCommand.AddCommand(NewMapListCommand())
 	mapCommand.AddCommand(NewMapInfoCommand())
 
 	rootCmd.AddCommand(mapCommand)
+	rootCmd.AddCommand(extraCommands...)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -0,0 +1,154 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/client"
+	"github.com/BattlesnakeOfficial/rules/maps"
+)
+
+// A game played without sending any requests, by snakes that avoid walls and each other.
+// It is used to build realistic requests for testing a snake.
+type simulatedGame struct {
+	ruleset rules.Ruleset
+	gameMap maps.GameMap
+	boards  []*rules.BoardState // the board at the start of the game, then after every turn played
+}
+
+// Play up to the given number of turns of a game, stopping early if any snake would be eliminated.
+// Games with the same seed are played in the same way.
+func simulateGame(gameType string, mapName string, width int, height int, snakeIDs []string, turns int, seed int64) (simulatedGame, error) {
+	gameMap, err := maps.GetMap(mapName)
+	if err != nil {
+		return simulatedGame{}, fmt.Errorf("Failed to load game map %#v: %v", mapName, err)
+	}
+	// The same settings as the defaults for battlesnake play, with a random source for just this game
+	rand := rules.NewSeedRand(seed)
+	ruleset := rules.NewRulesetBuilder().
+		WithSeed(seed).
+		WithRand(rand).
+		WithParams(map[string]string{
+			rules.ParamFoodSpawnChance:     "15",
+			rules.ParamMinimumFood:         "1",
+			rules.ParamHazardDamagePerTurn: "14",
+			rules.ParamShrinkEveryNTurns:   "25",
+		}).
+		WithSolo(len(snakeIDs) < 2).
+		NamedRuleset(gameType)
+
+	boardState, err := maps.SetupBoard(gameMap.ID(), ruleset.Settings(), width, height, snakeIDs)
+	if err != nil {
+		return simulatedGame{}, fmt.Errorf("Error initializing BoardState with map: %w", err)
+	}
+	_, boardState, err = ruleset.Execute(boardState, nil)
+	if err != nil {
+		return simulatedGame{}, fmt.Errorf("Error initializing BoardState with ruleset: %w", err)
+	}
+
+	game := simulatedGame{ruleset: ruleset, gameMap: gameMap, boards: []*rules.BoardState{boardState}}
+	wrapped := strings.HasPrefix(gameType, rules.GameTypeWrapped)
+	for i := 0; i < turns; i++ {
+		var moves []rules.SnakeMove
+		for _, snake := range boardState.Snakes {
+			if snake.EliminatedCause == rules.NotEliminated {
+				moves = append(moves, rules.SnakeMove{ID: snake.ID, Move: simulatedMove(rand, boardState, snake, wrapped)})
+			}
+		}
+		nextState, err := maps.PreUpdateBoard(gameMap, boardState, ruleset.Settings())
+		if err != nil {
+			return simulatedGame{}, err
+		}
+		gameOver, nextState, err := ruleset.Execute(nextState, moves)
+		if err != nil {
+			return simulatedGame{}, err
+		}
+		nextState, err = maps.PostUpdateBoard(gameMap, nextState, ruleset.Settings())
+		if err != nil {
+			return simulatedGame{}, err
+		}
+		nextState.Turn += 1
+		if gameOver || !allSnakesAlive(nextState) {
+			break
+		}
+		boardState = nextState
+		game.boards = append(game.boards, boardState)
+	}
+	return game, nil
+}
+
+// The game as it is described in requests to the snakes.
+func (game simulatedGame) clientGame(id string, timeout int) client.Game {
+	return client.Game{
+		ID:      id,
+		Timeout: timeout,
+		Ruleset: client.Ruleset{
+			Name:     game.ruleset.Name(),
+			Version:  "cli", // TODO: Use GitHub Release Version
+			Settings: client.ConvertRulesetSettings(game.ruleset.Settings()),
+		},
+		Map: game.gameMap.ID(),
+	}
+}
+
+// Pick a move that doesn't hit a wall or a snake, preferring moves with the most room to keep moving.
+func simulatedMove(rand rules.Rand, boardState *rules.BoardState, snake rules.Snake, wrapped bool) string {
+	occupied := map[rules.Point]bool{}
+	for _, other := range boardState.Snakes {
+		if other.EliminatedCause == rules.NotEliminated {
+			for _, point := range other.Body {
+				occupied[rules.Point{X: point.X, Y: point.Y}] = true
+			}
+		}
+	}
+
+	directions := []struct {
+		move   string
+		dx, dy int
+	}{
+		{rules.MoveUp, 0, 1}, {rules.MoveDown, 0, -1}, {rules.MoveLeft, -1, 0}, {rules.MoveRight, 1, 0},
+	}
+	// The point in a direction, if it's free
+	step := func(from rules.Point, direction int) (rules.Point, bool) {
+		next := rules.Point{X: from.X + directions[direction].dx, Y: from.Y + directions[direction].dy}
+		if wrapped {
+			next.X = (next.X + boardState.Width) % boardState.Width
+			next.Y = (next.Y + boardState.Height) % boardState.Height
+		}
+		free := next.X >= 0 && next.X < boardState.Width && next.Y >= 0 && next.Y < boardState.Height && !occupied[next]
+		return next, free
+	}
+
+	head := rules.Point{X: snake.Body[0].X, Y: snake.Body[0].Y}
+	bestMove, bestRoom := rules.MoveUp, -1
+	order := []int{0, 1, 2, 3}
+	rand.Shuffle(len(order), func(i, j int) {
+		order[i], order[j] = order[j], order[i]
+	})
+	for _, i := range order {
+		next, free := step(head, i)
+		if !free {
+			continue
+		}
+		room := 0
+		for j := range directions {
+			if _, free := step(next, j); free {
+				room++
+			}
+		}
+		if room > bestRoom {
+			bestMove, bestRoom = directions[i].move, room
+		}
+	}
+	return bestMove
+}
+
+func allSnakesAlive(boardState *rules.BoardState) bool {
+	for _, snake := range boardState.Snakes {
+		if snake.EliminatedCause != rules.NotEliminated {
+			return false
+		}
+	}
+	return true
+}
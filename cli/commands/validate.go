@@ -0,0 +1,325 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/client"
+	"github.com/BattlesnakeOfficial/rules/engine"
+	"github.com/spf13/cobra"
+	log "github.com/spf13/jwalterweatherman"
+)
+
+// The seed used to build the boards sent to the snake, so that every run sends the same requests.
+const validationSeed = 1
+
+// The number of turns played to build the board part way through a game.
+const validationTurns = 30
+
+var validationRulesets = []string{
+	rules.GameTypeStandard,
+	rules.GameTypeSolo,
+	rules.GameTypeRoyale,
+	rules.GameTypeConstrictor,
+	rules.GameTypeWrapped,
+	rules.GameTypeWrappedConstrictor,
+}
+
+var hexColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type SnakeValidator struct {
+	// Options
+	URL      string
+	Timeout  int
+	Width    int
+	Height   int
+	MapName  string
+	Rulesets []string
+	JSON     bool
+
+	// Internal state
+	httpClient engine.TimedHttpClient // optional, replaces the client with the request timeout
+}
+
+// The result of checking a snake's responses against the Battlesnake API.
+type ValidationReport struct {
+	URL    string            `json:"url"`
+	Passed bool              `json:"passed"`
+	Checks []ValidationCheck `json:"checks"`
+}
+
+// The result of a single request to the snake.
+type ValidationCheck struct {
+	Ruleset       string `json:"ruleset,omitempty"` // empty for the metadata request
+	Request       string `json:"request"`           // such as "POST /move (turn 0)"
+	Passed        bool   `json:"passed"`
+	LatencyMS     int64  `json:"latencyMs"`
+	ErrorCategory string `json:"errorCategory,omitempty"` // one of the engine.MoveError* categories
+	Error         string `json:"error,omitempty"`
+}
+
+func NewValidateCommand() *cobra.Command {
+	validator := &SnakeValidator{}
+
+	var validateCmd = &cobra.Command{
+		Use:   "validate <url>",
+		Short: "Check that a Battlesnake responds to every request correctly.",
+		Long: "Check that a Battlesnake responds to every request correctly, by sending its metadata request and " +
+			"/start, /move and /end requests for each ruleset. Exits with a non-zero status if any check fails.",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			validator.URL = args[0]
+			report, err := validator.Run()
+			if err != nil {
+				log.ERROR.Fatalf("Error validating snake: %v", err)
+			}
+			if err := validator.writeReport(cmd.OutOrStdout(), report); err != nil {
+				log.ERROR.Fatalf("Error writing report: %v", err)
+			}
+			if !report.Passed {
+				os.Exit(1)
+			}
+		},
+	}
+
+	validateCmd.Flags().IntVarP(&validator.Timeout, "timeout", "t", 500, "Request Timeout")
+	validateCmd.Flags().IntVarP(&validator.Width, "width", "W", 11, "Width of Board")
+	validateCmd.Flags().IntVarP(&validator.Height, "height", "H", 11, "Height of Board")
+	validateCmd.Flags().StringVarP(&validator.MapName, "map", "m", "standard", "Game map to use to populate the board")
+	validateCmd.Flags().StringSliceVarP(&validator.Rulesets, "gametype", "g", validationRulesets, "Types of Game Rules to send requests for")
+	validateCmd.Flags().BoolVar(&validator.JSON, "json", false, "Write the report as JSON")
+
+	validateCmd.Flags().SortFlags = false
+
+	return validateCmd
+}
+
+// Send every request to the snake and check the responses. The returned error is only for problems
+// building the requests, such as an unknown map, and not for problems with the snake.
+func (validator *SnakeValidator) Run() (ValidationReport, error) {
+	if validator.Timeout == 0 {
+		validator.Timeout = 500
+	}
+	if validator.httpClient == nil {
+		validator.httpClient = engine.NewTimedHTTPClient(time.Duration(validator.Timeout) * time.Millisecond)
+	}
+	for _, gameType := range validator.Rulesets {
+		if !isValidationRuleset(gameType) {
+			return ValidationReport{}, fmt.Errorf("Unknown game type %v, expected one of %v", gameType, strings.Join(validationRulesets, ", "))
+		}
+	}
+	snakeURL, err := url.ParseRequestURI(validator.URL)
+	if err != nil {
+		return ValidationReport{}, fmt.Errorf("URL %v is not valid: %w", validator.URL, err)
+	}
+
+	report := ValidationReport{URL: snakeURL.String(), Passed: true}
+	addCheck := func(check ValidationCheck) {
+		report.Passed = report.Passed && check.Passed
+		report.Checks = append(report.Checks, check)
+	}
+
+	check, metadata := validator.checkMetadata(snakeURL)
+	addCheck(check)
+
+	for _, gameType := range validator.Rulesets {
+		fixture, err := validator.buildFixture(gameType, metadata)
+		if err != nil {
+			return report, fmt.Errorf("Unable to build requests for %v: %w", gameType, err)
+		}
+
+		check, _ = validator.request(snakeURL, "start", fixture.start)
+		check.Ruleset, check.Request = gameType, "POST /start"
+		addCheck(check)
+		for _, request := range fixture.moves {
+			addCheck(validator.checkMove(snakeURL, gameType, request))
+		}
+		check, _ = validator.request(snakeURL, "end", fixture.end)
+		check.Ruleset, check.Request = gameType, "POST /end"
+		addCheck(check)
+	}
+	return report, nil
+}
+
+func (validator *SnakeValidator) checkMetadata(snakeURL *url.URL) (ValidationCheck, client.SnakeMetadataResponse) {
+	check := ValidationCheck{Request: "GET /"}
+	var metadata client.SnakeMetadataResponse
+
+	res, latency, err := validator.httpClient.Get(snakeURL.String())
+	body, ok := validator.checkResponse(&check, res, latency, err)
+	if !ok {
+		return check, metadata
+	}
+
+	if err := json.Unmarshal(body, &metadata); err != nil {
+		check.fail(engine.MoveErrorInvalidResponse, fmt.Sprintf("invalid JSON: %v", err))
+	} else if metadata.APIVersion != "1" {
+		check.fail(engine.MoveErrorInvalidResponse, fmt.Sprintf("apiversion is %q, expected \"1\"", metadata.APIVersion))
+	} else if metadata.Color != "" && !hexColorPattern.MatchString(metadata.Color) {
+		check.fail(engine.MoveErrorInvalidResponse, fmt.Sprintf("color %q isn't a hex color like \"#888888\"", metadata.Color))
+	}
+	return check, metadata
+}
+
+func (validator *SnakeValidator) checkMove(snakeURL *url.URL, gameType string, request client.SnakeRequest) ValidationCheck {
+	check, body := validator.request(snakeURL, "move", request)
+	check.Ruleset, check.Request = gameType, fmt.Sprintf("POST /move (turn %d)", request.Turn)
+	if !check.Passed {
+		return check
+	}
+
+	var moveResponse client.MoveResponse
+	if err := json.Unmarshal(body, &moveResponse); err != nil {
+		check.fail(engine.MoveErrorInvalidResponse, fmt.Sprintf("invalid JSON: %v", err))
+		return check
+	}
+	switch moveResponse.Move {
+	case rules.MoveUp, rules.MoveDown, rules.MoveLeft, rules.MoveRight:
+	default:
+		check.fail(engine.MoveErrorInvalidMove, fmt.Sprintf("move %q isn't one of \"up\", \"down\", \"left\" or \"right\"", moveResponse.Move))
+	}
+	return check
+}
+
+// Send a request to one of the snake's endpoints, returning the response body if it was successful.
+func (validator *SnakeValidator) request(snakeURL *url.URL, endpoint string, request client.SnakeRequest) (ValidationCheck, []byte) {
+	check := ValidationCheck{}
+	requestBody, err := json.Marshal(request)
+	if err != nil {
+		// This is likely to be a programming error like a unsupported type or cyclical reference
+		log.ERROR.Panicf("Error marshalling JSON from request: %v", err)
+	}
+
+	u := *snakeURL
+	u.Path = path.Join(u.Path, endpoint)
+	res, latency, err := validator.httpClient.Post(u.String(), "application/json", bytes.NewBuffer(requestBody))
+	body, _ := validator.checkResponse(&check, res, latency, err)
+	return check, body
+}
+
+// Check that a request succeeded within the timeout, returning the response body.
+func (validator *SnakeValidator) checkResponse(check *ValidationCheck, res *http.Response, latency time.Duration, err error) ([]byte, bool) {
+	check.Passed = true
+	check.LatencyMS = latency.Milliseconds()
+	if err != nil {
+		// Categorised in the same way as the engine does for move requests
+		check.fail(engine.SnakeState{Error: err}.ErrorCategory(), err.Error())
+		return nil, false
+	}
+
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		check.fail(engine.MoveErrorConnection, err.Error())
+		return nil, false
+	}
+	if res.StatusCode != http.StatusOK {
+		check.fail(engine.MoveErrorBadStatus, fmt.Sprintf("status code %d, expected %d", res.StatusCode, http.StatusOK))
+		return nil, false
+	}
+	if latency > time.Duration(validator.Timeout)*time.Millisecond {
+		check.fail(engine.MoveErrorTimeout, fmt.Sprintf("took %dms, longer than the %dms timeout", check.LatencyMS, validator.Timeout))
+		return nil, false
+	}
+	return body, true
+}
+
+func (check *ValidationCheck) fail(errorCategory string, message string) {
+	check.Passed = false
+	check.ErrorCategory = errorCategory
+	check.Error = message
+}
+
+func (validator *SnakeValidator) writeReport(w io.Writer, report ValidationReport) error {
+	if validator.JSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	passed := 0
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, check := range report.Checks {
+		status := "FAIL"
+		if check.Passed {
+			status = "PASS"
+			passed++
+		}
+		ruleset := check.Ruleset
+		if ruleset == "" {
+			ruleset = "-"
+		}
+		message := ""
+		if !check.Passed {
+			message = fmt.Sprintf("%s: %s", check.ErrorCategory, check.Error)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%dms\t%s\n", status, ruleset, check.Request, check.LatencyMS, message)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d of %d checks passed for %s\n", passed, len(report.Checks), report.URL)
+	return err
+}
+
+// The requests sent to the snake for a ruleset.
+type validationFixture struct {
+	start client.SnakeRequest
+	moves []client.SnakeRequest // at the start of the game and part way through
+	end   client.SnakeRequest
+}
+
+// Build the requests for a ruleset from the first turns of a simulated game, with the snake
+// being validated against an opponent, other than in solo games.
+func (validator *SnakeValidator) buildFixture(gameType string, metadata client.SnakeMetadataResponse) (validationFixture, error) {
+	snakeStates := map[string]engine.SnakeState{
+		"you": {ID: "you", Name: "You", Color: metadata.Color, Head: metadata.Head, Tail: metadata.Tail},
+	}
+	snakeIDs := []string{"you"}
+	if gameType != rules.GameTypeSolo {
+		snakeStates["opponent"] = engine.SnakeState{ID: "opponent", Name: "Opponent"}
+		snakeIDs = append(snakeIDs, "opponent")
+	}
+
+	simulated, err := simulateGame(gameType, validator.MapName, validator.Width, validator.Height, snakeIDs, validationTurns, validationSeed)
+	if err != nil {
+		return validationFixture{}, err
+	}
+	game := simulated.clientGame("validate-"+gameType, validator.Timeout)
+	game.Source = "validate"
+	snakeRequest := func(boardState *rules.BoardState) client.SnakeRequest {
+		return engine.NewSnakeRequest(game, boardState, snakeStates, snakeStates["you"])
+	}
+
+	first, last := simulated.boards[0], simulated.boards[len(simulated.boards)-1]
+	fixture := validationFixture{
+		start: snakeRequest(first),
+		moves: []client.SnakeRequest{snakeRequest(first)},
+		end:   snakeRequest(last),
+	}
+	if last.Turn > 0 {
+		fixture.moves = append(fixture.moves, snakeRequest(last))
+	}
+	return fixture, nil
+}
+
+func isValidationRuleset(gameType string) bool {
+	for _, ruleset := range validationRulesets {
+		if ruleset == gameType {
+			return true
+		}
+	}
+	return false
+}
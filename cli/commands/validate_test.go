@@ -0,0 +1,188 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/client"
+	"github.com/BattlesnakeOfficial/rules/engine"
+	"github.com/stretchr/testify/require"
+)
+
+func buildDefaultValidator(url string) *SnakeValidator {
+	return &SnakeValidator{
+		URL:      url,
+		Timeout:  500,
+		Width:    11,
+		Height:   11,
+		MapName:  "standard",
+		Rulesets: validationRulesets,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var mu sync.Mutex
+	var moveRequests []client.SnakeRequest
+	snakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`{"apiversion": "1", "color": "#123456", "head": "safe"}`))
+		case "/move":
+			var request client.SnakeRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+			mu.Lock()
+			moveRequests = append(moveRequests, request)
+			mu.Unlock()
+			w.Write([]byte(`{"move": "up"}`))
+		}
+	}))
+	t.Cleanup(snakeServer.Close)
+
+	report, err := buildDefaultValidator(snakeServer.URL).Run()
+	require.NoError(t, err)
+	for _, check := range report.Checks {
+		require.Truef(t, check.Passed, "%#v", check)
+	}
+	require.True(t, report.Passed)
+	require.Equal(t, "GET /", report.Checks[0].Request)
+	require.Equal(t, ValidationCheck{Ruleset: "standard", Request: "POST /start", Passed: true, LatencyMS: report.Checks[1].LatencyMS}, report.Checks[1])
+	require.Len(t, report.Checks, 1+4*len(validationRulesets), "start, two moves and end for each ruleset")
+
+	// Every ruleset is sent a board at the start of the game and part way through
+	require.Len(t, moveRequests, 2*len(validationRulesets))
+	for i, gameType := range validationRulesets {
+		start, later := moveRequests[2*i], moveRequests[2*i+1]
+		require.Equal(t, gameType, start.Game.Ruleset.Name)
+		require.Equal(t, 0, start.Turn)
+		require.Greater(t, later.Turn, 0)
+		require.Equal(t, "you", later.You.ID)
+		require.Equal(t, "#123456", later.You.Customizations.Color)
+		if gameType == rules.GameTypeSolo {
+			require.Len(t, later.Board.Snakes, 1)
+		} else {
+			require.Len(t, later.Board.Snakes, 2)
+		}
+	}
+}
+
+func TestValidateFailures(t *testing.T) {
+	snakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request client.SnakeRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		switch {
+		case r.URL.Path == "/":
+			w.Write([]byte(`{"apiversion": "2"}`))
+		case r.URL.Path == "/start":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/move" && request.Turn == 0:
+			w.Write([]byte(`{"move": "north"}`))
+		case r.URL.Path == "/move":
+			w.Write([]byte(`up`))
+		}
+	}))
+	t.Cleanup(snakeServer.Close)
+
+	validator := buildDefaultValidator(snakeServer.URL)
+	validator.Rulesets = []string{rules.GameTypeStandard}
+	report, err := validator.Run()
+	require.NoError(t, err)
+	require.False(t, report.Passed)
+
+	require.Len(t, report.Checks, 5)
+	expected := []struct {
+		passed        bool
+		errorCategory string
+		err           string
+	}{
+		{false, engine.MoveErrorInvalidResponse, `apiversion is "2", expected "1"`},
+		{false, engine.MoveErrorBadStatus, "status code 404, expected 200"},
+		{false, engine.MoveErrorInvalidMove, `move "north" isn't one of "up", "down", "left" or "right"`},
+		{false, engine.MoveErrorInvalidResponse, "invalid JSON: invalid character 'u' looking for beginning of value"},
+		{true, "", ""},
+	}
+	for i, check := range report.Checks {
+		require.Equal(t, expected[i].passed, check.Passed, check.Request)
+		require.Equal(t, expected[i].errorCategory, check.ErrorCategory, check.Request)
+		require.Equal(t, expected[i].err, check.Error, check.Request)
+	}
+}
+
+func TestValidateTimeouts(t *testing.T) {
+	validator := buildDefaultValidator("http://example.com")
+	validator.Rulesets = []string{rules.GameTypeSolo}
+	validator.httpClient = stubHTTPClient{nil, http.StatusOK, func(url string) string {
+		if url == "http://example.com" {
+			return `{"apiversion": "1"}`
+		}
+		return `{"move": "up"}`
+	}, 600 * time.Millisecond}
+
+	report, err := validator.Run()
+	require.NoError(t, err)
+	require.False(t, report.Passed)
+	for _, check := range report.Checks {
+		require.Equal(t, engine.MoveErrorTimeout, check.ErrorCategory)
+		require.Equal(t, "took 600ms, longer than the 500ms timeout", check.Error)
+	}
+
+	validator.httpClient = stubHTTPClient{errors.New("connection refused"), 0, nil, 0}
+	report, err = validator.Run()
+	require.NoError(t, err)
+	for _, check := range report.Checks {
+		require.Equal(t, engine.MoveErrorConnection, check.ErrorCategory)
+	}
+}
+
+func TestValidateInvalidOptions(t *testing.T) {
+	validator := buildDefaultValidator("http://example.com")
+	validator.Rulesets = []string{"unknown"}
+	_, err := validator.Run()
+	require.ErrorContains(t, err, "Unknown game type unknown")
+
+	validator = buildDefaultValidator("example.com")
+	_, err = validator.Run()
+	require.ErrorContains(t, err, "URL example.com is not valid")
+}
+
+func TestWriteValidationReport(t *testing.T) {
+	report := ValidationReport{
+		URL:    "http://example.com",
+		Passed: false,
+		Checks: []ValidationCheck{
+			{Request: "GET /", Passed: true, LatencyMS: 12},
+			{Ruleset: "standard", Request: "POST /move (turn 0)", LatencyMS: 600, ErrorCategory: engine.MoveErrorTimeout, Error: "took 600ms, longer than the 500ms timeout"},
+		},
+	}
+
+	output := new(bytes.Buffer)
+	require.NoError(t, (&SnakeValidator{}).writeReport(output, report))
+	require.Equal(t, strings.Join([]string{
+		"PASS  -         GET /                12ms   ",
+		"FAIL  standard  POST /move (turn 0)  600ms  timeout: took 600ms, longer than the 500ms timeout",
+		"",
+		"1 of 2 checks passed for http://example.com",
+		"",
+	}, "\n"), output.String())
+
+	output.Reset()
+	require.NoError(t, (&SnakeValidator{JSON: true}).writeReport(output, report))
+	data, err := ioutil.ReadAll(output)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"url": "http://example.com",
+		"passed": false,
+		"checks": [
+			{"request": "GET /", "passed": true, "latencyMs": 12},
+			{"ruleset": "standard", "request": "POST /move (turn 0)", "passed": false, "latencyMs": 600, "errorCategory": "timeout", "error": "took 600ms, longer than the 500ms timeout"}
+		]
+	}`, string(data))
+}
@@ -0,0 +1,362 @@
+// Package engine runs games of Battlesnake, sending requests to each snake over HTTP.
+// It doesn't print the game or serve it to the board: callers follow the game through observer callbacks,
+// and get a structured result once it has ended.
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/client"
+	"github.com/BattlesnakeOfficial/rules/maps"
+	"github.com/google/uuid"
+)
+
+// Config describes a game to run. Zero values for the game ID, snake IDs, seed and timeout are filled in.
+type Config struct {
+	GameID       string
+	Snakes       []SnakeConfig
+	Width        int
+	Height       int
+	GameType     string
+	MapName      string
+	Seed         int64
+	Settings     map[string]string // ruleset settings, keyed by the rules.Param* names
+	Timeout      int               // move request timeout in milliseconds
+	TurnDuration int               // minimum turn duration in milliseconds
+	Sequential   bool              // request moves from one snake at a time
+
+	HTTPClient TimedHttpClient // optional, used instead of a client with the request timeout
+	Ruleset    rules.Ruleset   // optional, used instead of the ruleset built from the game type and settings
+}
+
+type SnakeConfig struct {
+	ID   string
+	Name string
+	URL  string
+}
+
+// Observers are called from the goroutine running the game, and any of them can be nil.
+type Observers struct {
+	// Called with the board at the start of the game, and after every turn. The snake states are a copy.
+	OnTurn func(boardState *rules.BoardState, snakeStates map[string]SnakeState)
+	// Called with the result of every move request, before the moves are applied.
+	OnSnakeResponse func(snakeState SnakeState)
+	// Called once the end requests have been sent, with the same result that Run returns.
+	OnGameEnd func(result Result)
+}
+
+// Result is the outcome of a game that was run to the end or cancelled.
+type Result struct {
+	GameID     string
+	Turn       int // the turn the game ended on
+	Cancelled  bool
+	IsDraw     bool
+	WinnerID   string // empty if the game was a draw or was cancelled, or no snake survived
+	WinnerName string
+	Snakes     []SnakeResult // in the order they were configured
+	BoardState *rules.BoardState
+}
+
+type SnakeResult struct {
+	ID               string
+	Name             string
+	URL              string
+	EliminatedCause  string // empty if the snake wasn't eliminated
+	EliminatedOnTurn int
+	EliminatedBy     string
+	Placement        int // 1 for the snake that lasted longest, shared by snakes eliminated on the same turn
+}
+
+// GameRunner runs a single game. It can only be run once.
+type GameRunner struct {
+	config      Config
+	observers   Observers
+	ruleset     rules.Ruleset
+	settings    rules.Settings // the ruleset settings with the game's random source, used by the map
+	gameMap     maps.GameMap
+	httpClient  TimedHttpClient
+	snakeStates map[string]SnakeState
+}
+
+// Create a runner for a game, checking that the map exists and building the ruleset.
+// No requests are sent to the snakes until the game is run.
+func NewGameRunner(config Config, observers Observers) (*GameRunner, error) {
+	if config.GameID == "" {
+		config.GameID = uuid.New().String()
+	}
+	if config.Seed == 0 {
+		config.Seed = time.Now().UTC().UnixNano()
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 500
+	}
+	config.Snakes = append([]SnakeConfig(nil), config.Snakes...)
+	for i := range config.Snakes {
+		if config.Snakes[i].ID == "" {
+			config.Snakes[i].ID = uuid.New().String()
+		}
+	}
+
+	gameMap, err := maps.GetMap(config.MapName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load game map %#v: %v", config.MapName, err)
+	}
+
+	// Each game has its own random source, so that games run at the same time can't change each other's results
+	rand := rules.NewSeedRand(config.Seed)
+	ruleset := config.Ruleset
+	if ruleset == nil {
+		ruleset = rules.NewRulesetBuilder().
+			WithSeed(config.Seed).
+			WithRand(rand).
+			WithParams(config.Settings).
+			WithSolo(len(config.Snakes) < 2).
+			NamedRuleset(config.GameType)
+	}
+
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = NewTimedHTTPClient(time.Duration(config.Timeout) * time.Millisecond)
+	}
+
+	return &GameRunner{
+		config:      config,
+		observers:   observers,
+		ruleset:     ruleset,
+		settings:    ruleset.Settings().WithRand(rand),
+		gameMap:     gameMap,
+		httpClient:  httpClient,
+		snakeStates: map[string]SnakeState{},
+	}, nil
+}
+
+func (runner *GameRunner) GameID() string {
+	return runner.config.GameID
+}
+
+// Run the game until it ends, or until the context is cancelled, in which case the result is marked as cancelled.
+// The end requests are sent to every snake either way.
+func (runner *GameRunner) Run(ctx context.Context) (Result, error) {
+	var err error
+	runner.snakeStates, err = runner.fetchSnakes()
+	if err != nil {
+		return Result{}, fmt.Errorf("Error getting snake metadata: %w", err)
+	}
+
+	gameOver, boardState, err := runner.setupBoard()
+	if err != nil {
+		return Result{}, fmt.Errorf("Error initializing board: %w", err)
+	}
+	runner.turnPlayed(boardState)
+
+	var endTime time.Time
+	cancelled := false
+	for !gameOver {
+		if ctx.Err() != nil {
+			cancelled = true
+			break
+		}
+
+		if runner.config.TurnDuration > 0 {
+			endTime = time.Now().Add(time.Duration(runner.config.TurnDuration) * time.Millisecond)
+		}
+
+		gameOver, boardState, err = runner.nextBoardState(boardState)
+		if err != nil {
+			return Result{}, fmt.Errorf("Error processing game: %w", err)
+		}
+
+		if gameOver {
+			// Stop processing here - because game over is detected at the start of the pipeline, nothing will have changed.
+			break
+		}
+
+		if runner.config.TurnDuration > 0 {
+			time.Sleep(time.Until(endTime))
+		}
+
+		runner.turnPlayed(boardState)
+	}
+
+	for _, snake := range boardState.Snakes {
+		runner.sendEndRequest(boardState, runner.snakeStates[snake.ID])
+	}
+
+	result := runner.result(boardState, cancelled)
+	if runner.observers.OnGameEnd != nil {
+		runner.observers.OnGameEnd(result)
+	}
+	return result, nil
+}
+
+func (runner *GameRunner) turnPlayed(boardState *rules.BoardState) {
+	if runner.observers.OnTurn == nil {
+		return
+	}
+	snakeStates := make(map[string]SnakeState, len(runner.snakeStates))
+	for id, snakeState := range runner.snakeStates {
+		snakeStates[id] = snakeState
+	}
+	runner.observers.OnTurn(boardState, snakeStates)
+}
+
+func (runner *GameRunner) result(boardState *rules.BoardState, cancelled bool) Result {
+	result := Result{
+		GameID:     runner.config.GameID,
+		Turn:       boardState.Turn,
+		Cancelled:  cancelled,
+		BoardState: boardState,
+		// A draw is possible if there is more than one snake in the game.
+		IsDraw: len(runner.snakeStates) > 1 && !cancelled,
+	}
+
+	for _, snake := range boardState.Snakes {
+		if snake.EliminatedCause == rules.NotEliminated && !cancelled {
+			result.IsDraw = false
+			result.WinnerID = snake.ID
+			result.WinnerName = runner.snakeStates[snake.ID].Name
+		}
+	}
+
+	for _, snakeConfig := range runner.config.Snakes {
+		snakeResult := SnakeResult{
+			ID:   snakeConfig.ID,
+			Name: snakeConfig.Name,
+			URL:  snakeConfig.URL,
+		}
+		for _, snake := range boardState.Snakes {
+			if snake.ID == snakeConfig.ID {
+				snakeResult.EliminatedCause = snake.EliminatedCause
+				snakeResult.EliminatedOnTurn = snake.EliminatedOnTurn
+				snakeResult.EliminatedBy = snake.EliminatedBy
+			}
+		}
+		result.Snakes = append(result.Snakes, snakeResult)
+	}
+
+	// Snakes that were never eliminated outlast every snake that was
+	survivedUntil := func(snake SnakeResult) int {
+		if snake.EliminatedCause == rules.NotEliminated {
+			return math.MaxInt
+		}
+		return snake.EliminatedOnTurn
+	}
+	for i := range result.Snakes {
+		result.Snakes[i].Placement = 1
+		for _, other := range result.Snakes {
+			if survivedUntil(other) > survivedUntil(result.Snakes[i]) {
+				result.Snakes[i].Placement++
+			}
+		}
+	}
+	return result
+}
+
+func (runner *GameRunner) setupBoard() (bool, *rules.BoardState, error) {
+	// Snakes are placed in the configured order, so that games with the same seed are set up the same way
+	snakeIds := []string{}
+	for _, snakeConfig := range runner.config.Snakes {
+		snakeIds = append(snakeIds, snakeConfig.ID)
+	}
+	boardState, err := maps.SetupBoard(runner.gameMap.ID(), runner.settings, runner.config.Width, runner.config.Height, snakeIds)
+	if err != nil {
+		return false, nil, fmt.Errorf("Error initializing BoardState with map: %w", err)
+	}
+	gameOver, boardState, err := runner.ruleset.Execute(boardState, nil)
+	if err != nil {
+		return false, nil, fmt.Errorf("Error initializing BoardState with ruleset: %w", err)
+	}
+
+	for _, snakeState := range runner.snakeStates {
+		runner.sendStartRequest(boardState, snakeState)
+	}
+	return gameOver, boardState, nil
+}
+
+func (runner *GameRunner) nextBoardState(boardState *rules.BoardState) (bool, *rules.BoardState, error) {
+	// apply PreUpdateBoard before making requests to snakes
+	boardState, err := maps.PreUpdateBoard(runner.gameMap, boardState, runner.settings)
+	if err != nil {
+		return false, boardState, fmt.Errorf("Error pre-updating board with game map: %w", err)
+	}
+
+	// get moves from snakes
+	stateUpdates := make(chan SnakeState, len(runner.snakeStates))
+	if runner.config.Sequential {
+		for _, snakeState := range runner.snakeStates {
+			for _, snake := range boardState.Snakes {
+				if snakeState.ID == snake.ID && snake.EliminatedCause == rules.NotEliminated {
+					nextSnakeState := runner.getSnakeUpdate(boardState, snakeState)
+					stateUpdates <- nextSnakeState
+				}
+			}
+		}
+		close(stateUpdates)
+	} else {
+		var wg sync.WaitGroup
+
+		for _, snakeState := range runner.snakeStates {
+			for _, snake := range boardState.Snakes {
+				if snakeState.ID == snake.ID && snake.EliminatedCause == rules.NotEliminated {
+					wg.Add(1)
+					go func(snakeState SnakeState) {
+						defer wg.Done()
+						nextSnakeState := runner.getSnakeUpdate(boardState, snakeState)
+						stateUpdates <- nextSnakeState
+					}(snakeState)
+				}
+			}
+		}
+
+		wg.Wait()
+		close(stateUpdates)
+	}
+
+	var moves []rules.SnakeMove
+	for snakeState := range stateUpdates {
+		runner.snakeStates[snakeState.ID] = snakeState
+		if runner.observers.OnSnakeResponse != nil {
+			runner.observers.OnSnakeResponse(snakeState)
+		}
+		moves = append(moves, rules.SnakeMove{ID: snakeState.ID, Move: snakeState.LastMove})
+	}
+
+	gameOver, boardState, err := runner.ruleset.Execute(boardState, moves)
+	if err != nil {
+		return false, boardState, fmt.Errorf("Error updating board state from ruleset: %w", err)
+	}
+
+	// apply PostUpdateBoard after ruleset operates on snake moves
+	boardState, err = maps.PostUpdateBoard(runner.gameMap, boardState, runner.settings)
+	if err != nil {
+		return false, boardState, fmt.Errorf("Error post-updating board with game map: %w", err)
+	}
+
+	boardState.Turn += 1
+
+	return gameOver, boardState, nil
+}
+
+// The game as it is described in requests to the snakes.
+func (runner *GameRunner) ClientGame() client.Game {
+	return client.Game{
+		ID:      runner.config.GameID,
+		Timeout: runner.config.Timeout,
+		Ruleset: client.Ruleset{
+			Name:     runner.ruleset.Name(),
+			Version:  "cli", // TODO: Use GitHub Release Version
+			Settings: client.ConvertRulesetSettings(runner.ruleset.Settings()),
+		},
+		Map: runner.gameMap.ID(),
+	}
+}
+
+// The request that would be sent to a snake for the given board.
+func (runner *GameRunner) SnakeRequest(boardState *rules.BoardState, snakeID string) client.SnakeRequest {
+	return runner.getRequestBodyForSnake(boardState, runner.snakeStates[snakeID])
+}
@@ -0,0 +1,613 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/client"
+	"github.com/BattlesnakeOfficial/rules/test"
+	"github.com/stretchr/testify/require"
+)
+
+func defaultTestConfig() Config {
+	return Config{
+		GameID:   "GAME_ID",
+		Width:    11,
+		Height:   11,
+		GameType: "standard",
+		MapName:  "standard",
+		Seed:     1,
+		Timeout:  500,
+		Settings: map[string]string{
+			rules.ParamFoodSpawnChance:     "15",
+			rules.ParamMinimumFood:         "1",
+			rules.ParamHazardDamagePerTurn: "14",
+			rules.ParamShrinkEveryNTurns:   "25",
+		},
+	}
+}
+
+func newTestRunner(t *testing.T, config Config) *GameRunner {
+	runner, err := NewGameRunner(config, Observers{})
+	require.NoError(t, err)
+	return runner
+}
+
+func TestGetIndividualBoardStateForSnake(t *testing.T) {
+	s1 := rules.Snake{ID: "one", Body: []rules.Point{{X: 3, Y: 3}}}
+	s2 := rules.Snake{ID: "two", Body: []rules.Point{{X: 4, Y: 3}}}
+	state := rules.NewBoardState(11, 11).
+		WithSnakes(
+			[]rules.Snake{s1, s2},
+		)
+	s1State := SnakeState{
+		ID:    "one",
+		Name:  "ONE",
+		URL:   "http://example1.com",
+		Head:  "safe",
+		Tail:  "curled",
+		Color: "#123456",
+	}
+	s2State := SnakeState{
+		ID:    "two",
+		Name:  "TWO",
+		URL:   "http://example2.com",
+		Head:  "silly",
+		Tail:  "bolt",
+		Color: "#654321",
+	}
+
+	runner := newTestRunner(t, defaultTestConfig())
+	runner.snakeStates = map[string]SnakeState{
+		s1State.ID: s1State,
+		s2State.ID: s2State,
+	}
+
+	snakeRequest := runner.getRequestBodyForSnake(state, s1State)
+	requestBody := serialiseSnakeRequest(snakeRequest)
+
+	test.RequireJSONMatchesFixture(t, "testdata/snake_request_body.json", string(requestBody))
+}
+
+func TestSettingsRequestSerialization(t *testing.T) {
+	s1 := rules.Snake{ID: "one", Body: []rules.Point{{X: 3, Y: 3}}}
+	s2 := rules.Snake{ID: "two", Body: []rules.Point{{X: 4, Y: 3}}}
+	state := rules.NewBoardState(11, 11).
+		WithSnakes([]rules.Snake{s1, s2})
+	s1State := SnakeState{
+		ID:    "one",
+		Name:  "ONE",
+		URL:   "http://example1.com",
+		Head:  "safe",
+		Tail:  "curled",
+		Color: "#123456",
+	}
+	s2State := SnakeState{
+		ID:    "two",
+		Name:  "TWO",
+		URL:   "http://example2.com",
+		Head:  "silly",
+		Tail:  "bolt",
+		Color: "#654321",
+	}
+
+	for _, gt := range []string{
+		rules.GameTypeStandard, rules.GameTypeRoyale, rules.GameTypeSolo,
+		rules.GameTypeWrapped, rules.GameTypeConstrictor,
+	} {
+		t.Run(gt, func(t *testing.T) {
+			config := defaultTestConfig()
+			config.Settings = map[string]string{
+				rules.ParamFoodSpawnChance:     "11",
+				rules.ParamMinimumFood:         "7",
+				rules.ParamHazardDamagePerTurn: "19",
+				rules.ParamShrinkEveryNTurns:   "17",
+			}
+			config.GameType = gt
+
+			runner := newTestRunner(t, config)
+			runner.snakeStates = map[string]SnakeState{s1State.ID: s1State, s2State.ID: s2State}
+
+			snakeRequest := runner.getRequestBodyForSnake(state, s1State)
+			requestBody := serialiseSnakeRequest(snakeRequest)
+			t.Log(string(requestBody))
+
+			test.RequireJSONMatchesFixture(t, fmt.Sprintf("testdata/snake_request_body_%s.json", gt), string(requestBody))
+		})
+	}
+}
+
+func TestConvertRulesSnakes(t *testing.T) {
+	tests := []struct {
+		name     string
+		snakes   []rules.Snake
+		state    map[string]SnakeState
+		expected []client.Snake
+	}{
+		{
+			name:     "empty",
+			snakes:   []rules.Snake{},
+			state:    map[string]SnakeState{},
+			expected: []client.Snake{},
+		},
+		{
+			name: "all properties",
+			snakes: []rules.Snake{
+				{ID: "one", Body: []rules.Point{{X: 3, Y: 3}, {X: 2, Y: 3}}, Health: 100},
+			},
+			state: map[string]SnakeState{
+				"one": {
+					ID:       "one",
+					Name:     "ONE",
+					URL:      "http://example1.com",
+					Head:     "a",
+					Tail:     "b",
+					Color:    "#012345",
+					LastMove: "up",
+					Latency:  time.Millisecond * 42,
+				},
+			},
+			expected: []client.Snake{
+				{
+					ID:      "one",
+					Name:    "ONE",
+					Latency: "42",
+					Health:  100,
+					Body:    []client.Coord{{X: 3, Y: 3}, {X: 2, Y: 3}},
+					Head:    client.Coord{X: 3, Y: 3},
+					Length:  2,
+					Shout:   "",
+					Customizations: client.Customizations{
+						Color: "#012345",
+						Head:  "a",
+						Tail:  "b",
+					},
+				},
+			},
+		},
+		{
+			name: "some eliminated",
+			snakes: []rules.Snake{
+				{
+					ID:               "one",
+					EliminatedCause:  rules.EliminatedByCollision,
+					EliminatedOnTurn: 1,
+					Body:             []rules.Point{{X: 3, Y: 3}},
+				},
+				{ID: "two", Body: []rules.Point{{X: 4, Y: 3}}},
+			},
+			state: map[string]SnakeState{
+				"one": {ID: "one"},
+				"two": {ID: "two"},
+			},
+			expected: []client.Snake{
+				{
+					ID:      "two",
+					Latency: "0",
+					Body:    []client.Coord{{X: 4, Y: 3}},
+					Head:    client.Coord{X: 4, Y: 3},
+					Length:  1,
+				},
+			},
+		},
+		{
+			name: "all eliminated",
+			snakes: []rules.Snake{
+				{
+					ID:               "one",
+					EliminatedCause:  rules.EliminatedByCollision,
+					EliminatedOnTurn: 1,
+					Body:             []rules.Point{{X: 3, Y: 3}},
+				},
+			},
+			state: map[string]SnakeState{
+				"one": {ID: "one"},
+			},
+			expected: []client.Snake{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := convertRulesSnakes(test.snakes, test.state)
+			require.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestGetMoveForSnake(t *testing.T) {
+	s1 := rules.Snake{ID: "one", Body: []rules.Point{{X: 3, Y: 3}}}
+	s2 := rules.Snake{ID: "two", Body: []rules.Point{{X: 4, Y: 3}}}
+	boardState := rules.NewBoardState(11, 11).WithSnakes([]rules.Snake{s1, s2})
+
+	tests := []struct {
+		name            string
+		boardState      *rules.BoardState
+		snakeState      SnakeState
+		responseErr     error
+		responseCode    int
+		responseBody    string
+		responseLatency time.Duration
+
+		expectedSnakeState    SnakeState
+		expectedErrorCategory string
+	}{
+		{
+			name:       "invalid URL",
+			boardState: boardState,
+			snakeState: SnakeState{
+				ID:       "one",
+				URL:      "",
+				LastMove: rules.MoveLeft,
+			},
+			expectedSnakeState: SnakeState{
+				ID:       "one",
+				URL:      "",
+				LastMove: rules.MoveLeft,
+				Error:    errors.New(`parse "": empty url`),
+			},
+			expectedErrorCategory: MoveErrorConnection,
+		},
+		{
+			name:       "error response",
+			boardState: boardState,
+			snakeState: SnakeState{
+				ID:       "one",
+				URL:      "http://example.com",
+				LastMove: rules.MoveLeft,
+			},
+			responseErr: errors.New("connection error"),
+			expectedSnakeState: SnakeState{
+				ID:       "one",
+				URL:      "http://example.com",
+				LastMove: rules.MoveLeft,
+				Error:    errors.New("connection error"),
+			},
+			expectedErrorCategory: MoveErrorConnection,
+		},
+		{
+			name:       "timeout",
+			boardState: boardState,
+			snakeState: SnakeState{
+				ID:       "one",
+				URL:      "http://example.com",
+				LastMove: rules.MoveLeft,
+			},
+			responseErr:     &url.Error{Op: "Post", URL: "http://example.com/move", Err: context.DeadlineExceeded},
+			responseLatency: 500 * time.Millisecond,
+			expectedSnakeState: SnakeState{
+				ID:       "one",
+				URL:      "http://example.com",
+				LastMove: rules.MoveLeft,
+				Latency:  500 * time.Millisecond,
+				Error:    &url.Error{Op: "Post", URL: "http://example.com/move", Err: context.DeadlineExceeded},
+			},
+			expectedErrorCategory: MoveErrorTimeout,
+		},
+		{
+			name:       "bad response body",
+			boardState: boardState,
+			snakeState: SnakeState{
+				ID:       "one",
+				URL:      "http://example.com",
+				LastMove: rules.MoveLeft,
+			},
+			responseCode:    200,
+			responseBody:    `right`,
+			responseLatency: 54 * time.Millisecond,
+			expectedSnakeState: SnakeState{
+				ID:           "one",
+				URL:          "http://example.com",
+				LastMove:     rules.MoveLeft,
+				Error:        errors.New("invalid character 'r' looking for beginning of value"),
+				StatusCode:   200,
+				Latency:      54 * time.Millisecond,
+				ResponseBody: `right`,
+			},
+			expectedErrorCategory: MoveErrorInvalidResponse,
+		},
+		{
+			name:       "bad move value",
+			boardState: boardState,
+			snakeState: SnakeState{
+				ID:       "one",
+				URL:      "http://example.com",
+				LastMove: rules.MoveLeft,
+			},
+			responseCode:    200,
+			responseBody:    `{"move": "north"}`,
+			responseLatency: 54 * time.Millisecond,
+			expectedSnakeState: SnakeState{
+				ID:           "one",
+				URL:          "http://example.com",
+				LastMove:     rules.MoveLeft,
+				StatusCode:   200,
+				Latency:      54 * time.Millisecond,
+				InvalidMove:  true,
+				ResponseBody: `{"move": "north"}`,
+				RejectedMove: "north",
+			},
+			expectedErrorCategory: MoveErrorInvalidMove,
+		},
+		{
+			name:       "bad status code",
+			boardState: boardState,
+			snakeState: SnakeState{
+				ID:       "one",
+				URL:      "http://example.com",
+				LastMove: rules.MoveLeft,
+			},
+			responseCode:    500,
+			responseBody:    `Internal Server Error`,
+			responseLatency: 54 * time.Millisecond,
+			expectedSnakeState: SnakeState{
+				ID:           "one",
+				URL:          "http://example.com",
+				LastMove:     rules.MoveLeft,
+				StatusCode:   500,
+				Latency:      54 * time.Millisecond,
+				ResponseBody: `Internal Server Error`,
+			},
+			expectedErrorCategory: MoveErrorBadStatus,
+		},
+		{
+			name:       "successful move",
+			boardState: boardState,
+			snakeState: SnakeState{
+				ID:  "one",
+				URL: "http://example.com",
+			},
+			responseCode:    200,
+			responseBody:    `{"move": "right"}`,
+			responseLatency: 54 * time.Millisecond,
+			expectedSnakeState: SnakeState{
+				ID:         "one",
+				URL:        "http://example.com",
+				LastMove:   rules.MoveRight,
+				StatusCode: 200,
+				Latency:    54 * time.Millisecond,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := defaultTestConfig()
+			config.HTTPClient = stubHTTPClient{test.responseErr, test.responseCode, func(_ string) string { return test.responseBody }, test.responseLatency}
+			runner := newTestRunner(t, config)
+			runner.snakeStates = map[string]SnakeState{test.snakeState.ID: test.snakeState}
+
+			nextSnakeState := runner.getSnakeUpdate(test.boardState, test.snakeState)
+			require.Equal(t, test.expectedErrorCategory, nextSnakeState.ErrorCategory())
+			if test.expectedSnakeState.Error != nil {
+				require.EqualError(t, nextSnakeState.Error, test.expectedSnakeState.Error.Error())
+			} else {
+				require.NoError(t, nextSnakeState.Error)
+			}
+			nextSnakeState.Error = test.expectedSnakeState.Error
+			require.Equal(t, test.expectedSnakeState, nextSnakeState)
+		})
+	}
+}
+
+func TestNextBoardState(t *testing.T) {
+	s1 := rules.Snake{ID: "one", Body: []rules.Point{{X: 3, Y: 3}}}
+	boardState := rules.NewBoardState(11, 11).WithSnakes([]rules.Snake{s1})
+	snakeState := SnakeState{
+		ID:  s1.ID,
+		URL: "http://example.com",
+	}
+
+	for _, sequential := range []bool{false, true} {
+		t.Run(fmt.Sprintf("sequential_%v", sequential), func(t *testing.T) {
+			config := defaultTestConfig()
+			config.Sequential = sequential
+			config.HTTPClient = stubHTTPClient{nil, 200, func(_ string) string { return `{"move": "right"}` }, 54 * time.Millisecond}
+			var observed []SnakeState
+			runner, err := NewGameRunner(config, Observers{
+				OnSnakeResponse: func(snakeState SnakeState) { observed = append(observed, snakeState) },
+			})
+			require.NoError(t, err)
+			runner.snakeStates = map[string]SnakeState{s1.ID: snakeState}
+
+			gameOver, nextBoardState, err := runner.nextBoardState(boardState)
+			require.NoError(t, err)
+			require.False(t, gameOver)
+			snakeState = runner.snakeStates[s1.ID]
+			require.Equal(t, []SnakeState{snakeState}, observed)
+
+			require.NotNil(t, nextBoardState)
+			require.Equal(t, nextBoardState.Turn, 1)
+			require.Equal(t, nextBoardState.Snakes[0].Body[0], rules.Point{X: 4, Y: 3})
+			require.Equal(t, snakeState.LastMove, rules.MoveRight)
+			require.Equal(t, snakeState.StatusCode, 200)
+			require.Equal(t, snakeState.Latency, 54*time.Millisecond)
+		})
+	}
+}
+
+func TestGameRunnerRun(t *testing.T) {
+	config := defaultTestConfig()
+	config.Snakes = []SnakeConfig{
+		{ID: "one", Name: "One", URL: "http://one.example.com"},
+		{ID: "two", Name: "Two", URL: "http://two.example.com"},
+	}
+	var endRequests []string
+	config.HTTPClient = stubHTTPClient{nil, http.StatusOK, func(url string) string {
+		if strings.HasSuffix(url, "/end") {
+			endRequests = append(endRequests, url)
+		}
+		return `{"move": "up", "color": "#123456"}`
+	}, time.Millisecond}
+	config.Ruleset = stubRuleset{maxTurns: 2, winner: "two"}
+
+	var turns []int
+	var responses int
+	var ended *Result
+	runner, err := NewGameRunner(config, Observers{
+		OnTurn: func(boardState *rules.BoardState, snakeStates map[string]SnakeState) {
+			turns = append(turns, boardState.Turn)
+			require.Len(t, snakeStates, 2)
+			require.Equal(t, "#123456", snakeStates["one"].Color)
+		},
+		OnSnakeResponse: func(snakeState SnakeState) {
+			responses++
+			require.Equal(t, "up", snakeState.LastMove)
+		},
+		OnGameEnd: func(result Result) {
+			ended = &result
+		},
+	})
+	require.NoError(t, err)
+
+	result, err := runner.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1, 2}, turns)
+	require.Equal(t, 6, responses)
+	require.ElementsMatch(t, []string{"http://one.example.com/end", "http://two.example.com/end"}, endRequests)
+
+	require.Equal(t, &result, ended)
+	require.Equal(t, "GAME_ID", result.GameID)
+	require.Equal(t, 3, result.Turn)
+	require.False(t, result.Cancelled)
+	require.False(t, result.IsDraw)
+	require.Equal(t, "two", result.WinnerID)
+	require.Equal(t, "Two", result.WinnerName)
+	require.Equal(t, []SnakeResult{
+		{ID: "one", Name: "One", URL: "http://one.example.com", EliminatedCause: rules.EliminatedByOutOfBounds, EliminatedOnTurn: 2, Placement: 2},
+		{ID: "two", Name: "Two", URL: "http://two.example.com", Placement: 1},
+	}, result.Snakes)
+}
+
+func TestGameRunnerSeed(t *testing.T) {
+	runGame := func(seed int64) []*rules.BoardState {
+		config := defaultTestConfig()
+		config.Seed = seed
+		config.Snakes = []SnakeConfig{
+			{ID: "one", Name: "One", URL: "http://one.example.com"},
+			{ID: "two", Name: "Two", URL: "http://two.example.com"},
+		}
+		config.HTTPClient = stubHTTPClient{nil, http.StatusOK, func(url string) string { return `{"move": "up"}` }, time.Millisecond}
+		var boards []*rules.BoardState
+		runner, err := NewGameRunner(config, Observers{
+			OnTurn: func(boardState *rules.BoardState, snakeStates map[string]SnakeState) {
+				boards = append(boards, boardState.Clone())
+			},
+		})
+		require.NoError(t, err)
+		_, err = runner.Run(context.Background())
+		require.NoError(t, err)
+		return boards
+	}
+	expected := runGame(1)
+
+	// Games run at the same time don't affect each other's random events
+	results := make(chan []*rules.BoardState, 8)
+	for i := 0; i < cap(results); i++ {
+		go func(seed int64) {
+			results <- runGame(seed)
+		}(int64(1 + i%2))
+	}
+	matching := 0
+	for i := 0; i < cap(results); i++ {
+		if boards := <-results; reflect.DeepEqual(expected, boards) {
+			matching++
+		}
+	}
+	require.Equal(t, cap(results)/2, matching)
+}
+
+func TestGameRunnerRunCancelled(t *testing.T) {
+	config := defaultTestConfig()
+	config.Snakes = []SnakeConfig{
+		{Name: "One", URL: "http://one.example.com"},
+		{Name: "Two", URL: "http://two.example.com"},
+	}
+	config.HTTPClient = stubHTTPClient{nil, http.StatusOK, func(url string) string { return `{"move": "up"}` }, time.Millisecond}
+	config.Ruleset = stubRuleset{maxTurns: 100}
+	runner := newTestRunner(t, config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := runner.Run(ctx)
+	require.NoError(t, err)
+	require.True(t, result.Cancelled)
+	require.False(t, result.IsDraw)
+	require.Empty(t, result.WinnerID)
+	require.Equal(t, 0, result.Turn)
+	require.Len(t, result.Snakes, 2)
+	require.NotEmpty(t, result.Snakes[0].ID, "snake IDs are generated")
+	require.Equal(t, 1, result.Snakes[0].Placement)
+	require.Equal(t, 1, result.Snakes[1].Placement)
+}
+
+func TestGameRunnerMetadataError(t *testing.T) {
+	config := defaultTestConfig()
+	config.Snakes = []SnakeConfig{{Name: "One", URL: "http://one.example.com"}}
+	config.HTTPClient = stubHTTPClient{errors.New("connection refused"), 0, nil, 0}
+	runner := newTestRunner(t, config)
+
+	_, err := runner.Run(context.Background())
+	require.EqualError(t, err, "Error getting snake metadata: Snake metadata request to http://one.example.com failed: connection refused")
+}
+
+// Ends the game once the board reaches maxTurns, eliminating every snake except the winner.
+type stubRuleset struct {
+	maxTurns int
+	winner   string
+}
+
+func (ruleset stubRuleset) Name() string             { return "standard" }
+func (ruleset stubRuleset) Settings() rules.Settings { return rules.NewSettings(nil) }
+func (ruleset stubRuleset) Execute(prevState *rules.BoardState, moves []rules.SnakeMove) (bool, *rules.BoardState, error) {
+	if prevState.Turn < ruleset.maxTurns {
+		return false, prevState, nil
+	}
+	nextState := prevState.Clone()
+	for i := range nextState.Snakes {
+		if nextState.Snakes[i].ID != ruleset.winner {
+			nextState.Snakes[i].EliminatedCause = rules.EliminatedByOutOfBounds
+			nextState.Snakes[i].EliminatedOnTurn = prevState.Turn
+		}
+	}
+	return true, nextState, nil
+}
+
+type stubHTTPClient struct {
+	err        error
+	statusCode int
+	body       func(url string) string
+	latency    time.Duration
+}
+
+func (client stubHTTPClient) request(url string) (*http.Response, time.Duration, error) {
+	if client.err != nil {
+		return nil, client.latency, client.err
+	}
+	body := ioutil.NopCloser(bytes.NewBufferString(client.body(url)))
+
+	response := &http.Response{
+		Header:     make(http.Header),
+		Body:       body,
+		StatusCode: client.statusCode,
+	}
+
+	return response, client.latency, nil
+}
+
+func (client stubHTTPClient) Get(url string) (*http.Response, time.Duration, error) {
+	return client.request(url)
+}
+
+func (client stubHTTPClient) Post(url string, contentType string, body io.Reader) (*http.Response, time.Duration, error) {
+	return client.request(url)
+}
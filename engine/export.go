@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/BattlesnakeOfficial/rules/client"
+)
+
+// GameExporter writes a game to an output file, with the game on the first line, the request for each turn
+// on the lines that follow, and the result on the last line.
+type GameExporter struct {
+	game          client.Game
+	snakeRequests []client.SnakeRequest
+	winner        SnakeState
+	isDraw        bool
+}
+
+// ExportResult is the last line of an output file.
+type ExportResult struct {
+	WinnerID   string `json:"winnerId"`
+	WinnerName string `json:"winnerName"`
+	IsDraw     bool   `json:"isDraw"`
+}
+
+func NewGameExporter(game client.Game) *GameExporter {
+	return &GameExporter{
+		game:          game,
+		snakeRequests: make([]client.SnakeRequest, 0),
+	}
+}
+
+func (ge *GameExporter) FlushToFile(outputFile io.Writer) (int, error) {
+	formattedOutput, err := ge.ConvertToJSON()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range formattedOutput {
+		_, err := io.WriteString(outputFile, fmt.Sprintf("%s\n", line))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(formattedOutput), nil
+}
+
+func (ge *GameExporter) ConvertToJSON() ([]string, error) {
+	output := make([]string, 0)
+	serialisedGame, err := json.Marshal(ge.game)
+	if err != nil {
+		return output, err
+	}
+	output = append(output, string(serialisedGame))
+	for _, board := range ge.snakeRequests {
+		serialisedBoard, err := json.Marshal(board)
+		if err != nil {
+			return output, err
+		}
+		output = append(output, string(serialisedBoard))
+	}
+	serialisedResult, err := json.Marshal(ExportResult{
+		WinnerID:   ge.winner.ID,
+		WinnerName: ge.winner.Name,
+		IsDraw:     ge.isDraw,
+	})
+	if err != nil {
+		return output, err
+	}
+	output = append(output, string(serialisedResult))
+	return output, nil
+}
+
+func (ge *GameExporter) AddSnakeRequest(snakeRequest client.SnakeRequest) {
+	ge.snakeRequests = append(ge.snakeRequests, snakeRequest)
+}
+
+// Record the outcome of the game, once it has ended.
+func (ge *GameExporter) SetResult(result Result) {
+	ge.isDraw = result.IsDraw
+	ge.winner = SnakeState{}
+	if result.WinnerID != "" {
+		ge.winner = SnakeState{ID: result.WinnerID, Name: result.WinnerName}
+	}
+}
+
+// Build an exporter for a game from the events published while it was played, such as the events
+// stored by the board server. The output matches the output file written by the CLI, except that the
+// `you` key always holds the first snake. Games that haven't ended, or were cancelled, have no winner.
+func NewGameExporterFromEvents(game board.Game, events []board.GameEvent) *GameExporter {
+	clientGame := client.Game{
+		ID:      game.ID,
+		Timeout: game.SnakeTimeout,
+		Ruleset: client.Ruleset{
+			Name:     game.RulesetName,
+			Version:  "cli", // TODO: Use GitHub Release Version
+			Settings: client.ConvertRulesetSettings(rules.NewSettings(game.Ruleset)),
+		},
+		Map: game.Map,
+	}
+	ge := NewGameExporter(clientGame)
+
+	var lastFrame board.GameFrame
+	ended := false
+	for _, event := range events {
+		switch data := event.Data.(type) {
+		case board.GameFrame:
+			lastFrame = data
+			if len(data.Snakes) > 0 {
+				ge.AddSnakeRequest(client.SnakeRequest{
+					Game:  clientGame,
+					Turn:  data.Turn,
+					Board: convertFrameToBoard(game, data),
+					You:   convertBoardSnake(data.Snakes[0], data.Turn),
+				})
+			}
+		case board.Game:
+			ended = event.EventType == board.EVENT_TYPE_GAME_END
+			game.Status = data.Status
+		}
+	}
+
+	if !ended || game.Status == board.GameStatusCancelled {
+		return ge
+	}
+
+	// A draw is possible if there is more than one snake in the game.
+	ge.isDraw = len(lastFrame.Snakes) > 1
+	for _, snake := range lastFrame.Snakes {
+		if snake.Death == nil {
+			ge.isDraw = false
+			ge.winner = SnakeState{ID: snake.ID, Name: snake.Name}
+		}
+	}
+	return ge
+}
+
+func convertFrameToBoard(game board.Game, frame board.GameFrame) client.Board {
+	snakes := make([]client.Snake, 0)
+	for _, snake := range frame.Snakes {
+		if snake.Death == nil {
+			snakes = append(snakes, convertBoardSnake(snake, frame.Turn))
+		}
+	}
+	return client.Board{
+		Height:  game.Height,
+		Width:   game.Width,
+		Food:    client.CoordFromPointArray(frame.Food),
+		Hazards: client.CoordFromPointArray(frame.Hazards),
+		Snakes:  snakes,
+	}
+}
+
+func convertBoardSnake(snake board.Snake, turn int) client.Snake {
+	converted := client.Snake{
+		ID:      snake.ID,
+		Name:    snake.Name,
+		Health:  snake.Health,
+		Body:    client.CoordFromPointArray(snake.Body),
+		Latency: snake.Latency,
+		Length:  len(snake.Body),
+		Shout:   snake.Shout,
+		Squad:   snake.Squad,
+		Customizations: client.Customizations{
+			Head:  snake.HeadType,
+			Tail:  snake.TailType,
+			Color: snake.Color,
+		},
+	}
+	// Frames round latency up to 1ms for the board, but no moves have been requested on turn zero
+	if turn == 0 {
+		converted.Latency = "0"
+	}
+	if len(snake.Body) > 0 {
+		converted.Head = client.CoordFromPoint(snake.Body[0])
+	}
+	return converted
+}
@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportFromEvents(t *testing.T) {
+	config := defaultTestConfig()
+	config.Snakes = []SnakeConfig{
+		{ID: "one", Name: "One", URL: "http://one.example.com"},
+		{ID: "two", Name: "Two", URL: "http://two.example.com"},
+	}
+	config.HTTPClient = stubHTTPClient{nil, http.StatusOK, func(url string) string {
+		return `{"apiversion": "1", "move": "up", "color": "#123456", "head": "safe", "tail": "curled"}`
+	}, time.Millisecond * 42}
+	config.Ruleset = stubRuleset{maxTurns: 2, winner: "two"}
+
+	// Export the game directly, as the play command does, while recording the events sent to the board
+	var runner *GameRunner
+	var exporter *GameExporter
+	var events []board.GameEvent
+	runner, err := NewGameRunner(config, Observers{
+		OnTurn: func(boardState *rules.BoardState, snakeStates map[string]SnakeState) {
+			exporter.AddSnakeRequest(runner.SnakeRequest(boardState, "one"))
+			events = append(events, NewFrameEvent(boardState, snakeStates))
+		},
+	})
+	require.NoError(t, err)
+	exporter = NewGameExporter(runner.ClientGame())
+
+	result, err := runner.Run(context.Background())
+	require.NoError(t, err)
+	exporter.SetResult(result)
+	game := board.Game{
+		ID:           "GAME_ID",
+		Status:       board.GameStatusComplete,
+		Width:        11,
+		Height:       11,
+		Ruleset:      map[string]string{},
+		SnakeTimeout: 500,
+		RulesetName:  "standard",
+		Map:          "standard",
+	}
+	events = append(events, board.GameEvent{EventType: board.EVENT_TYPE_GAME_END, Data: game})
+
+	// The export built from the events matches the direct export
+	expected, err := exporter.ConvertToJSON()
+	require.NoError(t, err)
+	lines, err := NewGameExporterFromEvents(game, events).ConvertToJSON()
+	require.NoError(t, err)
+	require.Equal(t, expected, lines)
+	require.Len(t, lines, 5)
+	require.JSONEq(t, `{"winnerId": "two", "winnerName": "Two", "isDraw": false}`, lines[4])
+
+	// Games in progress have no result yet
+	lines, err = NewGameExporterFromEvents(game, events[:2]).ConvertToJSON()
+	require.NoError(t, err)
+	require.Len(t, lines, 4)
+	require.JSONEq(t, `{"winnerId": "", "winnerName": "", "isDraw": false}`, lines[3])
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/board"
+)
+
+// Build the frame event sent to the board for a turn, using the snake states as of that turn.
+func NewFrameEvent(boardState *rules.BoardState, snakeStates map[string]SnakeState) board.GameEvent {
+	snakes := []board.Snake{}
+
+	for _, snake := range boardState.Snakes {
+		snakeState := snakeStates[snake.ID]
+
+		latencyMS := snakeState.Latency.Milliseconds()
+		// round up latency of 0 to 1, to avoid legacy error display in board
+		if latencyMS == 0 {
+			latencyMS = 1
+		}
+		convertedSnake := board.Snake{
+			ID:            snake.ID,
+			Name:          snakeState.Name,
+			Body:          snake.Body,
+			Health:        snake.Health,
+			Color:         snakeState.Color,
+			HeadType:      snakeState.Head,
+			TailType:      snakeState.Tail,
+			Author:        snakeState.Author,
+			StatusCode:    snakeState.StatusCode,
+			IsBot:         false,
+			IsEnvironment: false,
+			Latency:       fmt.Sprint(latencyMS),
+		}
+		if snakeState.Error != nil {
+			// Instead of trying to keep in sync with the production engine's
+			// error detection and messages, just show a generic error and rely
+			// on the CLI logs to show what really happened.
+			convertedSnake.Error = "0:Error communicating with server"
+		} else if snakeState.StatusCode != http.StatusOK {
+			convertedSnake.Error = fmt.Sprintf("7:Bad HTTP status code %d", snakeState.StatusCode)
+		}
+		if snake.EliminatedCause != rules.NotEliminated {
+			convertedSnake.Death = &board.Death{
+				Cause:        snake.EliminatedCause,
+				Turn:         snake.EliminatedOnTurn,
+				EliminatedBy: snake.EliminatedBy,
+			}
+		}
+		snakes = append(snakes, convertedSnake)
+	}
+
+	gameFrame := board.GameFrame{
+		Turn:    boardState.Turn,
+		Snakes:  snakes,
+		Food:    boardState.Food,
+		Hazards: boardState.Hazards,
+	}
+
+	return board.GameEvent{
+		EventType: board.EVENT_TYPE_FRAME,
+		Data:      gameFrame,
+	}
+}
@@ -1,4 +1,4 @@
-package commands
+package engine
 
 import (
 	"io"
@@ -11,6 +11,11 @@ type TimedHttpClient interface {
 	Post(url string, contentType string, body io.Reader) (*http.Response, time.Duration, error)
 }
 
+// Create an HTTP client that measures the time taken by each request, giving up on requests after the timeout.
+func NewTimedHTTPClient(timeout time.Duration) TimedHttpClient {
+	return timedHTTPClient{&http.Client{Timeout: timeout}}
+}
+
 type timedHTTPClient struct {
 	*http.Client
 }
@@ -0,0 +1,273 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/client"
+	log "github.com/spf13/jwalterweatherman"
+)
+
+// The state of a snake in a running game, including the result of its last move request.
+type SnakeState struct {
+	URL         string
+	Name        string
+	ID          string
+	LastMove    string
+	Color       string
+	Head        string
+	Tail        string
+	Author      string
+	Version     string
+	Error       error
+	StatusCode  int
+	Latency     time.Duration
+	InvalidMove bool // whether the last response was a move other than up, down, left or right
+
+	// Details of the last move request, for diagnosing failures
+	Turn         int    // the turn the move was requested for
+	ResponseBody string // the raw response body, only kept when the response was rejected
+	RejectedMove string // the move given in the last response, when it wasn't a valid move
+}
+
+// Categories of move request failures, as returned by SnakeState.ErrorCategory.
+const (
+	MoveErrorTimeout         = "timeout"
+	MoveErrorConnection      = "connection_error"
+	MoveErrorBadStatus       = "bad_status"
+	MoveErrorInvalidResponse = "invalid_response"
+	MoveErrorInvalidMove     = "invalid_move"
+)
+
+// The category of the last move request's failure, or "" if the snake responded with a valid move.
+func (snakeState SnakeState) ErrorCategory() string {
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(snakeState.Error, &netErr) && netErr.Timeout():
+		return MoveErrorTimeout
+	case errors.As(snakeState.Error, &syntaxErr) || errors.As(snakeState.Error, &typeErr):
+		return MoveErrorInvalidResponse
+	case snakeState.Error != nil:
+		return MoveErrorConnection
+	case snakeState.StatusCode != 0 && snakeState.StatusCode != http.StatusOK:
+		return MoveErrorBadStatus
+	case snakeState.InvalidMove:
+		return MoveErrorInvalidMove
+	}
+	return ""
+}
+
+// Get the metadata for every snake, which fails if any snake can't be reached.
+func (runner *GameRunner) fetchSnakes() (map[string]SnakeState, error) {
+	snakes := map[string]SnakeState{}
+	for _, snakeConfig := range runner.config.Snakes {
+		u, err := url.ParseRequestURI(snakeConfig.URL)
+		if err != nil {
+			return nil, fmt.Errorf("URL %v is not valid: %w", snakeConfig.URL, err)
+		}
+		snakeURL := u.String()
+
+		snakeState := SnakeState{
+			Name: snakeConfig.Name, URL: snakeURL, ID: snakeConfig.ID, LastMove: "up",
+		}
+		res, _, err := runner.httpClient.Get(snakeURL)
+		if err != nil {
+			return nil, fmt.Errorf("Snake metadata request to %v failed: %w", snakeURL, err)
+		}
+
+		snakeState.StatusCode = res.StatusCode
+
+		if res.Body == nil {
+			return nil, fmt.Errorf("Empty response body from snake metadata URL: %v", snakeURL)
+		}
+
+		defer res.Body.Close()
+		body, readErr := ioutil.ReadAll(res.Body)
+		if readErr != nil {
+			return nil, fmt.Errorf("Error reading from snake metadata URL %v: %w", snakeURL, readErr)
+		}
+
+		pingResponse := client.SnakeMetadataResponse{}
+		jsonErr := json.Unmarshal(body, &pingResponse)
+		if jsonErr != nil {
+			return nil, fmt.Errorf("Failed to parse response from %v: %w", snakeURL, jsonErr)
+		}
+
+		snakeState.Head = pingResponse.Head
+		snakeState.Tail = pingResponse.Tail
+		snakeState.Color = pingResponse.Color
+		snakeState.Author = pingResponse.Author
+		snakeState.Version = pingResponse.Version
+
+		snakes[snakeState.ID] = snakeState
+	}
+	return snakes, nil
+}
+
+// Request a move from a snake, keeping its last move if the request fails.
+// The result of the request is recorded in the returned state, rather than logged.
+func (runner *GameRunner) getSnakeUpdate(boardState *rules.BoardState, snakeState SnakeState) SnakeState {
+	snakeState.StatusCode = 0
+	snakeState.Error = nil
+	snakeState.Latency = 0
+	snakeState.InvalidMove = false
+	snakeState.Turn = boardState.Turn
+	snakeState.ResponseBody = ""
+	snakeState.RejectedMove = ""
+
+	snakeRequest := runner.getRequestBodyForSnake(boardState, snakeState)
+	requestBody := serialiseSnakeRequest(snakeRequest)
+
+	u, err := url.ParseRequestURI(snakeState.URL)
+	if err != nil {
+		snakeState.Error = err
+		return snakeState
+	}
+	u.Path = path.Join(u.Path, "move")
+	log.DEBUG.Printf("POST %s: %v", u, string(requestBody))
+	res, responseTime, err := runner.httpClient.Post(u.String(), "application/json", bytes.NewBuffer(requestBody))
+
+	snakeState.Latency = responseTime
+
+	if err != nil {
+		snakeState.Error = err
+		return snakeState
+	}
+
+	snakeState.StatusCode = res.StatusCode
+
+	if res.Body == nil {
+		return snakeState
+	}
+	defer res.Body.Close()
+	body, readErr := ioutil.ReadAll(res.Body)
+	if readErr != nil {
+		snakeState.Error = readErr
+		return snakeState
+	}
+	if res.StatusCode != http.StatusOK {
+		snakeState.ResponseBody = string(body)
+		return snakeState
+	}
+
+	playerResponse := client.MoveResponse{}
+	jsonErr := json.Unmarshal(body, &playerResponse)
+	if jsonErr != nil {
+		snakeState.Error = jsonErr
+		snakeState.ResponseBody = string(body)
+		return snakeState
+	}
+	if playerResponse.Move != "up" && playerResponse.Move != "down" && playerResponse.Move != "left" && playerResponse.Move != "right" {
+		snakeState.InvalidMove = true
+		snakeState.RejectedMove = playerResponse.Move
+		snakeState.ResponseBody = string(body)
+		return snakeState
+	}
+
+	snakeState.LastMove = playerResponse.Move
+
+	return snakeState
+}
+
+func (runner *GameRunner) sendStartRequest(boardState *rules.BoardState, snakeState SnakeState) {
+	runner.sendNotification(boardState, snakeState, "start")
+}
+
+func (runner *GameRunner) sendEndRequest(boardState *rules.BoardState, snakeState SnakeState) {
+	runner.sendNotification(boardState, snakeState, "end")
+}
+
+// Send a request where the response doesn't matter, such as /start or /end.
+func (runner *GameRunner) sendNotification(boardState *rules.BoardState, snakeState SnakeState, endpoint string) {
+	snakeRequest := runner.getRequestBodyForSnake(boardState, snakeState)
+	requestBody := serialiseSnakeRequest(snakeRequest)
+	u, _ := url.ParseRequestURI(snakeState.URL)
+	u.Path = path.Join(u.Path, endpoint)
+	log.DEBUG.Printf("POST %s: %v", u, string(requestBody))
+	_, _, err := runner.httpClient.Post(u.String(), "application/json", bytes.NewBuffer(requestBody))
+	if err != nil {
+		log.WARN.Printf("Request to %v failed", u.String())
+	}
+}
+
+func (runner *GameRunner) getRequestBodyForSnake(boardState *rules.BoardState, snakeState SnakeState) client.SnakeRequest {
+	return NewSnakeRequest(runner.ClientGame(), boardState, runner.snakeStates, snakeState)
+}
+
+// Build the request sent to a snake for a board, such as to test a snake outside of a running game.
+// The snake states give the names and customizations of the snakes on the board.
+func NewSnakeRequest(game client.Game, boardState *rules.BoardState, snakeStates map[string]SnakeState, you SnakeState) client.SnakeRequest {
+	var youSnake rules.Snake
+	for _, snk := range boardState.Snakes {
+		if you.ID == snk.ID {
+			youSnake = snk
+			break
+		}
+	}
+	request := client.SnakeRequest{
+		Game:  game,
+		Turn:  boardState.Turn,
+		Board: convertStateToBoard(boardState, snakeStates),
+		You:   convertRulesSnake(youSnake, you),
+	}
+	return request
+}
+
+func serialiseSnakeRequest(snakeRequest client.SnakeRequest) []byte {
+	requestJSON, err := json.Marshal(snakeRequest)
+	if err != nil {
+		// This is likely to be a programming error like a unsupported type or cyclical reference
+		log.ERROR.Panicf("Error marshalling JSON from State: %v", err)
+	}
+	return requestJSON
+}
+
+func convertRulesSnake(snake rules.Snake, snakeState SnakeState) client.Snake {
+	latencyMS := snakeState.Latency.Milliseconds()
+	return client.Snake{
+		ID:      snake.ID,
+		Name:    snakeState.Name,
+		Health:  snake.Health,
+		Body:    client.CoordFromPointArray(snake.Body),
+		Latency: fmt.Sprint(latencyMS),
+		Head:    client.CoordFromPoint(snake.Body[0]),
+		Length:  int(len(snake.Body)),
+		Shout:   "",
+		Customizations: client.Customizations{
+			Head:  snakeState.Head,
+			Tail:  snakeState.Tail,
+			Color: snakeState.Color,
+		},
+	}
+}
+
+func convertRulesSnakes(snakes []rules.Snake, snakeStates map[string]SnakeState) []client.Snake {
+	a := make([]client.Snake, 0)
+	for _, snake := range snakes {
+		if snake.EliminatedCause == rules.NotEliminated {
+			a = append(a, convertRulesSnake(snake, snakeStates[snake.ID]))
+		}
+	}
+	return a
+}
+
+func convertStateToBoard(boardState *rules.BoardState, snakeStates map[string]SnakeState) client.Board {
+	return client.Board{
+		Height:  boardState.Height,
+		Width:   boardState.Width,
+		Food:    client.CoordFromPointArray(boardState.Food),
+		Hazards: client.CoordFromPointArray(boardState.Hazards),
+		Snakes:  convertRulesSnakes(boardState.Snakes, snakeStates),
+	}
+}
@@ -1,8 +1,6 @@
 package maps
 
 import (
-	"math/rand"
-
 	"github.com/BattlesnakeOfficial/rules"
 )
 
@@ -62,6 +60,7 @@ func (m HealingPoolsMap) PostUpdateBoard(lastBoardState *rules.BoardState, setti
 	shrinkEveryNTurns := settings.Int(rules.ParamShrinkEveryNTurns, 0)
 	if lastBoardState.Turn > 0 && shrinkEveryNTurns > 0 && len(lastBoardState.Hazards) > 0 && lastBoardState.Turn%shrinkEveryNTurns == 0 {
 		// Attempt to remove a healing pool every ShrinkEveryNTurns until there are none remaining
+		rand := settings.GetRand(lastBoardState.Turn)
 		i := rand.Intn(len(lastBoardState.Hazards))
 		editor.RemoveHazard(lastBoardState.Hazards[i])
 	}
@@ -0,0 +1,39 @@
+package ratings
+
+import (
+	"math"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+)
+
+const (
+	// The rating given to snakes before their first rated game.
+	InitialRating = 1500.0
+	// The most a rating can change by in a single game.
+	KFactor = 32.0
+)
+
+// Calculate new Elo ratings for a multiplayer game, by treating it as a match between every pair of snakes.
+// Each pair scores 1 for the better placed snake, 0.5 each for a tie, and the rating change is scaled
+// so that a game against several snakes counts the same as a game against one.
+func updateElo(placements []board.Placement, ratings []float64) []float64 {
+	updated := make([]float64, len(ratings))
+	opponents := float64(len(ratings) - 1)
+	for i := range placements {
+		var actual, expected float64
+		for j := range placements {
+			if i == j {
+				continue
+			}
+			expected += 1 / (1 + math.Pow(10, (ratings[j]-ratings[i])/400))
+			switch {
+			case placements[i].Placement < placements[j].Placement:
+				actual += 1
+			case placements[i].Placement == placements[j].Placement:
+				actual += 0.5
+			}
+		}
+		updated[i] = ratings[i] + KFactor*(actual-expected)/opponents
+	}
+	return updated
+}
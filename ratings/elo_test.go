@@ -0,0 +1,29 @@
+package ratings
+
+import (
+	"testing"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateElo(t *testing.T) {
+	// Evenly matched snakes move by half the K factor
+	ratings := updateElo([]board.Placement{{SnakeName: "a", Placement: 1}, {SnakeName: "b", Placement: 2}}, []float64{1500, 1500})
+	require.Equal(t, []float64{1516, 1484}, ratings)
+
+	// Ties between evenly matched snakes don't change anything
+	ratings = updateElo([]board.Placement{{SnakeName: "a", Placement: 1}, {SnakeName: "b", Placement: 1}}, []float64{1500, 1500})
+	require.Equal(t, []float64{1500, 1500}, ratings)
+
+	// Beating a stronger snake is worth more than beating a weaker one
+	ratings = updateElo([]board.Placement{{SnakeName: "a", Placement: 1}, {SnakeName: "b", Placement: 2}}, []float64{1400, 1600})
+	require.InDelta(t, 1424.3, ratings[0], 0.1)
+	require.InDelta(t, 1575.7, ratings[1], 0.1)
+
+	// Multiplayer games conserve the total rating
+	ratings = updateElo([]board.Placement{{SnakeName: "a", Placement: 1}, {SnakeName: "b", Placement: 2}, {SnakeName: "c", Placement: 2}, {SnakeName: "d", Placement: 4}}, []float64{1500, 1550, 1450, 1600})
+	require.InDelta(t, 6100, ratings[0]+ratings[1]+ratings[2]+ratings[3], 0.0001)
+	require.Greater(t, ratings[0], 1500.0)
+	require.Less(t, ratings[3], 1600.0)
+}
@@ -0,0 +1,240 @@
+package ratings
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+)
+
+var ErrSnakeNotRated = errors.New("snake has no rated games")
+
+// The record collection used to persist ratings. Each rated game is stored as a single record,
+// and the current ratings are rebuilt from them when the leaderboard is first used.
+const ratedGamesCollection = "rated_games"
+
+// The current rating for a snake, keyed by the snake name.
+type Rating struct {
+	Snake   string    `json:"snake"`
+	Rating  float64   `json:"rating"`
+	Games   int       `json:"games"`
+	Wins    int       `json:"wins"`
+	Updated time.Time `json:"updated"`
+}
+
+// A change to a snake's rating from a single game.
+type RatingChange struct {
+	GameID    string    `json:"gameId"`
+	Placement int       `json:"placement"`
+	Snakes    int       `json:"snakes"`
+	Before    float64   `json:"before"`
+	After     float64   `json:"after"`
+	Time      time.Time `json:"time"`
+}
+
+// Every rating change from a game, which is saved in one write so that a game is either fully rated or not at all.
+type ratedGame struct {
+	GameID  string                  `json:"gameId"`
+	Winner  string                  `json:"winner,omitempty"` // the snake that finished first on its own, if any
+	Changes map[string]RatingChange `json:"changes"`          // keyed by snake name
+	Time    time.Time               `json:"time"`
+}
+
+// Leaderboard keeps Elo ratings for snakes, updated from the result of each completed game.
+type Leaderboard struct {
+	store board.RecordStore
+
+	mu      sync.Mutex
+	loaded  bool
+	rated   map[string]bool // the IDs of the games that have been rated
+	ratings map[string]Rating
+	history map[string][]RatingChange // oldest first
+}
+
+func NewLeaderboard(store board.RecordStore) *Leaderboard {
+	return &Leaderboard{store: store}
+}
+
+// Update the ratings of the snakes in a game, using the placements from the last frame.
+// Only completed games between at least two differently named snakes are rated.
+// It can be registered with PersistentBoardServer.OnGameEnd, which provides the arguments.
+func (leaderboard *Leaderboard) RecordGame(summary board.GameSummary, events []board.GameEvent) error {
+	if summary.Game.Status != board.GameStatusComplete {
+		return nil
+	}
+	var lastFrame *board.GameFrame
+	for _, event := range events {
+		if frame, ok := event.Data.(board.GameFrame); ok {
+			lastFrame = &frame
+		}
+	}
+	if lastFrame == nil || len(lastFrame.Snakes) < 2 {
+		return nil
+	}
+	// Ratings are keyed by name, so games where a snake plays against itself can't be rated
+	names := map[string]bool{}
+	for _, snake := range lastFrame.Snakes {
+		if names[snake.Name] {
+			return nil
+		}
+		names[snake.Name] = true
+	}
+
+	leaderboard.mu.Lock()
+	defer leaderboard.mu.Unlock()
+
+	if err := leaderboard.loadLocked(); err != nil {
+		return err
+	}
+	if leaderboard.rated[summary.Game.ID] {
+		return nil
+	}
+
+	placements := board.Placements(*lastFrame)
+	before := make([]float64, len(placements))
+	for i, placement := range placements {
+		before[i] = InitialRating
+		if rating, ok := leaderboard.ratings[placement.SnakeName]; ok {
+			before[i] = rating.Rating
+		}
+	}
+
+	// Only a snake that finished first on its own has won
+	var winners []string
+	for _, placement := range placements {
+		if placement.Placement == 1 {
+			winners = append(winners, placement.SnakeName)
+		}
+	}
+
+	game := ratedGame{
+		GameID:  summary.Game.ID,
+		Changes: make(map[string]RatingChange, len(placements)),
+		Time:    time.Now(),
+	}
+	if len(winners) == 1 {
+		game.Winner = winners[0]
+	}
+	after := updateElo(placements, before)
+	for i, placement := range placements {
+		game.Changes[placement.SnakeName] = RatingChange{
+			GameID:    summary.Game.ID,
+			Placement: placement.Placement,
+			Snakes:    len(placements),
+			Before:    before[i],
+			After:     after[i],
+			Time:      game.Time,
+		}
+	}
+	if err := leaderboard.store.PutRecord(ratedGamesCollection, game.GameID, game); err != nil {
+		return fmt.Errorf("unable to save ratings for game %s: %w", game.GameID, err)
+	}
+	leaderboard.applyLocked(game)
+	return nil
+}
+
+// List the ratings of every rated snake, from highest to lowest.
+func (leaderboard *Leaderboard) Rankings() ([]Rating, error) {
+	leaderboard.mu.Lock()
+	defer leaderboard.mu.Unlock()
+
+	if err := leaderboard.loadLocked(); err != nil {
+		return nil, err
+	}
+	rankings := make([]Rating, 0, len(leaderboard.ratings))
+	for _, rating := range leaderboard.ratings {
+		rankings = append(rankings, rating)
+	}
+	sort.Slice(rankings, func(i, j int) bool {
+		if rankings[i].Rating != rankings[j].Rating {
+			return rankings[i].Rating > rankings[j].Rating
+		}
+		return rankings[i].Snake < rankings[j].Snake
+	})
+	return rankings, nil
+}
+
+// Get the current rating for a snake, or ErrSnakeNotRated if it hasn't played any rated games.
+func (leaderboard *Leaderboard) Rating(snake string) (Rating, error) {
+	leaderboard.mu.Lock()
+	defer leaderboard.mu.Unlock()
+
+	if err := leaderboard.loadLocked(); err != nil {
+		return Rating{}, err
+	}
+	rating, ok := leaderboard.ratings[snake]
+	if !ok {
+		return Rating{}, ErrSnakeNotRated
+	}
+	return rating, nil
+}
+
+// Get the rating changes for a snake, from oldest to newest.
+func (leaderboard *Leaderboard) History(snake string) ([]RatingChange, error) {
+	leaderboard.mu.Lock()
+	defer leaderboard.mu.Unlock()
+
+	if err := leaderboard.loadLocked(); err != nil {
+		return nil, err
+	}
+	history, ok := leaderboard.history[snake]
+	if !ok {
+		return nil, ErrSnakeNotRated
+	}
+	return append([]RatingChange(nil), history...), nil
+}
+
+// Rebuild the ratings from the stored games, the first time the leaderboard is used.
+// Must be called with the lock held.
+func (leaderboard *Leaderboard) loadLocked() error {
+	if leaderboard.loaded {
+		return nil
+	}
+	gameIDs, err := leaderboard.store.ListRecords(ratedGamesCollection)
+	if err != nil {
+		return fmt.Errorf("unable to list rated games: %w", err)
+	}
+	games := make([]ratedGame, 0, len(gameIDs))
+	for _, gameID := range gameIDs {
+		var game ratedGame
+		if err := leaderboard.store.GetRecord(ratedGamesCollection, gameID, &game); errors.Is(err, board.ErrRecordNotFound) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("unable to read ratings for game %s: %w", gameID, err)
+		}
+		games = append(games, game)
+	}
+	sort.SliceStable(games, func(i, j int) bool {
+		return games[i].Time.Before(games[j].Time)
+	})
+
+	leaderboard.rated = make(map[string]bool, len(games))
+	leaderboard.ratings = make(map[string]Rating)
+	leaderboard.history = make(map[string][]RatingChange)
+	for _, game := range games {
+		leaderboard.applyLocked(game)
+	}
+	leaderboard.loaded = true
+	return nil
+}
+
+// Update the ratings in memory with a game that has been saved.
+// Must be called with the lock held.
+func (leaderboard *Leaderboard) applyLocked(game ratedGame) {
+	leaderboard.rated[game.GameID] = true
+	for snake, change := range game.Changes {
+		rating := leaderboard.ratings[snake]
+		rating.Snake = snake
+		rating.Rating = change.After
+		rating.Games++
+		if snake == game.Winner {
+			rating.Wins++
+		}
+		rating.Updated = change.Time
+		leaderboard.ratings[snake] = rating
+		leaderboard.history[snake] = append(leaderboard.history[snake], change)
+	}
+}
@@ -0,0 +1,134 @@
+package ratings_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/BattlesnakeOfficial/rules/ratings"
+	"github.com/stretchr/testify/require"
+)
+
+func gameEvents(snakes ...board.Snake) []board.GameEvent {
+	return []board.GameEvent{
+		{EventType: board.EVENT_TYPE_FRAME, Data: board.GameFrame{Turn: 10, Snakes: snakes}},
+		{EventType: board.EVENT_TYPE_GAME_END, Data: board.Game{}},
+	}
+}
+
+func completedGame(id string) board.GameSummary {
+	return board.GameSummary{Game: board.Game{ID: id, Status: board.GameStatusComplete}}
+}
+
+func TestLeaderboard(t *testing.T) {
+	leaderboard := ratings.NewLeaderboard(board.NewMemoryGameStore())
+
+	rankings, err := leaderboard.Rankings()
+	require.NoError(t, err)
+	require.Empty(t, rankings)
+
+	require.NoError(t, leaderboard.RecordGame(completedGame("game1"), gameEvents(
+		board.Snake{Name: "winner"},
+		board.Snake{Name: "loser", Death: &board.Death{Turn: 10}},
+	)))
+	require.NoError(t, leaderboard.RecordGame(completedGame("game2"), gameEvents(
+		board.Snake{Name: "winner"},
+		board.Snake{Name: "third", Death: &board.Death{Turn: 3}},
+		board.Snake{Name: "loser", Death: &board.Death{Turn: 8}},
+	)))
+
+	rankings, err = leaderboard.Rankings()
+	require.NoError(t, err)
+	require.Len(t, rankings, 3)
+	require.Equal(t, []string{"winner", "loser", "third"}, []string{rankings[0].Snake, rankings[1].Snake, rankings[2].Snake})
+	require.Equal(t, 2, rankings[0].Games)
+	require.Equal(t, 2, rankings[0].Wins)
+	require.Equal(t, 2, rankings[1].Games)
+	require.Equal(t, 0, rankings[1].Wins)
+
+	history, err := leaderboard.History("loser")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, "game1", history[0].GameID)
+	require.Equal(t, ratings.InitialRating, history[0].Before)
+	require.Equal(t, 2, history[0].Placement)
+	require.Equal(t, "game2", history[1].GameID)
+	require.Equal(t, history[0].After, history[1].Before)
+	require.Equal(t, 2, history[1].Placement)
+	require.Equal(t, 3, history[1].Snakes)
+
+	rating, err := leaderboard.Rating("loser")
+	require.NoError(t, err)
+	require.Equal(t, history[1].After, rating.Rating)
+
+	_, err = leaderboard.Rating("missing")
+	require.ErrorIs(t, err, ratings.ErrSnakeNotRated)
+	_, err = leaderboard.History("missing")
+	require.ErrorIs(t, err, ratings.ErrSnakeNotRated)
+}
+
+func TestLeaderboardSkipsUnratedGames(t *testing.T) {
+	leaderboard := ratings.NewLeaderboard(board.NewMemoryGameStore())
+
+	cancelled := completedGame("cancelled")
+	cancelled.Game.Status = board.GameStatusCancelled
+	require.NoError(t, leaderboard.RecordGame(cancelled, gameEvents(board.Snake{Name: "one"}, board.Snake{Name: "two"})))
+	require.NoError(t, leaderboard.RecordGame(completedGame("solo"), gameEvents(board.Snake{Name: "one"})))
+	require.NoError(t, leaderboard.RecordGame(completedGame("self"), gameEvents(board.Snake{Name: "one"}, board.Snake{Name: "one"})))
+
+	rankings, err := leaderboard.Rankings()
+	require.NoError(t, err)
+	require.Empty(t, rankings)
+}
+
+// A store that can't save records, for checking that a failed write doesn't change any ratings.
+type failingRecordStore struct {
+	*board.MemoryGameStore
+	fail bool
+}
+
+func (store *failingRecordStore) PutRecord(collection string, key string, value interface{}) error {
+	if store.fail {
+		return errors.New("store is unavailable")
+	}
+	return store.MemoryGameStore.PutRecord(collection, key, value)
+}
+
+func TestLeaderboardStore(t *testing.T) {
+	store := &failingRecordStore{MemoryGameStore: board.NewMemoryGameStore()}
+	leaderboard := ratings.NewLeaderboard(store)
+	events := gameEvents(board.Snake{Name: "winner"}, board.Snake{Name: "loser", Death: &board.Death{Turn: 10}})
+	require.NoError(t, leaderboard.RecordGame(completedGame("game1"), events))
+
+	// Games that have already been rated are ignored
+	require.NoError(t, leaderboard.RecordGame(completedGame("game1"), events))
+	rating, err := leaderboard.Rating("winner")
+	require.NoError(t, err)
+	require.Equal(t, 1, rating.Games)
+
+	// When the game can't be saved, none of the ratings change
+	store.fail = true
+	require.Error(t, leaderboard.RecordGame(completedGame("game2"), events))
+	rankings, err := leaderboard.Rankings()
+	require.NoError(t, err)
+	for _, rating := range rankings {
+		require.Equal(t, 1, rating.Games)
+	}
+	store.fail = false
+
+	// The ratings are rebuilt from the store
+	require.NoError(t, leaderboard.RecordGame(completedGame("game3"), events))
+	reloaded, err := ratings.NewLeaderboard(store).Rankings()
+	require.NoError(t, err)
+	rankings, err = leaderboard.Rankings()
+	require.NoError(t, err)
+	require.Len(t, reloaded, len(rankings))
+	for i := range rankings {
+		require.True(t, rankings[i].Updated.Equal(reloaded[i].Updated))
+		reloaded[i].Updated = rankings[i].Updated
+	}
+	require.Equal(t, rankings, reloaded)
+	history, err := ratings.NewLeaderboard(store).History("loser")
+	require.NoError(t, err)
+	require.Equal(t, []string{"game1", "game3"}, []string{history[0].GameID, history[1].GameID})
+}
@@ -0,0 +1,341 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/google/uuid"
+)
+
+const (
+	apiKeysCollection = "api_keys"
+	apiKeyPrefix      = "bsk_"
+)
+
+var (
+	errInvalidAPIKey  = errors.New("invalid API key")
+	errAPIKeyNotFound = errors.New("API key not found")
+)
+
+// An API key, which callers send in the Authorization header as a bearer token.
+// Keys have the form bsk_<id>_<secret>, and only a hash of the secret is stored.
+type APIKey struct {
+	ID                 string    `json:"id"`
+	Name               string    `json:"name"`
+	Admin              bool      `json:"admin"`
+	RequestsPerMinute  int       `json:"requestsPerMinute"`  // 0 for no limit
+	MaxConcurrentGames int       `json:"maxConcurrentGames"` // running and queued games, 0 for no limit
+	Created            time.Time `json:"created"`
+}
+
+type storedAPIKey struct {
+	APIKey
+	SecretHash string `json:"secretHash"`
+}
+
+// The fields that can be set when creating an API key.
+type CreateAPIKeyRequest struct {
+	Name               string `json:"name"`
+	Admin              bool   `json:"admin"`
+	RequestsPerMinute  int    `json:"requestsPerMinute"`
+	MaxConcurrentGames int    `json:"maxConcurrentGames"`
+}
+
+func (req CreateAPIKeyRequest) Validate() error {
+	if strings.TrimSpace(req.Name) == "" {
+		return &ConfigError{Field: "name", Message: "a name is required"}
+	}
+	if req.RequestsPerMinute < 0 {
+		return &ConfigError{Field: "requestsPerMinute", Message: "must not be negative"}
+	}
+	if req.MaxConcurrentGames < 0 {
+		return &ConfigError{Field: "maxConcurrentGames", Message: "must not be negative"}
+	}
+	return nil
+}
+
+// Checks API keys, and enforces the rate limit and game quota for each key.
+// When keys aren't required, every request is allowed without one, as before keys were added.
+type apiKeyManager struct {
+	store      board.RecordStore
+	required   bool   // whether requests that change anything need a key
+	publicRead bool   // whether reading games stays public when keys are required
+	adminKey   string // a key with admin access that isn't stored, used to create the first keys
+
+	mu       sync.Mutex
+	limiters map[string]*rateLimiter
+	games    map[string]string // running and queued game ID to the ID of the key that started it
+}
+
+func newAPIKeyManager(store board.RecordStore, required bool, publicRead bool, adminKey string) *apiKeyManager {
+	return &apiKeyManager{
+		store:      store,
+		required:   required,
+		publicRead: publicRead,
+		adminKey:   adminKey,
+		limiters:   make(map[string]*rateLimiter),
+		games:      make(map[string]string),
+	}
+}
+
+// Create a key, returning it along with the secret key that callers use, which can't be retrieved later.
+func (manager *apiKeyManager) createKey(req CreateAPIKeyRequest) (APIKey, string, error) {
+	if err := req.Validate(); err != nil {
+		return APIKey{}, "", err
+	}
+
+	secretBytes := make([]byte, 24)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return APIKey{}, "", fmt.Errorf("unable to generate API key: %w", err)
+	}
+	secret := hex.EncodeToString(secretBytes)
+	key := storedAPIKey{
+		APIKey: APIKey{
+			ID:                 strings.ReplaceAll(uuid.New().String(), "-", ""),
+			Name:               strings.TrimSpace(req.Name),
+			Admin:              req.Admin,
+			RequestsPerMinute:  req.RequestsPerMinute,
+			MaxConcurrentGames: req.MaxConcurrentGames,
+			Created:            time.Now(),
+		},
+		SecretHash: hashSecret(secret),
+	}
+	if err := manager.store.PutRecord(apiKeysCollection, key.ID, key); err != nil {
+		return APIKey{}, "", err
+	}
+	return key.APIKey, apiKeyPrefix + key.ID + "_" + secret, nil
+}
+
+// List the stored keys, oldest first.
+func (manager *apiKeyManager) listKeys() ([]APIKey, error) {
+	keyIDs, err := manager.store.ListRecords(apiKeysCollection)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]APIKey, 0, len(keyIDs))
+	for _, keyID := range keyIDs {
+		var key storedAPIKey
+		if err := manager.store.GetRecord(apiKeysCollection, keyID, &key); errors.Is(err, board.ErrRecordNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key.APIKey)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Created.Before(keys[j].Created)
+	})
+	return keys, nil
+}
+
+func (manager *apiKeyManager) deleteKey(keyID string) error {
+	var key storedAPIKey
+	if err := manager.store.GetRecord(apiKeysCollection, keyID, &key); errors.Is(err, board.ErrRecordNotFound) {
+		return fmt.Errorf("%w: %s", errAPIKeyNotFound, keyID)
+	} else if err != nil {
+		return err
+	}
+	return manager.store.DeleteRecord(apiKeysCollection, keyID)
+}
+
+// Look up the key for a secret key sent by a caller.
+func (manager *apiKeyManager) authenticate(rawKey string) (APIKey, error) {
+	if manager.adminKey != "" && subtle.ConstantTimeCompare([]byte(rawKey), []byte(manager.adminKey)) == 1 {
+		return APIKey{ID: "admin", Name: "admin", Admin: true}, nil
+	}
+
+	keyID, secret, ok := strings.Cut(strings.TrimPrefix(rawKey, apiKeyPrefix), "_")
+	if !ok || !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return APIKey{}, errInvalidAPIKey
+	}
+	var key storedAPIKey
+	if err := manager.store.GetRecord(apiKeysCollection, keyID, &key); errors.Is(err, board.ErrRecordNotFound) {
+		return APIKey{}, errInvalidAPIKey
+	} else if err != nil {
+		return APIKey{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(key.SecretHash)) != 1 {
+		return APIKey{}, errInvalidAPIKey
+	}
+	return key.APIKey, nil
+}
+
+// Take a request from the key's rate limit, returning how long to wait if there are none left.
+func (manager *apiKeyManager) allow(key APIKey, now time.Time) (bool, time.Duration) {
+	if key.RequestsPerMinute <= 0 {
+		return true, 0
+	}
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	limiter, ok := manager.limiters[key.ID]
+	if !ok || limiter.perMinute != key.RequestsPerMinute {
+		limiter = newRateLimiter(key.RequestsPerMinute, now)
+		manager.limiters[key.ID] = limiter
+	}
+	return limiter.allow(now)
+}
+
+// Count a new game against the key's quota, returning false if the key already has as many games as it is allowed.
+// The game is released when it ends, or with releaseGame if it never starts.
+func (manager *apiKeyManager) reserveGame(key APIKey, gameID string) bool {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if key.MaxConcurrentGames > 0 {
+		count := 0
+		for _, keyID := range manager.games {
+			if keyID == key.ID {
+				count++
+			}
+		}
+		if count >= key.MaxConcurrentGames {
+			return false
+		}
+	}
+	manager.games[gameID] = key.ID
+	return true
+}
+
+func (manager *apiKeyManager) releaseGame(gameID string) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	delete(manager.games, gameID)
+}
+
+// Release the quota used by a game once it ends. It is registered with PersistentBoardServer.OnGameEnd.
+func (manager *apiKeyManager) gameEnded(summary board.GameSummary, events []board.GameEvent) {
+	manager.releaseGame(summary.Game.ID)
+}
+
+// Whether a key can manage a game, which is limited to the key that started it and admin keys.
+func (manager *apiKeyManager) canManageGame(key APIKey, gameID string) bool {
+	if !manager.required || key.Admin {
+		return true
+	}
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	return manager.games[gameID] == key.ID
+}
+
+// Whether a key can change or delete a registered snake, which is limited to the key that registered it and admin keys.
+func (manager *apiKeyManager) canManageSnake(key APIKey, snake RegisteredSnake) bool {
+	if !manager.required || key.Admin {
+		return true
+	}
+	return snake.OwnerKeyID != "" && snake.OwnerKeyID == key.ID
+}
+
+type apiKeyContextKey struct{}
+
+// The key used for a request, which is only set when keys are required.
+func apiKeyFromContext(ctx context.Context) (APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(APIKey)
+	return key, ok
+}
+
+// Wrap a handler that changes something, such as starting games, so that it requires a key when keys are required.
+func (manager *apiKeyManager) requireKey(next http.HandlerFunc) http.HandlerFunc {
+	return manager.authorize(false, next)
+}
+
+// Wrap an admin handler, such as managing keys, so that it requires an admin key when keys are required.
+func (manager *apiKeyManager) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return manager.authorize(true, next)
+}
+
+// Wrap a handler that only reads games, which stays public unless that has been turned off.
+func (manager *apiKeyManager) readAccess(next http.HandlerFunc) http.HandlerFunc {
+	authorized := manager.authorize(false, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if manager.publicRead {
+			next(w, r)
+			return
+		}
+		authorized(w, r)
+	}
+}
+
+func (manager *apiKeyManager) authorize(admin bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !manager.required {
+			next(w, r)
+			return
+		}
+
+		rawKey := requestAPIKey(r)
+		if rawKey == "" {
+			writeError(w, http.StatusUnauthorized, ErrorResponse{Error: "unauthorized", Message: "an API key is required"})
+			return
+		}
+		key, err := manager.authenticate(rawKey)
+		if errors.Is(err, errInvalidAPIKey) {
+			writeError(w, http.StatusUnauthorized, ErrorResponse{Error: "unauthorized", Message: err.Error()})
+			return
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("Error checking API key: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if admin && !key.Admin {
+			writeError(w, http.StatusForbidden, ErrorResponse{Error: "forbidden", Message: "an admin API key is required"})
+			return
+		}
+		if ok, wait := manager.allow(key, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, ErrorResponse{Error: "rate_limited", Message: "too many requests for this API key"})
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	}
+}
+
+// Keys are sent as a bearer token, or in the apiKey query parameter for clients that can't set headers,
+// such as browsers opening a websocket.
+func requestAPIKey(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return r.URL.Query().Get("apiKey")
+}
+
+func hashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// A token bucket that allows bursts of up to a minute's worth of requests.
+type rateLimiter struct {
+	perMinute int
+	tokens    float64
+	last      time.Time
+}
+
+func newRateLimiter(perMinute int, now time.Time) *rateLimiter {
+	return &rateLimiter{perMinute: perMinute, tokens: float64(perMinute), last: now}
+}
+
+func (limiter *rateLimiter) allow(now time.Time) (bool, time.Duration) {
+	perSecond := float64(limiter.perMinute) / 60
+	limiter.tokens = math.Min(float64(limiter.perMinute), limiter.tokens+now.Sub(limiter.last).Seconds()*perSecond)
+	limiter.last = now
+	if limiter.tokens < 1 {
+		return false, time.Duration((1 - limiter.tokens) / perSecond * float64(time.Second))
+	}
+	limiter.tokens--
+	return true, 0
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyManager(t *testing.T) {
+	manager := newAPIKeyManager(board.NewMemoryGameStore(), true, true, "ADMIN_KEY")
+
+	_, _, err := manager.createKey(CreateAPIKeyRequest{Name: " "})
+	require.Error(t, err)
+	key, secret, err := manager.createKey(CreateAPIKeyRequest{Name: "alice", MaxConcurrentGames: 1})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(secret, apiKeyPrefix+key.ID+"_"))
+
+	authenticated, err := manager.authenticate(secret)
+	require.NoError(t, err)
+	require.Equal(t, key.ID, authenticated.ID)
+	require.False(t, authenticated.Admin)
+	_, err = manager.authenticate(secret + "0")
+	require.ErrorIs(t, err, errInvalidAPIKey)
+	_, err = manager.authenticate("nonsense")
+	require.ErrorIs(t, err, errInvalidAPIKey)
+	admin, err := manager.authenticate("ADMIN_KEY")
+	require.NoError(t, err)
+	require.True(t, admin.Admin)
+
+	keys, err := manager.listKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.Equal(t, key.ID, keys[0].ID)
+
+	// Only one game can be running at once, and only its key can manage it
+	require.True(t, manager.reserveGame(key, "GAME_1"))
+	require.False(t, manager.reserveGame(key, "GAME_2"))
+	require.True(t, manager.canManageGame(key, "GAME_1"))
+	require.True(t, manager.canManageGame(admin, "GAME_1"))
+	other, _, err := manager.createKey(CreateAPIKeyRequest{Name: "bob"})
+	require.NoError(t, err)
+	require.False(t, manager.canManageGame(other, "GAME_1"))
+	manager.gameEnded(board.GameSummary{Game: board.Game{ID: "GAME_1"}}, nil)
+	require.True(t, manager.reserveGame(key, "GAME_2"))
+
+	require.NoError(t, manager.deleteKey(key.ID))
+	require.ErrorIs(t, manager.deleteKey(key.ID), errAPIKeyNotFound)
+	_, err = manager.authenticate(secret)
+	require.ErrorIs(t, err, errInvalidAPIKey)
+}
+
+func TestAPIKeyRateLimit(t *testing.T) {
+	manager := newAPIKeyManager(board.NewMemoryGameStore(), true, true, "")
+	key := APIKey{ID: "KEY_ID", RequestsPerMinute: 2}
+
+	now := time.Now()
+	ok, _ := manager.allow(key, now)
+	require.True(t, ok)
+	ok, _ = manager.allow(key, now)
+	require.True(t, ok)
+	ok, wait := manager.allow(key, now)
+	require.False(t, ok)
+	require.Equal(t, 30*time.Second, wait)
+
+	ok, _ = manager.allow(key, now.Add(30*time.Second))
+	require.True(t, ok)
+}
+
+func TestAuthorize(t *testing.T) {
+	store := board.NewMemoryGameStore()
+	manager := newAPIKeyManager(store, true, false, "ADMIN_KEY")
+	_, secret, err := manager.createKey(CreateAPIKeyRequest{Name: "alice", RequestsPerMinute: 1})
+	require.NoError(t, err)
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		apiKey  string
+		code    int
+	}{
+		{"missing key", manager.requireKey(ok), "", http.StatusUnauthorized},
+		{"invalid key", manager.requireKey(ok), "bsk_invalid", http.StatusUnauthorized},
+		{"valid key", manager.requireKey(ok), secret, http.StatusNoContent},
+		{"rate limited", manager.requireKey(ok), secret, http.StatusTooManyRequests},
+		{"admin only", manager.requireAdmin(ok), "", http.StatusUnauthorized},
+		{"admin key", manager.requireAdmin(ok), "ADMIN_KEY", http.StatusNoContent},
+		{"private read", manager.readAccess(ok), "", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if test.apiKey != "" {
+				r.Header.Set("Authorization", "Bearer "+test.apiKey)
+			}
+			w := httptest.NewRecorder()
+			test.handler(w, r)
+			require.Equal(t, test.code, w.Code)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	manager.requireAdmin(ok)(w, httptest.NewRequest("GET", "/?apiKey="+secret, nil))
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	public := newAPIKeyManager(store, true, true, "")
+	w = httptest.NewRecorder()
+	public.readAccess(ok)(w, httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	optional := newAPIKeyManager(store, false, false, "")
+	w = httptest.NewRecorder()
+	optional.requireAdmin(ok)(w, httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestKeysCommand(t *testing.T) {
+	storage := []string{"--storage", board.StoreBackendFile, "--storage-path", t.TempDir()}
+	runCommand := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		cmd := NewCommand()
+		cmd.SetOut(&out)
+		cmd.SetErr(&out)
+		cmd.SetArgs(append(args, storage...))
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	out, err := runCommand("keys", "create", "--name", "alice", "--rpm", "60")
+	require.NoError(t, err)
+	require.Contains(t, out, apiKeyPrefix)
+
+	out, err = runCommand("keys", "list")
+	require.NoError(t, err)
+	require.Contains(t, out, "alice")
+	require.Contains(t, out, "rpm=60")
+	keyID := strings.Fields(out)[0]
+
+	_, err = runCommand("keys", "delete", keyID)
+	require.NoError(t, err)
+	_, err = runCommand("keys", "delete", keyID)
+	require.ErrorIs(t, err, errAPIKeyNotFound)
+	out, err = runCommand("keys", "list")
+	require.NoError(t, err)
+	require.Empty(t, out)
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// The key that server settings are read from in the config file, such as server.listen.
+const configKey = "server"
+
+// NewCommand creates the `battlesnake server` command, which runs the server until it is stopped.
+// Every flag can also be set in the config file, under the server key.
+func NewCommand() *cobra.Command {
+	serverCmd := &cobra.Command{
+		Use:   "server",
+		Short: "Run a Battlesnake game server.",
+		Long:  "Run an HTTP server that plays games on request, and serves them to the game board as they are played.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+			defer stop()
+			return Run(ctx, configFromViper())
+		},
+	}
+
+	flags := serverCmd.PersistentFlags()
+	flags.String("listen", "0.0.0.0:8080", "Address to listen on")
+	flags.String("storage", board.StoreBackendFile, "Storage backend for finished games: memory, file or replit")
+	flags.String("storage-path", "games", "Directory to store games in when using the file storage backend")
+	flags.Int("max-concurrent-games", 10, "Maximum number of games to run at once")
+	flags.Int("max-queued-games", 100, "Maximum number of games waiting to run before new games are rejected")
+	flags.String("ladder-config", "", "Path to a JSON ladder config, to keep scheduling games between a pool of snakes")
+	flags.String("public-url", "http://localhost:8080", "The URL the server can be reached at, used for links to games")
+	flags.String("board-url", "https://board.battlesnake.com", "The board used to view games")
+	flags.StringSlice("cors-origins", []string{"*"}, "Origins allowed to make requests from a browser, or * for any origin")
+	flags.Bool("require-api-keys", false, "Require an API key to start games, change the snake registry and use admin endpoints")
+	flags.Bool("public-read", true, "Allow viewing games without an API key when API keys are required")
+	flags.String("admin-key", "", "An admin API key, used to create other keys. Can also be set with the BATTLESNAKE_ADMIN_KEY environment variable")
+	flags.Duration("ping-interval", time.Minute, "How often to ping registered snakes to check that they are online, or 0 to disable")
+	flags.Duration("checkpoint-interval", 10*time.Second, "How often to save running games, so that they can be recovered if the server stops unexpectedly")
+	flags.Duration("shutdown-timeout", 30*time.Second, "How long to wait for running games to finish when the server is stopped, before saving them as aborted")
+	flags.SortFlags = false
+	flags.VisitAll(func(flag *pflag.Flag) {
+		cobra.CheckErr(viper.BindPFlag(configKey+"."+flag.Name, flag))
+	})
+	// Read from the environment rather than used as the flag default, so that the key isn't shown in the usage
+	cobra.CheckErr(viper.BindEnv(configKey+".admin-key", "BATTLESNAKE_ADMIN_KEY"))
+
+	serverCmd.AddCommand(newKeysCommand())
+	return serverCmd
+}
+
+func configFromViper() Config {
+	get := func(name string) string { return configKey + "." + name }
+	return Config{
+		ListenAddress:      viper.GetString(get("listen")),
+		StorageBackend:     viper.GetString(get("storage")),
+		StoragePath:        viper.GetString(get("storage-path")),
+		MaxConcurrentGames: viper.GetInt(get("max-concurrent-games")),
+		MaxQueuedGames:     viper.GetInt(get("max-queued-games")),
+		LadderConfigPath:   viper.GetString(get("ladder-config")),
+		PublicURL:          viper.GetString(get("public-url")),
+		BoardURL:           viper.GetString(get("board-url")),
+		CORSOrigins:        viper.GetStringSlice(get("cors-origins")),
+		RequireAPIKeys:     viper.GetBool(get("require-api-keys")),
+		PublicRead:         viper.GetBool(get("public-read")),
+		AdminKey:           viper.GetString(get("admin-key")),
+		PingInterval:       viper.GetDuration(get("ping-interval")),
+		CheckpointInterval: viper.GetDuration(get("checkpoint-interval")),
+		ShutdownTimeout:    viper.GetDuration(get("shutdown-timeout")),
+	}
+}
+
+// Manage API keys in the server's storage, for example to create keys before the server is started:
+//
+//	battlesnake server keys create --name alice --rpm 60 --max-games 2
+//	battlesnake server keys list
+//	battlesnake server keys delete <id>
+func newKeysCommand() *cobra.Command {
+	keysCmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage the API keys for the server.",
+	}
+
+	var req CreateAPIKeyRequest
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an API key. The secret key is only shown once.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := keyManagerFromViper()
+			if err != nil {
+				return err
+			}
+			key, secret, err := manager.createKey(req)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Created API key %s (%s). It can't be shown again:\n%s\n", key.ID, key.Name, secret)
+			return nil
+		},
+	}
+	createCmd.Flags().StringVar(&req.Name, "name", "", "Name of the key")
+	createCmd.Flags().BoolVar(&req.Admin, "admin", false, "Allow the key to use admin endpoints")
+	createCmd.Flags().IntVar(&req.RequestsPerMinute, "rpm", 0, "Requests allowed per minute, or 0 for no limit")
+	createCmd.Flags().IntVar(&req.MaxConcurrentGames, "max-games", 0, "Games allowed to run or be queued at once, or 0 for no limit")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the API keys, without their secrets.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := keyManagerFromViper()
+			if err != nil {
+				return err
+			}
+			keys, err := manager.listKeys()
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s\tadmin=%t\trpm=%d\tmax-games=%d\n", key.ID, key.Name, key.Admin, key.RequestsPerMinute, key.MaxConcurrentGames)
+			}
+			return nil
+		},
+	}
+
+	deleteCmd := &cobra.Command{
+		Use:   "delete <id>",
+		Short: "Delete an API key.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := keyManagerFromViper()
+			if err != nil {
+				return err
+			}
+			if err := manager.deleteKey(args[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Deleted API key %s\n", args[0])
+			return nil
+		},
+	}
+
+	keysCmd.AddCommand(createCmd, listCmd, deleteCmd)
+	return keysCmd
+}
+
+func keyManagerFromViper() (*apiKeyManager, error) {
+	config := configFromViper()
+	store, err := board.NewGameStore(config.StorageBackend, config.StoragePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create game store: %w", err)
+	}
+	return newAPIKeyManager(store, config.RequireAPIKeys, config.PublicRead, config.AdminKey), nil
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFromViper(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.SetConfigType("yaml")
+	require.NoError(t, viper.ReadConfig(strings.NewReader("server:\n  max-concurrent-games: 3\n  listen: 0.0.0.0:9000\n")))
+
+	// Flags take precedence over the config file, which takes precedence over the defaults
+	cmd := NewCommand()
+	require.NoError(t, cmd.PersistentFlags().Parse([]string{"--listen", "127.0.0.1:8000", "--cors-origins", "https://one.example.com,https://two.example.com"}))
+
+	config := configFromViper()
+	require.Equal(t, "127.0.0.1:8000", config.ListenAddress)
+	require.Equal(t, 3, config.MaxConcurrentGames)
+	require.Equal(t, []string{"https://one.example.com", "https://two.example.com"}, config.CORSOrigins)
+	require.Equal(t, "https://board.battlesnake.com", config.BoardURL)
+	require.Equal(t, 30*time.Second, config.ShutdownTimeout)
+}
+
+func TestConfigFromViperAdminKey(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Setenv("BATTLESNAKE_ADMIN_KEY", "secret")
+
+	cmd := NewCommand()
+	require.Empty(t, cmd.PersistentFlags().Lookup("admin-key").DefValue)
+	require.NotContains(t, cmd.UsageString(), "secret")
+	require.Equal(t, "secret", configFromViper().AdminKey)
+
+	require.NoError(t, cmd.PersistentFlags().Parse([]string{"--admin-key", "flag-secret"}))
+	require.Equal(t, "flag-secret", configFromViper().AdminKey)
+}
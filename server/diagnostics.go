@@ -0,0 +1,135 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/BattlesnakeOfficial/rules/engine"
+)
+
+// Record collection holding the move diagnostics of each finished game, by game ID.
+const diagnosticsCollection = "snake_diagnostics"
+
+// Response bodies longer than this are truncated, so that a misbehaving snake can't fill up the store.
+const maxDiagnosticBodyLength = 1024
+
+var errDiagnosticsNotFound = errors.New("no moves were recorded for this snake in this game")
+
+// The result of one move request, as seen by the server.
+type MoveDiagnostic struct {
+	Turn          int    `json:"turn"`
+	LatencyMS     int64  `json:"latencyMs"`
+	StatusCode    int    `json:"statusCode,omitempty"` // 0 if no response was received
+	ErrorCategory string `json:"errorCategory,omitempty"`
+	Error         string `json:"error,omitempty"`
+	ResponseBody  string `json:"responseBody,omitempty"` // only kept for failed requests
+	Move          string `json:"move"`                   // the move applied, which is the previous move if the request failed
+}
+
+type snakeDiagnostics struct {
+	Name  string           `json:"name"`
+	Moves []MoveDiagnostic `json:"moves"`
+}
+
+// The diagnostics of every snake in a game, by snake ID.
+type gameDiagnostics map[string]*snakeDiagnostics
+
+// Keeps the details of every move request made in server games, which are otherwise reduced to a
+// generic error in the game events. Games are kept in memory while they run, and saved when they end.
+type diagnosticsRecorder struct {
+	store board.RecordStore
+
+	mu    sync.Mutex
+	games map[string]gameDiagnostics
+}
+
+func newDiagnosticsRecorder(store board.RecordStore) *diagnosticsRecorder {
+	return &diagnosticsRecorder{
+		store: store,
+		games: make(map[string]gameDiagnostics),
+	}
+}
+
+// Record the result of a move request in a running game.
+func (recorder *diagnosticsRecorder) moveObserved(gameID string, snakeState engine.SnakeState) {
+	move := MoveDiagnostic{
+		Turn:          snakeState.Turn,
+		LatencyMS:     snakeState.Latency.Milliseconds(),
+		StatusCode:    snakeState.StatusCode,
+		ErrorCategory: snakeState.ErrorCategory(),
+		ResponseBody:  snakeState.ResponseBody,
+		Move:          snakeState.LastMove,
+	}
+	if snakeState.Error != nil {
+		move.Error = snakeState.Error.Error()
+	}
+	if len(move.ResponseBody) > maxDiagnosticBodyLength {
+		move.ResponseBody = move.ResponseBody[:maxDiagnosticBodyLength]
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	game, ok := recorder.games[gameID]
+	if !ok {
+		game = make(gameDiagnostics)
+		recorder.games[gameID] = game
+	}
+	snake, ok := game[snakeState.ID]
+	if !ok {
+		snake = &snakeDiagnostics{Name: snakeState.Name}
+		game[snakeState.ID] = snake
+	}
+	snake.Moves = append(snake.Moves, move)
+}
+
+// Save the diagnostics of a game that has ended. It is registered with PersistentBoardServer.OnGameEnd.
+func (recorder *diagnosticsRecorder) gameEnded(summary board.GameSummary, events []board.GameEvent) {
+	gameID := summary.Game.ID
+
+	recorder.mu.Lock()
+	game, ok := recorder.games[gameID]
+	recorder.mu.Unlock()
+	if !ok {
+		// The game never made any move requests, such as a queued game that was cancelled
+		return
+	}
+
+	// Keep serving the game from memory until it has been saved
+	if err := recorder.store.PutRecord(diagnosticsCollection, gameID, game); err != nil {
+		log.Printf("Unable to save diagnostics for game %v: %v", gameID, err)
+	}
+
+	recorder.mu.Lock()
+	delete(recorder.games, gameID)
+	recorder.mu.Unlock()
+}
+
+// Get the diagnostics of a snake in a running or finished game.
+// Returns errDiagnosticsNotFound if the snake hasn't made any move requests in the game.
+func (recorder *diagnosticsRecorder) snake(gameID string, snakeID string) (snakeDiagnostics, error) {
+	recorder.mu.Lock()
+	if game, ok := recorder.games[gameID]; ok {
+		defer recorder.mu.Unlock()
+		snake, ok := game[snakeID]
+		if !ok {
+			return snakeDiagnostics{}, errDiagnosticsNotFound
+		}
+		return snakeDiagnostics{Name: snake.Name, Moves: append([]MoveDiagnostic(nil), snake.Moves...)}, nil
+	}
+	recorder.mu.Unlock()
+
+	var game gameDiagnostics
+	if err := recorder.store.GetRecord(diagnosticsCollection, gameID, &game); errors.Is(err, board.ErrRecordNotFound) {
+		return snakeDiagnostics{}, errDiagnosticsNotFound
+	} else if err != nil {
+		return snakeDiagnostics{}, err
+	}
+	snake, ok := game[snakeID]
+	if !ok {
+		return snakeDiagnostics{}, errDiagnosticsNotFound
+	}
+	return *snake, nil
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/BattlesnakeOfficial/rules/engine"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnosticsRecorder(t *testing.T) {
+	store := board.NewMemoryGameStore()
+	recorder := newDiagnosticsRecorder(store)
+
+	recorder.moveObserved("GAME_ID", engine.SnakeState{ID: "one", Name: "one", Turn: 0, StatusCode: 200, Latency: 20 * time.Millisecond, LastMove: "up"})
+	recorder.moveObserved("GAME_ID", engine.SnakeState{ID: "two", Name: "two", Turn: 0, Latency: 500 * time.Millisecond, LastMove: "up", Error: errors.New("connection refused")})
+	recorder.moveObserved("GAME_ID", engine.SnakeState{ID: "one", Name: "one", Turn: 1, StatusCode: 500, Latency: 5 * time.Millisecond, LastMove: "up", ResponseBody: string(make([]byte, 2000))})
+
+	snake, err := recorder.snake("GAME_ID", "one")
+	require.NoError(t, err)
+	require.Equal(t, "one", snake.Name)
+	require.Len(t, snake.Moves, 2)
+	require.Equal(t, MoveDiagnostic{Turn: 0, LatencyMS: 20, StatusCode: 200, Move: "up"}, snake.Moves[0])
+	require.Equal(t, 1, snake.Moves[1].Turn)
+	require.Equal(t, engine.MoveErrorBadStatus, snake.Moves[1].ErrorCategory)
+	require.Len(t, snake.Moves[1].ResponseBody, maxDiagnosticBodyLength)
+
+	snake, err = recorder.snake("GAME_ID", "two")
+	require.NoError(t, err)
+	require.Equal(t, []MoveDiagnostic{{Turn: 0, LatencyMS: 500, ErrorCategory: engine.MoveErrorConnection, Error: "connection refused", Move: "up"}}, snake.Moves)
+
+	_, err = recorder.snake("GAME_ID", "missing")
+	require.ErrorIs(t, err, errDiagnosticsNotFound)
+
+	// Once the game ends, the diagnostics are served from the store
+	recorder.gameEnded(board.GameSummary{Game: board.Game{ID: "GAME_ID"}}, nil)
+	require.Empty(t, recorder.games)
+	stored, err := recorder.snake("GAME_ID", "two")
+	require.NoError(t, err)
+	require.Equal(t, snake, stored)
+
+	_, err = recorder.snake("MISSING", "one")
+	require.ErrorIs(t, err, errDiagnosticsNotFound)
+}
+
+func TestSnakeDiagnosticsHandler(t *testing.T) {
+	// Moves up once, then fails every request after that until it hits the wall
+	var requests atomic.Int32 // move requests
+	snakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/move" || requests.Add(1) == 1 {
+			w.Write([]byte(`{"move": "up"}`))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`something went wrong`))
+	}))
+	t.Cleanup(snakeServer.Close)
+
+	store := board.NewMemoryGameStore()
+	persistentServer = board.NewPersistentBoardServer(store)
+	runner = newGameRunner(persistentServer, 1, 1)
+	diagnostics = newDiagnosticsRecorder(store)
+	runner.diagnostics = diagnostics
+	persistentServer.OnGameEnd(diagnostics.gameEnded)
+
+	ended := make(chan struct{})
+	persistentServer.OnGameEnd(func(summary board.GameSummary, events []board.GameEvent) {
+		close(ended)
+	})
+	gameState := newTestGame(t, snakeServer.URL)
+	require.NoError(t, runner.submit(gameState))
+	<-ended
+
+	events, err := persistentServer.GetEvents(gameState.GameID())
+	require.NoError(t, err)
+	snakeID := events[0].Data.(board.GameFrame).Snakes[0].ID
+
+	router := mux.NewRouter()
+	router.HandleFunc("/games/{gameID}/snakes/{snakeID}/diagnostics", snakeDiagnosticsHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/games/"+gameState.GameID()+"/snakes/"+snakeID+"/diagnostics", nil))
+	require.Equal(t, 200, w.Code)
+	var response SnakeDiagnosticsResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	require.Equal(t, gameState.GameID(), response.GameID)
+	require.Equal(t, "snake", response.Name)
+	require.Greater(t, len(response.Moves), 1)
+	require.Equal(t, 0, response.Moves[0].Turn)
+	require.Empty(t, response.Moves[0].ErrorCategory)
+	require.Equal(t, MoveDiagnostic{
+		Turn:          1,
+		LatencyMS:     response.Moves[1].LatencyMS,
+		StatusCode:    500,
+		ErrorCategory: engine.MoveErrorBadStatus,
+		ResponseBody:  "something went wrong",
+		Move:          "up",
+	}, response.Moves[1])
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/games/"+gameState.GameID()+"/snakes/MISSING/diagnostics", nil))
+	require.Equal(t, 404, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/games/MISSING/snakes/"+snakeID+"/diagnostics", nil))
+	require.Equal(t, 404, w.Code)
+}
@@ -0,0 +1,270 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/BattlesnakeOfficial/rules/engine"
+	"github.com/BattlesnakeOfficial/rules/maps"
+)
+
+// The source reported for games started through the API in the board game record.
+const apiSource = "API"
+
+// GameConfig is the full configuration for a game created with newServerGame, which the game runner then runs.
+// Zero values are replaced with the same defaults used by the play command.
+type GameConfig struct {
+	Players      []Player     `json:"players"`
+	Width        int          `json:"width"`
+	Height       int          `json:"height"`
+	GameType     string       `json:"gameType"`
+	MapName      string       `json:"map"`
+	Timeout      int          `json:"timeout"`
+	Seed         int64        `json:"seed"`
+	TurnDuration int          `json:"turnDuration"`
+	Settings     GameSettings `json:"settings"`
+}
+
+// Limits on a GameConfig, so that a single game can't hold up a game runner slot or use too much memory.
+const (
+	maxBoardSize    = rules.BoardSizeXXLarge
+	maxPlayers      = 16
+	maxTimeout      = 5000 // milliseconds
+	maxTurnDuration = 5000 // milliseconds
+)
+
+type Player struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// GameSettings holds raw ruleset settings, keyed by the rules.Param* names.
+// Values can be given in JSON as strings, numbers or booleans.
+type GameSettings map[string]string
+
+func (settings *GameSettings) UnmarshalJSON(data []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*settings = make(GameSettings, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			(*settings)[key] = v
+		case float64:
+			(*settings)[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			(*settings)[key] = strconv.FormatBool(v)
+		default:
+			return fmt.Errorf("setting %q must be a string, number or boolean", key)
+		}
+	}
+	return nil
+}
+
+// ConfigError describes which part of a GameConfig is invalid.
+type ConfigError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (err *ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", err.Field, err.Message)
+}
+
+// Fill in defaults for any options that weren't provided.
+func (config GameConfig) withDefaults() GameConfig {
+	if config.Width == 0 {
+		config.Width = rules.BoardSizeMedium
+	}
+	if config.Height == 0 {
+		config.Height = rules.BoardSizeMedium
+	}
+	if config.GameType == "" {
+		config.GameType = rules.GameTypeStandard
+	}
+	if config.MapName == "" {
+		config.MapName = "standard"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 500
+	}
+	players := make([]Player, len(config.Players))
+	for i, player := range config.Players {
+		players[i] = player
+		if player.Name == "" {
+			players[i].Name = fmt.Sprintf("Snake %d", i+1)
+		}
+	}
+	config.Players = players
+	return config
+}
+
+// Validate checks that a game can be started with this configuration, including
+// that the selected map supports the board size and number of players.
+func (config GameConfig) Validate() error {
+	config = config.withDefaults()
+
+	if len(config.Players) == 0 {
+		return &ConfigError{Field: "players", Message: "at least one player is required"}
+	}
+	if len(config.Players) > maxPlayers {
+		return &ConfigError{Field: "players", Message: fmt.Sprintf("at most %d players are allowed", maxPlayers)}
+	}
+	for i, player := range config.Players {
+		if _, err := url.ParseRequestURI(player.URL); err != nil {
+			return &ConfigError{Field: fmt.Sprintf("players[%d].url", i), Message: err.Error()}
+		}
+	}
+	if config.Width < 0 || config.Height < 0 {
+		return &ConfigError{Field: "width", Message: "board dimensions must be positive"}
+	}
+	if config.Width > maxBoardSize {
+		return &ConfigError{Field: "width", Message: fmt.Sprintf("must be at most %d", maxBoardSize)}
+	}
+	if config.Height > maxBoardSize {
+		return &ConfigError{Field: "height", Message: fmt.Sprintf("must be at most %d", maxBoardSize)}
+	}
+	if config.Timeout < 0 {
+		return &ConfigError{Field: "timeout", Message: "must be positive"}
+	}
+	if config.Timeout > maxTimeout {
+		return &ConfigError{Field: "timeout", Message: fmt.Sprintf("must be at most %dms", maxTimeout)}
+	}
+	if config.TurnDuration < 0 {
+		return &ConfigError{Field: "turnDuration", Message: "must be positive"}
+	}
+	if config.TurnDuration > maxTurnDuration {
+		return &ConfigError{Field: "turnDuration", Message: fmt.Sprintf("must be at most %dms", maxTurnDuration)}
+	}
+
+	switch config.GameType {
+	case rules.GameTypeStandard, rules.GameTypeConstrictor, rules.GameTypeWrappedConstrictor,
+		rules.GameTypeRoyale, rules.GameTypeSolo, rules.GameTypeWrapped:
+	default:
+		return &ConfigError{Field: "gameType", Message: fmt.Sprintf("unknown game type %q", config.GameType)}
+	}
+
+	gameMap, err := maps.GetMap(config.MapName)
+	if err != nil {
+		return &ConfigError{Field: "map", Message: fmt.Sprintf("unknown map %q", config.MapName)}
+	}
+	boardState := rules.NewBoardState(config.Width, config.Height).
+		WithSnakes(make([]rules.Snake, len(config.Players)))
+	if err := gameMap.Meta().Validate(boardState); err != nil {
+		return &ConfigError{Field: "map", Message: err.Error()}
+	}
+
+	return nil
+}
+
+// A game run by the server, which publishes every turn to the persistent server so that it can be watched on the board.
+type serverGame struct {
+	*engine.GameRunner
+	game         board.Game                   // the record for the game on the board
+	publisher    *board.PersistentBoardServer // set once the game has been registered
+	moveObserver func(engine.SnakeState)      // optional, called with the result of every move request
+}
+
+// Create a game from the config, ready to be registered with a persistent server and run.
+// The source is reported to the board, to tell games started through the API apart from ladder games.
+func newServerGame(config GameConfig, source string) (*serverGame, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	config = config.withDefaults()
+
+	// The same ruleset settings as the play command's defaults, which the config's settings take precedence over
+	settings := map[string]string{
+		rules.ParamFoodSpawnChance:     "15",
+		rules.ParamMinimumFood:         "1",
+		rules.ParamHazardDamagePerTurn: "14",
+		rules.ParamShrinkEveryNTurns:   "25",
+	}
+	for param, value := range config.Settings {
+		settings[param] = value
+	}
+	snakes := make([]engine.SnakeConfig, len(config.Players))
+	for i, player := range config.Players {
+		snakes[i] = engine.SnakeConfig{Name: player.Name, URL: player.URL}
+	}
+
+	game := &serverGame{}
+	runner, err := engine.NewGameRunner(engine.Config{
+		Snakes:       snakes,
+		Width:        config.Width,
+		Height:       config.Height,
+		GameType:     config.GameType,
+		MapName:      config.MapName,
+		Seed:         config.Seed,
+		Settings:     settings,
+		Timeout:      config.Timeout,
+		TurnDuration: config.TurnDuration,
+	}, engine.Observers{
+		OnTurn:          game.turnPlayed,
+		OnSnakeResponse: game.snakeResponded,
+		OnGameEnd:       game.ended,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error initializing game: %w", err)
+	}
+	game.GameRunner = runner
+
+	ruleset := map[string]string{
+		rules.ParamGameType: config.GameType,
+	}
+	for param, value := range settings {
+		ruleset[param] = value
+	}
+	game.game = board.Game{
+		ID:           runner.GameID(),
+		Status:       board.GameStatusRunning,
+		Width:        config.Width,
+		Height:       config.Height,
+		Ruleset:      ruleset,
+		SnakeTimeout: config.Timeout,
+		Source:       source,
+		RulesetName:  config.GameType,
+		RulesStages:  []string{},
+		Map:          config.MapName,
+	}
+	return game, nil
+}
+
+// Register the game with the persistent server under the given status, which then receives every event
+// once the game is run. This should be done before the game starts, so that no events are missed.
+func (game *serverGame) register(persistentServer *board.PersistentBoardServer, status string) {
+	registered := game.game
+	registered.Status = status
+	persistentServer.AddGame(registered)
+	game.publisher = persistentServer
+}
+
+func (game *serverGame) turnPlayed(boardState *rules.BoardState, snakeStates map[string]engine.SnakeState) {
+	game.publisher.SendEvent(game.game.ID, engine.NewFrameEvent(boardState, snakeStates))
+}
+
+func (game *serverGame) snakeResponded(snakeState engine.SnakeState) {
+	if game.moveObserver != nil {
+		game.moveObserver(snakeState)
+	}
+}
+
+// Games that are cancelled while running still send their own game end event, with the "cancelled" status.
+func (game *serverGame) ended(result engine.Result) {
+	endedGame := game.game
+	endedGame.Status = board.GameStatusComplete
+	if result.Cancelled {
+		endedGame.Status = board.GameStatusCancelled
+	}
+	game.publisher.SendEvent(game.game.ID, board.GameEvent{
+		EventType: board.EVENT_TYPE_GAME_END,
+		Data:      endedGame,
+	})
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/BattlesnakeOfficial/rules/engine"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGameConfigValidate(t *testing.T) {
+	players := []Player{
+		{Name: "one", URL: "http://one.example.com"},
+		{Name: "two", URL: "http://two.example.com"},
+	}
+	manyPlayers := make([]Player, 17)
+	for i := range manyPlayers {
+		manyPlayers[i] = Player{Name: fmt.Sprint(i), URL: "http://example.com"}
+	}
+
+	tests := []struct {
+		name          string
+		config        GameConfig
+		expectedField string
+	}{
+		{
+			name:   "defaults",
+			config: GameConfig{Players: players},
+		},
+		{
+			name:   "full config",
+			config: GameConfig{Players: players, Width: 19, Height: 19, GameType: "wrapped", MapName: "royale", Timeout: 250, Seed: 42},
+		},
+		{
+			name:          "no players",
+			config:        GameConfig{},
+			expectedField: "players",
+		},
+		{
+			name:          "bad player URL",
+			config:        GameConfig{Players: []Player{{Name: "one", URL: "not a url"}}},
+			expectedField: "players[0].url",
+		},
+		{
+			name:          "negative size",
+			config:        GameConfig{Players: players, Width: -1},
+			expectedField: "width",
+		},
+		{
+			name:          "negative timeout",
+			config:        GameConfig{Players: players, Timeout: -1},
+			expectedField: "timeout",
+		},
+		{
+			name:          "unknown game type",
+			config:        GameConfig{Players: players, GameType: "squad"},
+			expectedField: "gameType",
+		},
+		{
+			name:          "unknown map",
+			config:        GameConfig{Players: players, MapName: "nowhere"},
+			expectedField: "map",
+		},
+		{
+			name:          "board too wide",
+			config:        GameConfig{Players: players, Width: 10000},
+			expectedField: "width",
+		},
+		{
+			name:          "board too tall",
+			config:        GameConfig{Players: players, Height: 10000},
+			expectedField: "height",
+		},
+		{
+			name:          "timeout too long",
+			config:        GameConfig{Players: players, Timeout: 5001},
+			expectedField: "timeout",
+		},
+		{
+			name:          "turn duration too long",
+			config:        GameConfig{Players: players, TurnDuration: 5001},
+			expectedField: "turnDuration",
+		},
+		{
+			name:          "too many players",
+			config:        GameConfig{Players: manyPlayers},
+			expectedField: "players",
+		},
+		{
+			name:          "largest game",
+			config:        GameConfig{Players: manyPlayers[:16], Width: 25, Height: 25, Timeout: 5000, TurnDuration: 5000},
+			expectedField: "",
+		},
+		{
+			name:          "unsupported board size",
+			config:        GameConfig{Players: players, MapName: "arcade_maze", Width: 11, Height: 11},
+			expectedField: "map",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			if test.expectedField == "" {
+				require.NoError(t, err)
+				return
+			}
+			var configErr *ConfigError
+			require.ErrorAs(t, err, &configErr)
+			require.Equal(t, test.expectedField, configErr.Field)
+		})
+	}
+}
+
+func TestGameSettingsUnmarshal(t *testing.T) {
+	var settings GameSettings
+	err := json.Unmarshal([]byte(`{"foodSpawnChance": 25, "hazardMap": "abc", "sharedHealth": true}`), &settings)
+	require.NoError(t, err)
+	require.Equal(t, GameSettings{"foodSpawnChance": "25", "hazardMap": "abc", "sharedHealth": "true"}, settings)
+
+	err = json.Unmarshal([]byte(`{"royale": {"shrinkEveryNTurns": 10}}`), &settings)
+	require.Error(t, err)
+}
+
+func TestServerGamePublishesEvents(t *testing.T) {
+	persistentServer := board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	game, err := newServerGame(GameConfig{
+		Players:  []Player{{URL: newMovingSnake(t)}},
+		Timeout:  5000,
+		Settings: GameSettings{rules.ParamFoodSpawnChance: "0"},
+	}, ladderSource)
+	require.NoError(t, err)
+	game.register(persistentServer, board.GameStatusQueued)
+	requireGameStatus(t, persistentServer, game.GameID(), board.GameStatusQueued)
+
+	var moves int
+	game.moveObserver = func(snakeState engine.SnakeState) { moves++ }
+	_, err = game.Run(context.Background())
+	require.NoError(t, err)
+
+	events, err := persistentServer.GetEvents(game.GameID())
+	require.NoError(t, err)
+	frames := events[:len(events)-1]
+	require.NotEmpty(t, frames)
+	for i, event := range frames {
+		frame := event.Data.(board.GameFrame)
+		require.Equal(t, i, frame.Turn)
+		require.Equal(t, "Snake 1", frame.Snakes[0].Name)
+	}
+	// A move is requested for every turn after the first
+	require.Equal(t, len(frames)-1, moves)
+
+	gameEnd := events[len(events)-1]
+	require.Equal(t, board.EVENT_TYPE_GAME_END, gameEnd.EventType)
+	endedGame := gameEnd.Data.(board.Game)
+	require.Equal(t, board.GameStatusComplete, endedGame.Status)
+	require.Equal(t, ladderSource, endedGame.Source)
+	require.Equal(t, "standard", endedGame.Ruleset[rules.ParamGameType])
+	require.Equal(t, "0", endedGame.Ruleset[rules.ParamFoodSpawnChance])
+	require.Equal(t, "1", endedGame.Ruleset[rules.ParamMinimumFood])
+}
+
+func TestServerGameCancelled(t *testing.T) {
+	persistentServer := board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	game := newTestGame(t, newMovingSnake(t))
+	game.register(persistentServer, board.GameStatusRunning)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := game.Run(ctx)
+	require.NoError(t, err)
+	require.True(t, result.Cancelled)
+
+	events, err := persistentServer.GetEvents(game.GameID())
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, 0, events[0].Data.(board.GameFrame).Turn)
+	require.Equal(t, board.EVENT_TYPE_GAME_END, events[1].EventType)
+	require.Equal(t, board.GameStatusCancelled, events[1].Data.(board.Game).Status)
+	require.Equal(t, apiSource, events[1].Data.(board.Game).Source)
+}
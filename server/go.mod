@@ -1,13 +0,0 @@
-
-module battlesnake/server
-
-go 1.21
-
-require (
-	github.com/BattlesnakeOfficial/rules v0.0.0
-	github.com/gorilla/mux v1.8.1
-	github.com/gorilla/websocket v1.5.1
-	github.com/replit/database-go v0.1.0
-)
-
-replace github.com/BattlesnakeOfficial/rules => ../
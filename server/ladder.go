@@ -0,0 +1,371 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+)
+
+// The source reported for ladder games in the board game record.
+const ladderSource = "ladder"
+
+// The number of recent results used to work out each snake's win rate.
+const ladderRecentResults = 20
+
+// Configuration for the ladder, which is loaded from a JSON file.
+type LadderConfig struct {
+	Snakes                  []Player `json:"snakes"`
+	SnakesPerGame           int      `json:"snakesPerGame"`
+	MaxConcurrentGames      int      `json:"maxConcurrentGames"`
+	MaxGamesPerSnakePerHour int      `json:"maxGamesPerSnakePerHour"` // 0 for no limit
+	Maps                    []string `json:"maps"`
+	Rulesets                []string `json:"rulesets"`
+	Width                   int      `json:"width"`
+	Height                  int      `json:"height"`
+	Timeout                 int      `json:"timeout"`
+	IntervalSeconds         int      `json:"intervalSeconds"` // how often to check for snakes that can play
+}
+
+func loadLadderConfig(path string) (LadderConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return LadderConfig{}, fmt.Errorf("unable to read ladder config: %w", err)
+	}
+	var config LadderConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return LadderConfig{}, fmt.Errorf("unable to parse ladder config: %w", err)
+	}
+	config = config.withDefaults()
+	if err := config.Validate(); err != nil {
+		return LadderConfig{}, err
+	}
+	return config, nil
+}
+
+func (config LadderConfig) withDefaults() LadderConfig {
+	if config.SnakesPerGame == 0 {
+		config.SnakesPerGame = 2
+	}
+	if config.MaxConcurrentGames == 0 {
+		config.MaxConcurrentGames = 2
+	}
+	if len(config.Maps) == 0 {
+		config.Maps = []string{"standard"}
+	}
+	if len(config.Rulesets) == 0 {
+		config.Rulesets = []string{"standard"}
+	}
+	if config.IntervalSeconds == 0 {
+		config.IntervalSeconds = 30
+	}
+	return config
+}
+
+// Check that the pool is big enough for a game, and that every allowed ruleset and map can be played.
+func (config LadderConfig) Validate() error {
+	if config.SnakesPerGame < 1 {
+		return &ConfigError{Field: "snakesPerGame", Message: "must be at least 1"}
+	}
+	if len(config.Snakes) < config.SnakesPerGame {
+		return &ConfigError{Field: "snakes", Message: fmt.Sprintf("at least %d snakes are required", config.SnakesPerGame)}
+	}
+	if config.MaxConcurrentGames < 1 {
+		return &ConfigError{Field: "maxConcurrentGames", Message: "must be at least 1"}
+	}
+	names := map[string]bool{}
+	for _, snake := range config.Snakes {
+		if names[snake.Name] {
+			return &ConfigError{Field: "snakes", Message: fmt.Sprintf("snake names must be unique, %q is used more than once", snake.Name)}
+		}
+		names[snake.Name] = true
+	}
+	for _, ruleset := range config.Rulesets {
+		for _, mapName := range config.Maps {
+			if err := config.gameConfig(config.Snakes[:config.SnakesPerGame], ruleset, mapName).Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (config LadderConfig) gameConfig(players []Player, ruleset string, mapName string) GameConfig {
+	return GameConfig{
+		Players:  players,
+		Width:    config.Width,
+		Height:   config.Height,
+		GameType: ruleset,
+		MapName:  mapName,
+		Timeout:  config.Timeout,
+	}
+}
+
+// Keeps starting games between the snakes in the ladder pool that are online, pairing snakes with similar win rates.
+// Results are kept in memory, so win rates and hourly limits start again when the server restarts.
+type ladder struct {
+	config     LadderConfig
+	runner     *gameRunner
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	active  map[string][]string    // game ID to the snakes playing in it
+	started map[string][]time.Time // snake name to the start times of its games in the last hour
+	results map[string][]bool      // snake name to whether it won each of its recent games
+}
+
+func newLadder(config LadderConfig, runner *gameRunner) *ladder {
+	return &ladder{
+		config:     config,
+		runner:     runner,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		active:     make(map[string][]string),
+		started:    make(map[string][]time.Time),
+		results:    make(map[string][]bool),
+	}
+}
+
+// Schedule games every interval, until the context is cancelled.
+func (ladder *ladder) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(ladder.config.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if started := ladder.schedule(); started > 0 {
+			log.Printf("Started %d ladder games", started)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Start as many games as the limits allow between the snakes that are online, returning the number of games started.
+func (ladder *ladder) schedule() int {
+	online := ladder.onlineSnakes()
+
+	// Games are submitted without holding the lock, because ending a game calls recordResult,
+	// so the runner lock must never be taken while holding the ladder lock
+	games := ladder.pairGames(online)
+	started := 0
+	for i, game := range games {
+		if err := ladder.runner.submit(game); err != nil {
+			if errors.Is(err, errQueueFull) {
+				err = fmt.Errorf("server is busy: %w", err)
+			}
+			log.Printf("Unable to start ladder game: %v", err)
+			for _, unstarted := range games[i:] {
+				ladder.abandon(unstarted)
+			}
+			break
+		}
+		started++
+	}
+	return started
+}
+
+// Build as many games as the limits allow, tracking each one as if it had started.
+func (ladder *ladder) pairGames(online []Player) []*serverGame {
+	ladder.mu.Lock()
+	defer ladder.mu.Unlock()
+
+	var games []*serverGame
+	for len(ladder.active) < ladder.config.MaxConcurrentGames {
+		candidates := ladder.candidatesLocked(online)
+		if len(candidates) < ladder.config.SnakesPerGame {
+			break
+		}
+		players := pickLadderMatch(candidates, ladder.config.SnakesPerGame, ladder.rand)
+		game, err := ladder.newGameLocked(players)
+		if err != nil {
+			log.Printf("Unable to start ladder game: %v", err)
+			break
+		}
+		games = append(games, game)
+	}
+	return games
+}
+
+// Stop tracking a game that couldn't be submitted, so that its snakes can play again.
+func (ladder *ladder) abandon(game *serverGame) {
+	ladder.mu.Lock()
+	defer ladder.mu.Unlock()
+
+	gameID := game.GameID()
+	for _, name := range ladder.active[gameID] {
+		if started := ladder.started[name]; len(started) > 0 {
+			ladder.started[name] = started[:len(started)-1]
+		}
+	}
+	delete(ladder.active, gameID)
+}
+
+// Stop tracking a game once the runner is done with it, so that its snakes can play again.
+// Most games have already been released by recordResult, but a game that fails before it runs
+// might never send a result. It is registered as the runner's onGameDone.
+func (ladder *ladder) release(gameID string) {
+	ladder.mu.Lock()
+	defer ladder.mu.Unlock()
+	delete(ladder.active, gameID)
+}
+
+// Record the result of a ladder game, freeing up its snakes for the next game.
+// It is registered with PersistentBoardServer.OnGameEnd.
+func (ladder *ladder) recordResult(summary board.GameSummary, events []board.GameEvent) {
+	if summary.Game.Source != ladderSource {
+		return
+	}
+
+	ladder.mu.Lock()
+	defer ladder.mu.Unlock()
+
+	delete(ladder.active, summary.Game.ID)
+	if summary.Game.Status != board.GameStatusComplete {
+		return
+	}
+	for _, name := range summary.Snakes {
+		results := append(ladder.results[name], summary.WinnerName == name)
+		if len(results) > ladderRecentResults {
+			results = results[len(results)-ladderRecentResults:]
+		}
+		ladder.results[name] = results
+	}
+}
+
+// Ping every snake in the pool, returning the ones that answered.
+func (ladder *ladder) onlineSnakes() []Player {
+	responded := make([]bool, len(ladder.config.Snakes))
+	var wg sync.WaitGroup
+	for i, snake := range ladder.config.Snakes {
+		wg.Add(1)
+		go func(i int, snake Player) {
+			defer wg.Done()
+			_, err := fetchSnakeMetadata(ladder.httpClient, snake.URL)
+			responded[i] = err == nil
+		}(i, snake)
+	}
+	wg.Wait()
+
+	online := make([]Player, 0, len(ladder.config.Snakes))
+	for i, snake := range ladder.config.Snakes {
+		if responded[i] {
+			online = append(online, snake)
+		}
+	}
+	return online
+}
+
+// The online snakes that aren't already playing, and haven't reached their hourly limit.
+// Must be called with the lock held.
+func (ladder *ladder) candidatesLocked(online []Player) []ladderCandidate {
+	playing := map[string]bool{}
+	for _, names := range ladder.active {
+		for _, name := range names {
+			playing[name] = true
+		}
+	}
+
+	hourAgo := time.Now().Add(-time.Hour)
+	candidates := make([]ladderCandidate, 0, len(online))
+	for _, snake := range online {
+		recent := ladder.started[snake.Name][:0]
+		for _, startTime := range ladder.started[snake.Name] {
+			if startTime.After(hourAgo) {
+				recent = append(recent, startTime)
+			}
+		}
+		ladder.started[snake.Name] = recent
+
+		if playing[snake.Name] {
+			continue
+		}
+		if ladder.config.MaxGamesPerSnakePerHour > 0 && len(recent) >= ladder.config.MaxGamesPerSnakePerHour {
+			continue
+		}
+		candidates = append(candidates, ladderCandidate{
+			player:      snake,
+			winRate:     ladder.winRateLocked(snake.Name),
+			recentGames: len(recent),
+		})
+	}
+	return candidates
+}
+
+// Snakes without any results are treated as average.
+// Must be called with the lock held.
+func (ladder *ladder) winRateLocked(name string) float64 {
+	results := ladder.results[name]
+	if len(results) == 0 {
+		return 0.5
+	}
+	wins := 0
+	for _, won := range results {
+		if won {
+			wins++
+		}
+	}
+	return float64(wins) / float64(len(results))
+}
+
+// Must be called with the lock held, so that the game is tracked before its result can be recorded.
+func (ladder *ladder) newGameLocked(players []Player) (*serverGame, error) {
+	ruleset := ladder.config.Rulesets[ladder.rand.Intn(len(ladder.config.Rulesets))]
+	mapName := ladder.config.Maps[ladder.rand.Intn(len(ladder.config.Maps))]
+	game, err := newServerGame(ladder.config.gameConfig(players, ruleset, mapName), ladderSource)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	names := make([]string, len(players))
+	for i, player := range players {
+		names[i] = player.Name
+		ladder.started[player.Name] = append(ladder.started[player.Name], now)
+	}
+	ladder.active[game.GameID()] = names
+	return game, nil
+}
+
+type ladderCandidate struct {
+	player      Player
+	winRate     float64
+	recentGames int
+}
+
+// Pick the snakes for the next game: the candidate that has played the fewest games in the last hour,
+// along with the candidates closest to it in win rate. Ties are broken randomly.
+func pickLadderMatch(candidates []ladderCandidate, size int, rng *rand.Rand) []Player {
+	shuffled := append([]ladderCandidate(nil), candidates...)
+	rng.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	sort.SliceStable(shuffled, func(i, j int) bool {
+		return shuffled[i].recentGames < shuffled[j].recentGames
+	})
+
+	anchor := shuffled[0]
+	opponents := shuffled[1:]
+	sort.SliceStable(opponents, func(i, j int) bool {
+		return math.Abs(opponents[i].winRate-anchor.winRate) < math.Abs(opponents[j].winRate-anchor.winRate)
+	})
+
+	players := []Player{anchor.player}
+	for _, opponent := range opponents[:size-1] {
+		players = append(players, opponent.player)
+	}
+	return players
+}
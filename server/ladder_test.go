@@ -0,0 +1,197 @@
+package server
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/stretchr/testify/require"
+)
+
+// A snake that answers every request straight away.
+func newMovingSnake(t *testing.T) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"apiversion": "1", "move": "up"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestLadderConfigValidate(t *testing.T) {
+	snakes := []Player{{Name: "one", URL: "http://one.example.com"}, {Name: "two", URL: "http://two.example.com"}}
+
+	require.NoError(t, LadderConfig{Snakes: snakes}.withDefaults().Validate())
+
+	var configErr *ConfigError
+	err := LadderConfig{Snakes: snakes[:1]}.withDefaults().Validate()
+	require.ErrorAs(t, err, &configErr)
+	require.Equal(t, "snakes", configErr.Field)
+
+	err = LadderConfig{Snakes: []Player{snakes[0], snakes[0]}}.withDefaults().Validate()
+	require.ErrorAs(t, err, &configErr)
+	require.Equal(t, "snakes", configErr.Field)
+
+	err = LadderConfig{Snakes: snakes, Rulesets: []string{"unknown"}}.withDefaults().Validate()
+	require.ErrorAs(t, err, &configErr)
+	require.Equal(t, "gameType", configErr.Field)
+
+	err = LadderConfig{Snakes: snakes, Maps: []string{"unknown"}}.withDefaults().Validate()
+	require.ErrorAs(t, err, &configErr)
+	require.Equal(t, "map", configErr.Field)
+}
+
+func TestPickLadderMatch(t *testing.T) {
+	candidates := []ladderCandidate{
+		{player: Player{Name: "busy"}, winRate: 0.5, recentGames: 3},
+		{player: Player{Name: "strong"}, winRate: 0.9, recentGames: 1},
+		{player: Player{Name: "weak"}, winRate: 0.1, recentGames: 1},
+		{player: Player{Name: "fresh"}, winRate: 0.8, recentGames: 0},
+	}
+
+	players := pickLadderMatch(candidates, 2, rand.New(rand.NewSource(1)))
+	require.Equal(t, []Player{{Name: "fresh"}, {Name: "strong"}}, players)
+
+	players = pickLadderMatch(candidates, 3, rand.New(rand.NewSource(1)))
+	require.Equal(t, []Player{{Name: "fresh"}, {Name: "strong"}, {Name: "busy"}}, players)
+}
+
+func TestLadderSchedule(t *testing.T) {
+	persistentServer := board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	runner := newGameRunner(persistentServer, 10, 10)
+	ladder := newLadder(LadderConfig{
+		Snakes: []Player{
+			{Name: "one", URL: newMovingSnake(t)},
+			{Name: "two", URL: newMovingSnake(t)},
+			{Name: "three", URL: newMovingSnake(t)},
+			{Name: "offline", URL: "http://localhost:1"},
+		},
+		MaxConcurrentGames:      5,
+		MaxGamesPerSnakePerHour: 1,
+		Timeout:                 5000,
+	}.withDefaults(), runner)
+	persistentServer.OnGameEnd(ladder.recordResult)
+
+	// Only one game fits, because each snake can only be in one game at a time
+	require.Equal(t, 1, ladder.schedule())
+	games, _, err := persistentServer.ListGames(board.GameFilter{Source: ladderSource}, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, games, 1)
+	require.NotContains(t, games[0].Snakes, "offline")
+
+	require.Eventually(t, func() bool {
+		games, _, err := persistentServer.ListGames(board.GameFilter{Source: ladderSource, Status: board.GameStatusComplete}, 0, 0)
+		return err == nil && len(games) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Only the snake that hasn't played yet is left under the hourly limit, which isn't enough for a game
+	require.Equal(t, 0, ladder.schedule())
+	ladder.mu.Lock()
+	require.Empty(t, ladder.active)
+	ladder.mu.Unlock()
+}
+
+func TestLadderScheduleWhileCancelling(t *testing.T) {
+	snakeURL, release := newBlockingSnake(t)
+	defer close(release)
+	persistentServer := board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	runner := newGameRunner(persistentServer, 1, 10)
+	ladder := newLadder(LadderConfig{
+		Snakes: []Player{
+			{Name: "one", URL: newMovingSnake(t)},
+			{Name: "two", URL: newMovingSnake(t)},
+			{Name: "three", URL: newMovingSnake(t)},
+			{Name: "four", URL: newMovingSnake(t)},
+		},
+		MaxConcurrentGames: 1,
+		Timeout:            5000,
+	}.withDefaults(), runner)
+
+	// Hold up the game end listeners for the cancelled game, until the ladder has scheduled another game
+	cancelling, proceed := make(chan struct{}), make(chan struct{})
+	persistentServer.OnGameEnd(func(summary board.GameSummary, events []board.GameEvent) {
+		if summary.Game.Status == board.GameStatusCancelled {
+			close(cancelling)
+			<-proceed
+		}
+	})
+	persistentServer.OnGameEnd(ladder.recordResult)
+
+	// Ladder games wait in the queue behind a game that doesn't finish, so that they are cancelled from the queue
+	require.NoError(t, runner.submit(newTestGame(t, snakeURL)))
+	require.Equal(t, 1, ladder.schedule())
+	ladder.mu.Lock()
+	var gameID string
+	for id := range ladder.active {
+		gameID = id
+	}
+	ladder.config.MaxConcurrentGames = 2
+	ladder.mu.Unlock()
+
+	cancelled := make(chan bool)
+	go func() {
+		cancelled <- runner.cancel(gameID)
+	}()
+	<-cancelling
+
+	scheduled := make(chan int)
+	go func() {
+		scheduled <- ladder.schedule()
+	}()
+	select {
+	case started := <-scheduled:
+		require.Equal(t, 1, started)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the ladder couldn't schedule a game while a game was being cancelled")
+	}
+	close(proceed)
+	require.True(t, <-cancelled)
+
+	ladder.mu.Lock()
+	require.Len(t, ladder.active, 1)
+	require.NotContains(t, ladder.active, gameID)
+	ladder.mu.Unlock()
+}
+
+func TestLadderReleasesFailedQueuedGames(t *testing.T) {
+	snakeURL, release := newBlockingSnake(t)
+	persistentServer := board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	runner := newGameRunner(persistentServer, 1, 10)
+	ladder := newLadder(LadderConfig{
+		Snakes: []Player{
+			{Name: "one", URL: newMovingSnake(t)},
+			{Name: "two", URL: newMovingSnake(t)},
+		},
+		Timeout: 5000,
+	}.withDefaults(), runner)
+	persistentServer.OnGameEnd(ladder.recordResult)
+	runner.onGameDone = ladder.release
+
+	// The ladder game waits in the queue behind a game that doesn't finish until released
+	running := newTestGame(t, snakeURL)
+	require.NoError(t, runner.submit(running))
+	require.Equal(t, 1, ladder.schedule())
+	ladder.mu.Lock()
+	var gameID string
+	for id := range ladder.active {
+		gameID = id
+	}
+	ladder.mu.Unlock()
+	requireGameStatus(t, persistentServer, gameID, board.GameStatusQueued)
+
+	// Ending the queued game without a ladder result means it can't be started, and never reports a result
+	persistentServer.SendEvent(gameID, board.GameEvent{
+		EventType: board.EVENT_TYPE_GAME_END,
+		Data:      board.Game{ID: gameID, Status: board.GameStatusError},
+	})
+	close(release)
+
+	require.Eventually(t, func() bool {
+		ladder.mu.Lock()
+		defer ladder.mu.Unlock()
+		return len(ladder.active) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 0, runner.queuePosition(gameID))
+}
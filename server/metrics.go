@@ -0,0 +1,182 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/BattlesnakeOfficial/rules/engine"
+)
+
+// The upper bounds, in seconds, of the buckets in the move latency histograms.
+var moveLatencyBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// Snake names are chosen by callers, so only this many snakes get their own label, to keep the number of series bounded.
+// The moves of any other snakes are counted together under the otherSnakesLabel.
+const (
+	maxSnakeLabels   = 100
+	otherSnakesLabel = "other"
+)
+
+// Counts what the server and its games are doing, and writes it out in the Prometheus text format.
+// Gauges such as the number of active games are read when the metrics are written, rather than tracked here.
+type serverMetrics struct {
+	mu               sync.Mutex
+	gamesStarted     map[string]float64 // labels to count
+	gamesEnded       map[string]float64
+	moveLatency      map[string]*histogram
+	moveTimeouts     map[string]float64
+	moveStatusCodes  map[string]float64
+	moveInvalidMoves map[string]float64
+	snakeLabels      map[string]bool // the snake names that have their own label
+	maxSnakeLabels   int
+}
+
+type histogram struct {
+	buckets []float64 // cumulative counts, one for each of moveLatencyBuckets
+	sum     float64
+	count   float64
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		gamesStarted:     make(map[string]float64),
+		gamesEnded:       make(map[string]float64),
+		moveLatency:      make(map[string]*histogram),
+		moveTimeouts:     make(map[string]float64),
+		moveStatusCodes:  make(map[string]float64),
+		moveInvalidMoves: make(map[string]float64),
+		snakeLabels:      make(map[string]bool),
+		maxSnakeLabels:   maxSnakeLabels,
+	}
+}
+
+// Count a game that has started running.
+func (metrics *serverMetrics) gameStarted(ruleset string, mapName string) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	metrics.gamesStarted[formatLabels("ruleset", ruleset, "map", mapName)]++
+}
+
+// Count a game that has ended, by its final status. It is registered with PersistentBoardServer.OnGameEnd.
+func (metrics *serverMetrics) gameEnded(summary board.GameSummary, events []board.GameEvent) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	metrics.gamesEnded[formatLabels("ruleset", summary.Game.RulesetName, "map", summary.Game.Map, "status", summary.Game.Status)]++
+}
+
+// Record the result of a move request. It is called from the move observer of every server game.
+func (metrics *serverMetrics) moveObserved(snakeState engine.SnakeState) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	snakeName := metrics.snakeLabelLocked(snakeState.Name)
+	snake := formatLabels("snake", snakeName)
+	latency, ok := metrics.moveLatency[snake]
+	if !ok {
+		latency = &histogram{buckets: make([]float64, len(moveLatencyBuckets))}
+		metrics.moveLatency[snake] = latency
+	}
+	seconds := snakeState.Latency.Seconds()
+	for i, bound := range moveLatencyBuckets {
+		if seconds <= bound {
+			latency.buckets[i]++
+		}
+	}
+	latency.sum += seconds
+	latency.count++
+
+	if snakeState.ErrorCategory() == engine.MoveErrorTimeout {
+		metrics.moveTimeouts[snake]++
+	}
+	if snakeState.StatusCode != 0 && snakeState.StatusCode != http.StatusOK {
+		metrics.moveStatusCodes[formatLabels("snake", snakeName, "code", strconv.Itoa(snakeState.StatusCode))]++
+	}
+	if snakeState.InvalidMove {
+		metrics.moveInvalidMoves[snake]++
+	}
+}
+
+// The label value for a snake, which is its name until the snakes with their own label run out.
+// Must be called with the lock held.
+func (metrics *serverMetrics) snakeLabelLocked(name string) string {
+	if metrics.snakeLabels[name] {
+		return name
+	}
+	if len(metrics.snakeLabels) >= metrics.maxSnakeLabels {
+		return otherSnakesLabel
+	}
+	metrics.snakeLabels[name] = true
+	return name
+}
+
+// Write every metric, along with the active games and subscribers at the moment.
+func (metrics *serverMetrics) writeTo(w io.Writer, running int, queued int, subscribers int) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	writeMetric(w, "battlesnake_games_started_total", "counter", "Games started, by ruleset and map.", metrics.gamesStarted)
+	writeMetric(w, "battlesnake_games_ended_total", "counter", "Games that have completed, been cancelled or failed, by ruleset, map and status.", metrics.gamesEnded)
+	writeMetric(w, "battlesnake_games_active", "gauge", "Games that are running or queued.", map[string]float64{
+		formatLabels("status", board.GameStatusRunning): float64(running),
+		formatLabels("status", board.GameStatusQueued):  float64(queued),
+	})
+	writeMetric(w, "battlesnake_event_subscribers", "gauge", "Open websocket and server-sent event subscriptions to games.", map[string]float64{"": float64(subscribers)})
+
+	fmt.Fprintf(w, "# HELP battlesnake_move_latency_seconds Time taken by each snake to respond to move requests.\n")
+	fmt.Fprintf(w, "# TYPE battlesnake_move_latency_seconds histogram\n")
+	for _, labels := range sortedKeys(metrics.moveLatency) {
+		latency := metrics.moveLatency[labels]
+		for i, bound := range moveLatencyBuckets {
+			fmt.Fprintf(w, "battlesnake_move_latency_seconds_bucket{%s,le=\"%s\"} %s\n", labels, formatValue(bound), formatValue(latency.buckets[i]))
+		}
+		fmt.Fprintf(w, "battlesnake_move_latency_seconds_bucket{%s,le=\"+Inf\"} %s\n", labels, formatValue(latency.count))
+		fmt.Fprintf(w, "battlesnake_move_latency_seconds_sum{%s} %s\n", labels, formatValue(latency.sum))
+		fmt.Fprintf(w, "battlesnake_move_latency_seconds_count{%s} %s\n", labels, formatValue(latency.count))
+	}
+
+	writeMetric(w, "battlesnake_move_timeouts_total", "counter", "Move requests that timed out, by snake.", metrics.moveTimeouts)
+	writeMetric(w, "battlesnake_move_bad_status_total", "counter", "Move responses with a status code other than 200, by snake and status code.", metrics.moveStatusCodes)
+	writeMetric(w, "battlesnake_move_invalid_total", "counter", "Move responses with a move other than up, down, left or right, by snake.", metrics.moveInvalidMoves)
+}
+
+func writeMetric(w io.Writer, name string, metricType string, help string, values map[string]float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+	for _, labels := range sortedKeys(values) {
+		if labels == "" {
+			fmt.Fprintf(w, "%s %s\n", name, formatValue(values[labels]))
+		} else {
+			fmt.Fprintf(w, "%s{%s} %s\n", name, labels, formatValue(values[labels]))
+		}
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Format label names and values, given in pairs, as they appear between the braces of a sample.
+func formatLabels(namesAndValues ...string) string {
+	var labels []string
+	for i := 0; i+1 < len(namesAndValues); i += 2 {
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, namesAndValues[i], labelValueEscaper.Replace(namesAndValues[i+1])))
+	}
+	return strings.Join(labels, ",")
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
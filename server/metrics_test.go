@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/BattlesnakeOfficial/rules/engine"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerMetrics(t *testing.T) {
+	metrics := newServerMetrics()
+	metrics.gameStarted("standard", "standard")
+	metrics.gameStarted("standard", "standard")
+	metrics.gameEnded(board.GameSummary{Game: board.Game{RulesetName: "standard", Map: "standard", Status: board.GameStatusCancelled}}, nil)
+
+	timeout := &url.Error{Op: "Post", URL: "http://example.com/move", Err: context.DeadlineExceeded}
+	metrics.moveObserved(engine.SnakeState{Name: "fast", StatusCode: 200, Latency: 20 * time.Millisecond})
+	metrics.moveObserved(engine.SnakeState{Name: "fast", StatusCode: 200, Latency: 300 * time.Millisecond, InvalidMove: true})
+	metrics.moveObserved(engine.SnakeState{Name: "slow", Latency: 500 * time.Millisecond, Error: timeout})
+	metrics.moveObserved(engine.SnakeState{Name: `"quoted"`, StatusCode: 500, Latency: 5 * time.Millisecond})
+
+	var out strings.Builder
+	metrics.writeTo(&out, 1, 2, 3)
+	lines := strings.Split(out.String(), "\n")
+
+	for _, expected := range []string{
+		`# TYPE battlesnake_games_started_total counter`,
+		`battlesnake_games_started_total{ruleset="standard",map="standard"} 2`,
+		`battlesnake_games_ended_total{ruleset="standard",map="standard",status="cancelled"} 1`,
+		`battlesnake_games_active{status="running"} 1`,
+		`battlesnake_games_active{status="queued"} 2`,
+		`battlesnake_event_subscribers 3`,
+		`# TYPE battlesnake_move_latency_seconds histogram`,
+		`battlesnake_move_latency_seconds_bucket{snake="fast",le="0.025"} 1`,
+		`battlesnake_move_latency_seconds_bucket{snake="fast",le="0.5"} 2`,
+		`battlesnake_move_latency_seconds_bucket{snake="fast",le="+Inf"} 2`,
+		`battlesnake_move_latency_seconds_sum{snake="fast"} 0.32`,
+		`battlesnake_move_latency_seconds_count{snake="fast"} 2`,
+		`battlesnake_move_timeouts_total{snake="slow"} 1`,
+		`battlesnake_move_bad_status_total{snake="\"quoted\"",code="500"} 1`,
+		`battlesnake_move_invalid_total{snake="fast"} 1`,
+	} {
+		require.Contains(t, lines, expected)
+	}
+	require.NotContains(t, out.String(), `battlesnake_move_timeouts_total{snake="fast"}`)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	persistentServer = board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	runner = newGameRunner(persistentServer, 1, 1)
+	gameMetrics = newServerMetrics()
+	runner.metrics = gameMetrics
+	persistentServer.OnGameEnd(gameMetrics.gameEnded)
+
+	ended := make(chan struct{})
+	persistentServer.OnGameEnd(func(summary board.GameSummary, events []board.GameEvent) {
+		close(ended)
+	})
+	require.NoError(t, runner.submit(newTestGame(t, newMovingSnake(t))))
+	<-ended
+
+	w := httptest.NewRecorder()
+	metricsHandler(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, 200, w.Code)
+	require.Contains(t, w.Body.String(), `battlesnake_games_started_total{ruleset="standard",map="standard"} 1`)
+	require.Contains(t, w.Body.String(), `battlesnake_games_ended_total{ruleset="standard",map="standard",status="complete"} 1`)
+	require.Contains(t, w.Body.String(), `battlesnake_move_latency_seconds_count{snake="snake"}`)
+}
+
+func TestServerMetricsSnakeLabels(t *testing.T) {
+	metrics := newServerMetrics()
+	metrics.maxSnakeLabels = 2
+	for _, name := range []string{"one", "two", "three", "four", "one"} {
+		metrics.moveObserved(engine.SnakeState{Name: name, StatusCode: 500, Latency: 10 * time.Millisecond})
+	}
+
+	var out strings.Builder
+	metrics.writeTo(&out, 0, 0, 0)
+	lines := strings.Split(out.String(), "\n")
+
+	// Snakes seen after the labels run out are counted together
+	for _, expected := range []string{
+		`battlesnake_move_latency_seconds_count{snake="one"} 2`,
+		`battlesnake_move_latency_seconds_count{snake="two"} 1`,
+		`battlesnake_move_latency_seconds_count{snake="other"} 2`,
+		`battlesnake_move_bad_status_total{snake="other",code="500"} 2`,
+	} {
+		require.Contains(t, lines, expected)
+	}
+	require.NotContains(t, out.String(), `snake="three"`)
+}
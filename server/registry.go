@@ -0,0 +1,327 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/BattlesnakeOfficial/rules/client"
+	"github.com/google/uuid"
+)
+
+const snakesCollection = "snakes"
+
+var (
+	errSnakeNotFound  = errors.New("snake not found")
+	errSnakeNameTaken = errors.New("a snake with that name is already registered")
+)
+
+// A snake registered with the server, which can be used in games by its ID instead of its name and URL.
+type RegisteredSnake struct {
+	ID          string                        `json:"id"`
+	Name        string                        `json:"name"`
+	URL         string                        `json:"url"`
+	Owner       string                        `json:"owner"`
+	OwnerKeyID  string                        `json:"ownerKeyId,omitempty"` // the API key that registered the snake
+	Tags        []string                      `json:"tags"`
+	Metadata    *client.SnakeMetadataResponse `json:"metadata,omitempty"` // from the last successful ping
+	Online      bool                          `json:"online"`
+	LastChecked time.Time                     `json:"lastChecked"`
+	Created     time.Time                     `json:"created"`
+	Updated     time.Time                     `json:"updated"`
+}
+
+// The fields that can be set when registering or updating a snake.
+type SnakeRegistration struct {
+	Name  string   `json:"name"`
+	URL   string   `json:"url"`
+	Owner string   `json:"owner"`
+	Tags  []string `json:"tags"`
+}
+
+func (registration SnakeRegistration) Validate() error {
+	if strings.TrimSpace(registration.Name) == "" {
+		return &ConfigError{Field: "name", Message: "a name is required"}
+	}
+	if u, err := url.ParseRequestURI(registration.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return &ConfigError{Field: "url", Message: fmt.Sprintf("%q is not a valid http(s) URL", registration.URL)}
+	}
+	return nil
+}
+
+// Filters for listing registered snakes. Empty fields match every snake.
+type SnakeFilter struct {
+	Owner      string
+	Tag        string
+	OnlineOnly bool
+}
+
+func (filter SnakeFilter) matches(snake RegisteredSnake) bool {
+	if filter.Owner != "" && filter.Owner != snake.Owner {
+		return false
+	}
+	if filter.OnlineOnly && !snake.Online {
+		return false
+	}
+	if filter.Tag != "" {
+		for _, tag := range snake.Tags {
+			if tag == filter.Tag {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Keeps the registered snakes in the server's record store, and periodically pings them to
+// keep their metadata and online status up to date.
+type snakeRegistry struct {
+	store      board.RecordStore
+	httpClient *http.Client
+
+	mu sync.Mutex // held while changing snakes, so that concurrent updates don't overwrite each other
+}
+
+func newSnakeRegistry(store board.RecordStore) *snakeRegistry {
+	return &snakeRegistry{
+		store:      store,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Add a new snake to the registry, and ping it in the background to fetch its metadata.
+// The owner key ID is empty when keys aren't required.
+func (registry *snakeRegistry) register(registration SnakeRegistration, ownerKeyID string) (RegisteredSnake, error) {
+	if err := registration.Validate(); err != nil {
+		return RegisteredSnake{}, err
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if err := registry.checkNameLocked("", registration.Name); err != nil {
+		return RegisteredSnake{}, err
+	}
+	now := time.Now()
+	snake := RegisteredSnake{
+		ID:         uuid.New().String(),
+		OwnerKeyID: ownerKeyID,
+		Created:    now,
+	}
+	snake.apply(registration, now)
+	if err := registry.store.PutRecord(snakesCollection, snake.ID, snake); err != nil {
+		return RegisteredSnake{}, err
+	}
+
+	go registry.ping(snake.ID)
+	return snake, nil
+}
+
+// Replace the registration details for a snake. Changing the URL pings the snake again.
+func (registry *snakeRegistry) update(snakeID string, registration SnakeRegistration) (RegisteredSnake, error) {
+	if err := registration.Validate(); err != nil {
+		return RegisteredSnake{}, err
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	snake, err := registry.get(snakeID)
+	if err != nil {
+		return RegisteredSnake{}, err
+	}
+	if err := registry.checkNameLocked(snakeID, registration.Name); err != nil {
+		return RegisteredSnake{}, err
+	}
+	urlChanged := snake.URL != registration.URL
+	snake.apply(registration, time.Now())
+	if urlChanged {
+		snake.Online = false
+	}
+	if err := registry.store.PutRecord(snakesCollection, snake.ID, snake); err != nil {
+		return RegisteredSnake{}, err
+	}
+
+	if urlChanged {
+		go registry.ping(snake.ID)
+	}
+	return snake, nil
+}
+
+func (registry *snakeRegistry) delete(snakeID string) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if _, err := registry.get(snakeID); err != nil {
+		return err
+	}
+	return registry.store.DeleteRecord(snakesCollection, snakeID)
+}
+
+func (registry *snakeRegistry) get(snakeID string) (RegisteredSnake, error) {
+	var snake RegisteredSnake
+	err := registry.store.GetRecord(snakesCollection, snakeID, &snake)
+	if errors.Is(err, board.ErrRecordNotFound) {
+		return RegisteredSnake{}, fmt.Errorf("%w: %s", errSnakeNotFound, snakeID)
+	}
+	return snake, err
+}
+
+// List the registered snakes matching the filter, sorted by name.
+func (registry *snakeRegistry) list(filter SnakeFilter) ([]RegisteredSnake, error) {
+	snakeIDs, err := registry.store.ListRecords(snakesCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	snakes := make([]RegisteredSnake, 0, len(snakeIDs))
+	for _, snakeID := range snakeIDs {
+		snake, err := registry.get(snakeID)
+		if errors.Is(err, errSnakeNotFound) {
+			// Deleted since it was listed
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if filter.matches(snake) {
+			snakes = append(snakes, snake)
+		}
+	}
+	sort.Slice(snakes, func(i, j int) bool {
+		return snakes[i].Name < snakes[j].Name
+	})
+	return snakes, nil
+}
+
+// Look up registered snakes to use as players in a game.
+func (registry *snakeRegistry) players(snakeIDs []string) ([]Player, error) {
+	players := make([]Player, 0, len(snakeIDs))
+	for _, snakeID := range snakeIDs {
+		snake, err := registry.get(snakeID)
+		if err != nil {
+			return nil, err
+		}
+		players = append(players, Player{Name: snake.Name, URL: snake.URL})
+	}
+	return players, nil
+}
+
+// Ping every registered snake each interval, until the context is cancelled.
+func (registry *snakeRegistry) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		registry.pingAll()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (registry *snakeRegistry) pingAll() {
+	snakes, err := registry.list(SnakeFilter{})
+	if err != nil {
+		log.Printf("Unable to list registered snakes: %v", err)
+		return
+	}
+	var wg sync.WaitGroup
+	for _, snake := range snakes {
+		wg.Add(1)
+		go func(snakeID string) {
+			defer wg.Done()
+			registry.ping(snakeID)
+		}(snake.ID)
+	}
+	wg.Wait()
+}
+
+// Request the snake's metadata from its index URL, and record whether it responded.
+func (registry *snakeRegistry) ping(snakeID string) {
+	snake, err := registry.get(snakeID)
+	if err != nil {
+		return
+	}
+	metadata, err := fetchSnakeMetadata(registry.httpClient, snake.URL)
+	if err != nil {
+		log.Printf("Snake %v (%v) is offline: %v", snake.Name, snake.URL, err)
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	// Re-read the snake, in case it was changed or deleted during the request
+	current, getErr := registry.get(snakeID)
+	if getErr != nil || current.URL != snake.URL {
+		return
+	}
+	current.Online = err == nil
+	current.LastChecked = time.Now()
+	if err == nil {
+		current.Metadata = metadata
+	}
+	if err := registry.store.PutRecord(snakesCollection, current.ID, current); err != nil {
+		log.Printf("Unable to save snake %v: %v", current.ID, err)
+	}
+}
+
+// Request a snake's metadata from its index URL, which also checks that the snake is online.
+func fetchSnakeMetadata(httpClient *http.Client, snakeURL string) (*client.SnakeMetadataResponse, error) {
+	res, err := httpClient.Get(snakeURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	var metadata client.SnakeMetadataResponse
+	if err := json.Unmarshal(body, &metadata); err != nil {
+		return nil, fmt.Errorf("invalid metadata response: %w", err)
+	}
+	return &metadata, nil
+}
+
+// Names must be unique, because ratings are keyed by snake name.
+// Must be called with the lock held.
+func (registry *snakeRegistry) checkNameLocked(snakeID string, name string) error {
+	snakes, err := registry.list(SnakeFilter{})
+	if err != nil {
+		return err
+	}
+	for _, snake := range snakes {
+		if snake.ID != snakeID && strings.EqualFold(snake.Name, name) {
+			return errSnakeNameTaken
+		}
+	}
+	return nil
+}
+
+func (snake *RegisteredSnake) apply(registration SnakeRegistration, now time.Time) {
+	snake.Name = strings.TrimSpace(registration.Name)
+	snake.URL = registration.URL
+	snake.Owner = registration.Owner
+	snake.Tags = registration.Tags
+	if snake.Tags == nil {
+		snake.Tags = []string{}
+	}
+	snake.Updated = now
+}
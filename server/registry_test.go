@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnakeRegistry(t *testing.T) {
+	snakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"apiversion": "1", "author": "me", "color": "#123456"}`))
+	}))
+	defer snakeServer.Close()
+
+	registry := newSnakeRegistry(board.NewMemoryGameStore())
+
+	var configErr *ConfigError
+	_, err := registry.register(SnakeRegistration{Name: "snake", URL: "not a url"}, "")
+	require.ErrorAs(t, err, &configErr)
+	require.Equal(t, "url", configErr.Field)
+
+	snake, err := registry.register(SnakeRegistration{Name: "snake", URL: snakeServer.URL, Owner: "me", Tags: []string{"fast"}}, "")
+	require.NoError(t, err)
+	require.NotEmpty(t, snake.ID)
+	_, err = registry.register(SnakeRegistration{Name: "Snake", URL: snakeServer.URL}, "")
+	require.ErrorIs(t, err, errSnakeNameTaken)
+	other, err := registry.register(SnakeRegistration{Name: "other", URL: "http://localhost:1"}, "")
+	require.NoError(t, err)
+
+	// Snakes are pinged in the background when they are registered
+	require.Eventually(t, func() bool {
+		snake, err := registry.get(snake.ID)
+		return err == nil && snake.Online && snake.Metadata != nil && snake.Metadata.Author == "me"
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		other, err := registry.get(other.ID)
+		return err == nil && !other.LastChecked.IsZero() && !other.Online
+	}, 5*time.Second, 10*time.Millisecond)
+
+	snakes, err := registry.list(SnakeFilter{Tag: "fast"})
+	require.NoError(t, err)
+	require.Len(t, snakes, 1)
+	require.Equal(t, snake.ID, snakes[0].ID)
+	snakes, err = registry.list(SnakeFilter{OnlineOnly: true})
+	require.NoError(t, err)
+	require.Len(t, snakes, 1)
+	snakes, err = registry.list(SnakeFilter{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"other", "snake"}, []string{snakes[0].Name, snakes[1].Name})
+
+	players, err := registry.players([]string{other.ID, snake.ID})
+	require.NoError(t, err)
+	require.Equal(t, []Player{{Name: "other", URL: "http://localhost:1"}, {Name: "snake", URL: snakeServer.URL}}, players)
+	_, err = registry.players([]string{"missing"})
+	require.ErrorIs(t, err, errSnakeNotFound)
+
+	_, err = registry.update(other.ID, SnakeRegistration{Name: "snake", URL: snakeServer.URL})
+	require.ErrorIs(t, err, errSnakeNameTaken)
+	updated, err := registry.update(other.ID, SnakeRegistration{Name: "renamed", URL: snakeServer.URL, Tags: []string{"fast"}})
+	require.NoError(t, err)
+	require.True(t, other.Created.Equal(updated.Created))
+	require.Eventually(t, func() bool {
+		updated, err := registry.get(other.ID)
+		return err == nil && updated.Online
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, registry.delete(snake.ID))
+	require.ErrorIs(t, registry.delete(snake.ID), errSnakeNotFound)
+	snakes, err = registry.list(SnakeFilter{})
+	require.NoError(t, err)
+	require.Len(t, snakes, 1)
+	require.Equal(t, "renamed", snakes[0].Name)
+}
+
+func TestSnakeHandlersRequireOwner(t *testing.T) {
+	store := board.NewMemoryGameStore()
+	registry = newSnakeRegistry(store)
+	apiKeys = newAPIKeyManager(store, true, true, "ADMIN_KEY")
+	_, alice, err := apiKeys.createKey(CreateAPIKeyRequest{Name: "alice"})
+	require.NoError(t, err)
+	_, bob, err := apiKeys.createKey(CreateAPIKeyRequest{Name: "bob"})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/snakes", apiKeys.requireKey(registerSnakeHandler)).Methods("POST")
+	router.HandleFunc("/snakes/{snakeID}", apiKeys.requireKey(updateSnakeHandler)).Methods("PUT")
+	router.HandleFunc("/snakes/{snakeID}", apiKeys.requireKey(deleteSnakeHandler)).Methods("DELETE")
+	request := func(method string, target string, apiKey string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+apiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("POST", "/snakes", alice, `{"name": "snake", "url": "http://localhost:1"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var snake RegisteredSnake
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &snake))
+
+	// Other keys can't change or delete the snake, but the key that registered it and admin keys can
+	body := `{"name": "renamed", "url": "http://localhost:1"}`
+	require.Equal(t, http.StatusForbidden, request("PUT", "/snakes/"+snake.ID, bob, body).Code)
+	require.Equal(t, http.StatusForbidden, request("DELETE", "/snakes/"+snake.ID, bob, "").Code)
+	require.Equal(t, http.StatusOK, request("PUT", "/snakes/"+snake.ID, alice, body).Code)
+	require.Equal(t, http.StatusOK, request("PUT", "/snakes/"+snake.ID, "ADMIN_KEY", body).Code)
+	require.Equal(t, http.StatusNotFound, request("DELETE", "/snakes/missing", bob, "").Code)
+	require.Equal(t, http.StatusNoContent, request("DELETE", "/snakes/"+snake.ID, alice, "").Code)
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/BattlesnakeOfficial/rules/engine"
+)
+
+var (
+	errQueueFull    = errors.New("the game queue is full, try again later")
+	errShuttingDown = errors.New("the server is shutting down, try again later")
+)
+
+// Runs games in the background, with at most maxConcurrent games running at once.
+// Games beyond that wait in a queue of at most maxQueued games, and keep the "queued" status until they start.
+// Every game is tracked until it finishes, so that it can be cancelled.
+type gameRunner struct {
+	persistentServer *board.PersistentBoardServer
+	maxConcurrent    int
+	maxQueued        int
+	metrics          *serverMetrics       // optional, counts the games started and the moves made in them
+	diagnostics      *diagnosticsRecorder // optional, records every move request for debugging snakes
+	onGameDone       func(gameID string)  // optional, called once a game won't run any further, however it ended
+
+	mu      sync.Mutex
+	queue   []*serverGame
+	running map[string]context.CancelFunc
+	stopped bool           // set once the server starts shutting down, after which no more games start
+	games   sync.WaitGroup // the running games
+}
+
+func newGameRunner(persistentServer *board.PersistentBoardServer, maxConcurrent int, maxQueued int) *gameRunner {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	return &gameRunner{
+		persistentServer: persistentServer,
+		maxConcurrent:    maxConcurrent,
+		maxQueued:        maxQueued,
+		running:          make(map[string]context.CancelFunc),
+	}
+}
+
+// Register a game with the persistent server and either start it straight away or add it to the queue.
+// Returns errQueueFull, without registering the game, if there is no room in the queue,
+// or errShuttingDown once the runner has been stopped.
+func (runner *gameRunner) submit(game *serverGame) error {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+
+	if runner.stopped {
+		return errShuttingDown
+	}
+
+	if len(runner.running) < runner.maxConcurrent {
+		game.register(runner.persistentServer, board.GameStatusRunning)
+		runner.startLocked(game)
+		return nil
+	}
+	if len(runner.queue) >= runner.maxQueued {
+		return errQueueFull
+	}
+
+	game.register(runner.persistentServer, board.GameStatusQueued)
+	runner.queue = append(runner.queue, game)
+	return nil
+}
+
+// The 1-based position of a game in the queue, or 0 if the game isn't queued.
+func (runner *gameRunner) queuePosition(gameID string) int {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+
+	for i, game := range runner.queue {
+		if game.GameID() == gameID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// The number of games running and waiting in the queue.
+func (runner *gameRunner) counts() (int, int) {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	return len(runner.running), len(runner.queue)
+}
+
+// Stop a running game, or remove a game from the queue.
+// Returns false if the game isn't running or queued on this server.
+func (runner *gameRunner) cancel(gameID string) bool {
+	runner.mu.Lock()
+	if cancel, ok := runner.running[gameID]; ok {
+		runner.mu.Unlock()
+		cancel()
+		return true
+	}
+
+	cancelled := false
+	for i, game := range runner.queue {
+		if game.GameID() == gameID {
+			runner.queue = append(runner.queue[:i], runner.queue[i+1:]...)
+			cancelled = true
+			break
+		}
+	}
+	runner.mu.Unlock()
+	if !cancelled {
+		return false
+	}
+
+	// The game end listeners can take their own locks, so they're called without holding the runner lock
+	runner.endWithStatus(gameID, board.GameStatusCancelled)
+	runner.gameDone(gameID)
+	return true
+}
+
+// Stop accepting games and stop starting queued games, such as when the server is shutting down.
+// Queued games are left queued, so that they are checkpointed along with any games still running.
+func (runner *gameRunner) stop() {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	runner.stopped = true
+}
+
+// Wait for the running games to finish, or for the context to be done.
+// Returns the context error if games were still running.
+func (runner *gameRunner) drain(ctx context.Context) error {
+	drained := make(chan struct{})
+	go func() {
+		runner.games.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Must be called with the lock held.
+func (runner *gameRunner) startLocked(game *serverGame) {
+	gameID := game.GameID()
+	ctx, cancel := context.WithCancel(context.Background())
+	runner.running[gameID] = cancel
+	if runner.metrics != nil {
+		runner.metrics.gameStarted(game.game.RulesetName, game.game.Map)
+	}
+	metrics, diagnostics := runner.metrics, runner.diagnostics
+	game.moveObserver = func(snakeState engine.SnakeState) {
+		if metrics != nil {
+			metrics.moveObserved(snakeState)
+		}
+		if diagnostics != nil {
+			diagnostics.moveObserved(gameID, snakeState)
+		}
+	}
+
+	runner.games.Add(1)
+	go func() {
+		defer runner.games.Done()
+		defer runner.finish(gameID)
+		defer cancel()
+
+		if _, err := game.Run(ctx); err != nil {
+			log.Printf("Error running game %v: %v", gameID, err)
+			runner.endWithStatus(gameID, board.GameStatusError)
+		}
+		log.Printf("Game %v has finished", gameID)
+		runner.gameDone(gameID)
+	}()
+}
+
+// Free up the slot used by a finished game, and start the next queued game in its place.
+func (runner *gameRunner) finish(gameID string) {
+	runner.mu.Lock()
+	var failed []string
+	delete(runner.running, gameID)
+	for !runner.stopped && len(runner.queue) > 0 && len(runner.running) < runner.maxConcurrent {
+		next := runner.queue[0]
+		runner.queue = runner.queue[1:]
+		if err := runner.persistentServer.SetGameStatus(next.GameID(), board.GameStatusRunning); err != nil {
+			log.Printf("Unable to start queued game %v: %v", next.GameID(), err)
+			failed = append(failed, next.GameID())
+			continue
+		}
+		runner.startLocked(next)
+	}
+	runner.mu.Unlock()
+
+	// As when cancelling, the game end listeners are called without holding the runner lock
+	for _, failedID := range failed {
+		runner.endWithStatus(failedID, board.GameStatusError)
+		runner.gameDone(failedID)
+	}
+}
+
+// Games that never run, or fail to run, don't send their own game end event, so send one
+// to stop them from being reported as running forever.
+func (runner *gameRunner) endWithStatus(gameID string, status string) {
+	game, err := runner.persistentServer.GetGame(gameID)
+	if err != nil {
+		return
+	}
+	if game.Status != board.GameStatusRunning && game.Status != board.GameStatusQueued {
+		return
+	}
+	endedGame := *game
+	endedGame.Status = status
+	runner.persistentServer.SendEvent(gameID, board.GameEvent{
+		EventType: board.EVENT_TYPE_GAME_END,
+		Data:      endedGame,
+	})
+}
+
+// Must be called without holding the lock, like the game end listeners.
+func (runner *gameRunner) gameDone(gameID string) {
+	if runner.onGameDone != nil {
+		runner.onGameDone(gameID)
+	}
+}
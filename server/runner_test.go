@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/stretchr/testify/require"
+)
+
+// A snake that doesn't answer move requests until released.
+func newBlockingSnake(t *testing.T) (string, chan struct{}) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/move" {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			w.Write([]byte(`{"move": "up"}`))
+			return
+		}
+		w.Write([]byte(`{"apiversion": "1"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, release
+}
+
+func newTestGame(t *testing.T, snakeURL string) *serverGame {
+	game, err := newServerGame(GameConfig{
+		Players: []Player{{Name: "snake", URL: snakeURL}},
+		Timeout: 5000,
+	}, apiSource)
+	require.NoError(t, err)
+	return game
+}
+
+func requireGameStatus(t *testing.T, persistentServer *board.PersistentBoardServer, gameID string, status string) {
+	require.Eventually(t, func() bool {
+		game, err := persistentServer.GetGame(gameID)
+		return err == nil && game.Status == status
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestGameRunnerQueue(t *testing.T) {
+	snakeURL, release := newBlockingSnake(t)
+	persistentServer := board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	runner := newGameRunner(persistentServer, 1, 1)
+
+	running := newTestGame(t, snakeURL)
+	require.NoError(t, runner.submit(running))
+	requireGameStatus(t, persistentServer, running.GameID(), board.GameStatusRunning)
+	require.Equal(t, 0, runner.queuePosition(running.GameID()))
+
+	queued := newTestGame(t, snakeURL)
+	require.NoError(t, runner.submit(queued))
+	requireGameStatus(t, persistentServer, queued.GameID(), board.GameStatusQueued)
+	require.Equal(t, 1, runner.queuePosition(queued.GameID()))
+
+	rejected := newTestGame(t, snakeURL)
+	require.ErrorIs(t, runner.submit(rejected), errQueueFull)
+	_, err := persistentServer.GetGame(rejected.GameID())
+	require.ErrorIs(t, err, board.ErrGameNotFound)
+
+	// Cancelling a queued game removes it without running it
+	require.True(t, runner.cancel(queued.GameID()))
+	requireGameStatus(t, persistentServer, queued.GameID(), board.GameStatusCancelled)
+	require.Equal(t, 0, runner.queuePosition(queued.GameID()))
+	require.False(t, runner.cancel(queued.GameID()))
+
+	// The next queued game starts once the running game has finished
+	next := newTestGame(t, snakeURL)
+	require.NoError(t, runner.submit(next))
+	require.Equal(t, 1, runner.queuePosition(next.GameID()))
+
+	require.True(t, runner.cancel(running.GameID()))
+	close(release)
+	requireGameStatus(t, persistentServer, running.GameID(), board.GameStatusCancelled)
+	require.Eventually(t, func() bool {
+		game, err := persistentServer.GetGame(next.GameID())
+		return err == nil && game.Status != board.GameStatusQueued
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 0, runner.queuePosition(next.GameID()))
+}
+
+func TestGameRunnerStopAndDrain(t *testing.T) {
+	snakeURL, release := newBlockingSnake(t)
+	store := board.NewMemoryGameStore()
+	persistentServer := board.NewPersistentBoardServer(store)
+	runner := newGameRunner(persistentServer, 1, 1)
+
+	running := newTestGame(t, snakeURL)
+	require.NoError(t, runner.submit(running))
+	queued := newTestGame(t, snakeURL)
+	require.NoError(t, runner.submit(queued))
+
+	runner.stop()
+	require.ErrorIs(t, runner.submit(newTestGame(t, snakeURL)), errShuttingDown)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, runner.drain(ctx), context.DeadlineExceeded)
+
+	// Queued games don't start once the runner has stopped
+	close(release)
+	require.NoError(t, runner.drain(context.Background()))
+	requireGameStatus(t, persistentServer, running.GameID(), board.GameStatusComplete)
+	requireGameStatus(t, persistentServer, queued.GameID(), board.GameStatusQueued)
+
+	// and are saved as aborted when the server restarts
+	require.NoError(t, persistentServer.Checkpoint())
+	restarted := board.NewPersistentBoardServer(store)
+	recovered, err := restarted.RecoverGames()
+	require.NoError(t, err)
+	require.Equal(t, 1, recovered)
+	requireGameStatus(t, restarted, queued.GameID(), board.GameStatusAborted)
+}
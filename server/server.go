@@ -0,0 +1,1027 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/BattlesnakeOfficial/rules/engine"
+	"github.com/BattlesnakeOfficial/rules/ratings"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/rs/cors"
+)
+
+var persistentServer *board.PersistentBoardServer
+var runner *gameRunner
+var leaderboard *ratings.Leaderboard
+var registry *snakeRegistry
+var webhooks *webhookNotifier
+var apiKeys *apiKeyManager
+var gameMetrics *serverMetrics
+var diagnostics *diagnosticsRecorder
+var publicURL string
+var boardURL string
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// The /play request body accepts the full game configuration, where only players are required.
+// Registered snakes can be added to the game by ID, after any players given by name and URL.
+// The webhooks are notified when this game ends, along with the global webhooks.
+type PlayRequest struct {
+	GameConfig
+	SnakeIDs []string `json:"snakeIds"`
+	Webhooks []string `json:"webhooks"`
+}
+
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type ListGamesResponse struct {
+	Games  []board.GameSummary `json:"games"`
+	Total  int                 `json:"total"`
+	Limit  int                 `json:"limit"`
+	Offset int                 `json:"offset"`
+}
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// The response to POST /play, with links to follow the game.
+// With ?wait=true it is only sent once the game has ended, and includes the result.
+type PlayResponse struct {
+	ID        string             `json:"id"`
+	Status    string             `json:"status"`
+	URL       string             `json:"url"`
+	EventsURL string             `json:"eventsUrl"` // websocket
+	BoardURL  string             `json:"boardUrl"`
+	ExportURL string             `json:"exportUrl"`
+	Result    *board.GameSummary `json:"result,omitempty"`
+}
+
+type CancelGameResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// The move requests made to a snake during a game, for debugging its failures.
+type SnakeDiagnosticsResponse struct {
+	GameID  string           `json:"gameId"`
+	SnakeID string           `json:"snakeId"`
+	Name    string           `json:"name"`
+	Moves   []MoveDiagnostic `json:"moves"`
+}
+
+type LeaderboardResponse struct {
+	Ratings []ratings.Rating `json:"ratings"`
+}
+
+type SnakeRatingResponse struct {
+	Rating  ratings.Rating         `json:"rating"`
+	History []ratings.RatingChange `json:"history"`
+}
+
+type ListSnakesResponse struct {
+	Snakes []RegisteredSnake `json:"snakes"`
+}
+
+type AddWebhookRequest struct {
+	URL string `json:"url"`
+}
+
+type ListWebhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+type ListWebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+type ListAPIKeysResponse struct {
+	Keys []APIKey `json:"keys"`
+}
+
+type CreateAPIKeyResponse struct {
+	Key    APIKey `json:"key"`
+	Secret string `json:"secret"` // only returned when the key is created
+}
+
+type IndexResponse struct {
+	Status string `json:"status"`
+}
+
+// Config for running the server, which is usually set by the flags and config file for `battlesnake server`.
+type Config struct {
+	ListenAddress      string
+	StorageBackend     string // memory, file or replit
+	StoragePath        string // the directory for the file storage backend
+	MaxConcurrentGames int
+	MaxQueuedGames     int
+	LadderConfigPath   string // optional
+	PublicURL          string // used for links to games
+	BoardURL           string
+	CORSOrigins        []string // "*" allows any origin
+	RequireAPIKeys     bool
+	PublicRead         bool
+	AdminKey           string
+	PingInterval       time.Duration // 0 to disable
+	CheckpointInterval time.Duration // 0 to disable
+	ShutdownTimeout    time.Duration
+}
+
+// Run the server until the context is done, then stop it gracefully.
+func Run(ctx context.Context, config Config) error {
+	publicURL = strings.TrimSuffix(config.PublicURL, "/")
+	boardURL = config.BoardURL
+
+	store, err := board.NewGameStore(config.StorageBackend, config.StoragePath)
+	if err != nil {
+		return fmt.Errorf("unable to create game store: %w", err)
+	}
+	apiKeys = newAPIKeyManager(store, config.RequireAPIKeys, config.PublicRead, config.AdminKey)
+	persistentServer = board.NewPersistentBoardServer(store)
+	runner = newGameRunner(persistentServer, config.MaxConcurrentGames, config.MaxQueuedGames)
+	gameMetrics = newServerMetrics()
+	runner.metrics = gameMetrics
+	persistentServer.OnGameEnd(gameMetrics.gameEnded)
+	diagnostics = newDiagnosticsRecorder(store)
+	runner.diagnostics = diagnostics
+	persistentServer.OnGameEnd(diagnostics.gameEnded)
+	leaderboard = ratings.NewLeaderboard(store)
+	persistentServer.OnGameEnd(func(summary board.GameSummary, events []board.GameEvent) {
+		if err := leaderboard.RecordGame(summary, events); err != nil {
+			log.Printf("Unable to update ratings for game %v: %v", summary.Game.ID, err)
+		}
+	})
+	var gameLadder *ladder
+	if config.LadderConfigPath != "" {
+		ladderConfig, err := loadLadderConfig(config.LadderConfigPath)
+		if err != nil {
+			return fmt.Errorf("unable to load ladder config: %w", err)
+		}
+		gameLadder = newLadder(ladderConfig, runner)
+		persistentServer.OnGameEnd(gameLadder.recordResult)
+		runner.onGameDone = gameLadder.release
+	}
+	webhooks = newWebhookNotifier(store, publicURL)
+	persistentServer.OnGameEnd(webhooks.gameEnded)
+	persistentServer.OnGameEnd(apiKeys.gameEnded)
+	registry = newSnakeRegistry(store)
+
+	// Save the games left running when the server last stopped, now that every listener can hear about them
+	recovered, err := persistentServer.RecoverGames()
+	if err != nil {
+		return fmt.Errorf("unable to recover interrupted games: %w", err)
+	}
+	if recovered > 0 {
+		log.Printf("Recovered %d games from before the server last stopped", recovered)
+	}
+
+	if gameLadder != nil {
+		go gameLadder.run(ctx)
+	}
+	if config.PingInterval > 0 {
+		go registry.run(ctx, config.PingInterval)
+	}
+	if config.CheckpointInterval > 0 {
+		go checkpointGames(ctx, config.CheckpointInterval)
+	}
+
+	corsHandler := cors.New(cors.Options{
+		AllowedOrigins: config.CORSOrigins,
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"*"},
+	})
+	// Browsers don't apply CORS to websockets, so check the origin when upgrading instead
+	upgrader.CheckOrigin = func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "" || corsHandler.OriginAllowed(r)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/play", apiKeys.requireKey(playHandler)).Methods("POST")
+	router.HandleFunc("/games", apiKeys.readAccess(listGamesHandler)).Methods("GET")
+	router.HandleFunc("/games/{gameID}", apiKeys.readAccess(gameHandler)).Methods("GET")
+	router.HandleFunc("/games/{gameID}", apiKeys.requireKey(cancelGameHandler)).Methods("DELETE")
+	router.HandleFunc("/games/{gameID}/cancel", apiKeys.requireKey(cancelGameHandler)).Methods("POST")
+	router.HandleFunc("/games/{gameID}/events", apiKeys.readAccess(eventsHandler)).Methods("GET")
+	router.HandleFunc("/games/{gameID}/export", apiKeys.readAccess(exportHandler)).Methods("GET")
+	router.HandleFunc("/games/{gameID}/snakes/{snakeID}/diagnostics", apiKeys.readAccess(snakeDiagnosticsHandler)).Methods("GET")
+	router.HandleFunc("/leaderboard", apiKeys.readAccess(leaderboardHandler)).Methods("GET")
+	router.HandleFunc("/leaderboard/{snake}", apiKeys.readAccess(snakeRatingHandler)).Methods("GET")
+	router.HandleFunc("/snakes", apiKeys.readAccess(listSnakesHandler)).Methods("GET")
+	router.HandleFunc("/snakes", apiKeys.requireKey(registerSnakeHandler)).Methods("POST")
+	router.HandleFunc("/snakes/{snakeID}", apiKeys.readAccess(snakeHandler)).Methods("GET")
+	router.HandleFunc("/snakes/{snakeID}", apiKeys.requireKey(updateSnakeHandler)).Methods("PUT")
+	router.HandleFunc("/snakes/{snakeID}", apiKeys.requireKey(deleteSnakeHandler)).Methods("DELETE")
+	router.HandleFunc("/webhooks", apiKeys.requireAdmin(listWebhooksHandler)).Methods("GET")
+	router.HandleFunc("/webhooks", apiKeys.requireAdmin(addWebhookHandler)).Methods("POST")
+	router.HandleFunc("/webhooks/deliveries", apiKeys.requireAdmin(listWebhookDeliveriesHandler)).Methods("GET")
+	router.HandleFunc("/webhooks/{webhookID}", apiKeys.requireAdmin(deleteWebhookHandler)).Methods("DELETE")
+	router.HandleFunc("/admin/keys", apiKeys.requireAdmin(listAPIKeysHandler)).Methods("GET")
+	router.HandleFunc("/admin/keys", apiKeys.requireAdmin(createAPIKeyHandler)).Methods("POST")
+	router.HandleFunc("/admin/keys/{keyID}", apiKeys.requireAdmin(deleteAPIKeyHandler)).Methods("DELETE")
+	router.HandleFunc("/metrics", apiKeys.readAccess(metricsHandler)).Methods("GET")
+	router.HandleFunc("/", indexHandler).Methods("GET")
+
+	httpServer := &http.Server{Addr: config.ListenAddress, Handler: corsHandler.Handler(router)}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+	log.Printf("Server is running on %s", config.ListenAddress)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	shutdown(httpServer, config.ShutdownTimeout)
+	return nil
+}
+
+// Stop accepting games and give the running games until the timeout to finish, while still serving them to viewers.
+// Games that are still running or queued after that are checkpointed, to be saved as aborted when the server restarts.
+func shutdown(httpServer *http.Server, timeout time.Duration) {
+	log.Printf("Shutting down, waiting up to %v for running games to finish", timeout)
+	runner.stop()
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := runner.drain(drainCtx); err != nil {
+		running, queued := runner.counts()
+		log.Printf("Stopping with %d games running and %d queued", running, queued)
+	}
+	if err := persistentServer.Checkpoint(); err != nil {
+		log.Printf("Unable to checkpoint games: %v", err)
+	}
+
+	// Failed deliveries aren't retried once the server is stopping, but the requests already being sent can finish
+	webhooksCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := webhooks.shutdown(webhooksCtx); err != nil {
+		log.Printf("Stopping before every webhook was delivered: %v", err)
+	}
+
+	closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(closeCtx); err != nil {
+		log.Printf("Error stopping HTTP server: %v", err)
+	}
+}
+
+// Checkpoint the running games every interval, until the context is cancelled.
+func checkpointGames(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := persistentServer.Checkpoint(); err != nil {
+				log.Printf("Unable to checkpoint games: %v", err)
+			}
+		}
+	}
+}
+
+func playHandler(w http.ResponseWriter, r *http.Request) {
+	var req PlayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_request", Message: err.Error()})
+		return
+	}
+
+	wait := false
+	if value := r.URL.Query().Get("wait"); value != "" {
+		var err error
+		if wait, err = strconv.ParseBool(value); err != nil {
+			writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_request", Field: "wait", Message: "wait must be true or false"})
+			return
+		}
+	}
+
+	if len(req.SnakeIDs) > 0 {
+		players, err := registry.players(req.SnakeIDs)
+		if errors.Is(err, errSnakeNotFound) {
+			writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_game_config", Field: "snakeIds", Message: err.Error()})
+			return
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("Error looking up snakes: %v", err), http.StatusInternalServerError)
+			return
+		}
+		req.Players = append(req.Players, players...)
+	}
+
+	if err := req.Validate(); err != nil {
+		writeGameConfigError(w, err)
+		return
+	}
+	// Without an admin key, webhooks can only be posted to public addresses, so that callers can't reach the server's own network
+	key, hasKey := apiKeyFromContext(r.Context())
+	publicOnly := !hasKey || !key.Admin
+	for _, webhookURL := range req.Webhooks {
+		validate := validateWebhookURL
+		if publicOnly {
+			validate = validatePublicWebhookURL
+		}
+		if err := validate(webhookURL); err != nil {
+			writeGameConfigError(w, err)
+			return
+		}
+	}
+
+	game, err := newServerGame(req.GameConfig, apiSource)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error playing game: %v", err), http.StatusInternalServerError)
+		return
+	}
+	gameID := game.GameID()
+	if hasKey && !apiKeys.reserveGame(key, gameID) {
+		writeError(w, http.StatusTooManyRequests, ErrorResponse{Error: "quota_exceeded", Message: fmt.Sprintf("API key %s already has %d games running or queued", key.Name, key.MaxConcurrentGames)})
+		return
+	}
+	webhooks.watchGame(gameID, req.Webhooks, publicOnly)
+	if err := runner.submit(game); err != nil {
+		if hasKey {
+			apiKeys.releaseGame(gameID)
+		}
+		webhooks.forgetGame(gameID)
+		code := "queue_full"
+		if errors.Is(err, errShuttingDown) {
+			code = "shutting_down"
+		}
+		writeError(w, http.StatusServiceUnavailable, ErrorResponse{Error: code, Message: err.Error()})
+		return
+	}
+
+	fmt.Printf("Game %v started\n", gameID)
+
+	response := newPlayResponse(gameID)
+	if wait {
+		summary, err := waitForGame(r.Context(), gameID)
+		if err != nil {
+			log.Printf("Stopped waiting for game %v: %v", gameID, err)
+			return
+		}
+		response.Status = summary.Game.Status
+		response.Result = &summary
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if game, err := persistentServer.GetGame(gameID); err == nil {
+		response.Status = game.Status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", response.URL)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func newPlayResponse(gameID string) PlayResponse {
+	gamePath := "/games/" + url.PathEscape(gameID)
+	return PlayResponse{
+		ID:        gameID,
+		URL:       publicURL + gamePath,
+		EventsURL: websocketURL(publicURL) + gamePath + "/events",
+		BoardURL:  fmt.Sprintf("%s?engine=%s&game=%s&autoplay=true", boardURL, url.QueryEscape(publicURL), url.QueryEscape(gameID)),
+		ExportURL: publicURL + gamePath + "/export",
+	}
+}
+
+func websocketURL(httpURL string) string {
+	if strings.HasPrefix(httpURL, "https://") {
+		return "wss://" + strings.TrimPrefix(httpURL, "https://")
+	}
+	return "ws://" + strings.TrimPrefix(httpURL, "http://")
+}
+
+// Block until a game ends, returning its summary, or until the context is done.
+func waitForGame(ctx context.Context, gameID string) (board.GameSummary, error) {
+	for {
+		// Only the game end event is needed, so skip the frames sent so far
+		sub, err := persistentServer.SubscribeToGame(gameID, math.MaxInt)
+		if err != nil {
+			return board.GameSummary{}, err
+		}
+		for open := true; open; {
+			select {
+			case <-ctx.Done():
+				sub.Close()
+				return board.GameSummary{}, ctx.Err()
+			case _, open = <-sub.Events():
+			}
+		}
+		sub.Close()
+		if !sub.Dropped() {
+			return persistentServer.GetSummary(gameID)
+		}
+	}
+}
+
+func gameHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gameID := vars["gameID"]
+
+	game, err := persistentServer.GetGame(gameID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Game          *board.Game `json:"game"`
+		QueuePosition int         `json:"queuePosition,omitempty"`
+	}{game, runner.queuePosition(gameID)})
+}
+
+// Handle DELETE /games/{gameID} and POST /games/{gameID}/cancel, which stop a running game.
+// The game ends with the "cancelled" status once the current turn has finished.
+func cancelGameHandler(w http.ResponseWriter, r *http.Request) {
+	gameID := mux.Vars(r)["gameID"]
+
+	game, err := persistentServer.GetGame(gameID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrorResponse{Error: "not_found", Message: err.Error()})
+		return
+	}
+	if key, ok := apiKeyFromContext(r.Context()); ok && !apiKeys.canManageGame(key, gameID) {
+		writeError(w, http.StatusForbidden, ErrorResponse{Error: "forbidden", Message: "games can only be cancelled by the API key that started them"})
+		return
+	}
+	if !runner.cancel(gameID) {
+		writeError(w, http.StatusConflict, ErrorResponse{Error: "not_running", Message: fmt.Sprintf("game %s is %s", gameID, game.Status)})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(CancelGameResponse{ID: gameID, Status: board.GameStatusCancelled})
+}
+
+// Handle GET /games, which lists active and stored games.
+// Supports filtering with the status, source, map, ruleset, snake, from and to (RFC 3339 times) query parameters,
+// and pagination with limit and offset.
+func listGamesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := board.GameFilter{
+		Status:    query.Get("status"),
+		Source:    query.Get("source"),
+		Map:       query.Get("map"),
+		Ruleset:   query.Get("ruleset"),
+		SnakeName: query.Get("snake"),
+	}
+
+	var err error
+	if from := query.Get("from"); from != "" {
+		if filter.CreatedAfter, err = time.Parse(time.RFC3339, from); err != nil {
+			writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_request", Field: "from", Message: err.Error()})
+			return
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if filter.CreatedBefore, err = time.Parse(time.RFC3339, to); err != nil {
+			writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_request", Field: "to", Message: err.Error()})
+			return
+		}
+	}
+
+	limit := defaultListLimit
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxListLimit {
+			writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_request", Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", maxListLimit)})
+			return
+		}
+	}
+	offset := 0
+	if value := query.Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_request", Field: "offset", Message: "must be a positive number"})
+			return
+		}
+	}
+
+	games, total, err := persistentServer.ListGames(filter, limit, offset)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error listing games: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListGamesResponse{
+		Games:  games,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// Handle GET /games/{gameID}/export, which returns a finished or running game in the same JSONL format
+// as the output file written by `battlesnake play -o`.
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	gameID := mux.Vars(r)["gameID"]
+
+	game, err := persistentServer.GetGame(gameID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrorResponse{Error: "not_found", Message: err.Error()})
+		return
+	}
+	events, err := persistentServer.GetEvents(gameID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrorResponse{Error: "not_found", Message: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", gameID+".jsonl"))
+	if _, err := engine.NewGameExporterFromEvents(*game, events).FlushToFile(w); err != nil {
+		log.Printf("Unable to export game %v: %v", gameID, err)
+	}
+}
+
+// Handle GET /games/{gameID}/snakes/{snakeID}/diagnostics, which lists the result of every move request
+// made to a snake, including the failures that the game events only show as a generic error.
+func snakeDiagnosticsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gameID, snakeID := vars["gameID"], vars["snakeID"]
+
+	if _, err := persistentServer.GetGame(gameID); err != nil {
+		writeError(w, http.StatusNotFound, ErrorResponse{Error: "not_found", Message: err.Error()})
+		return
+	}
+	snake, err := diagnostics.snake(gameID, snakeID)
+	if errors.Is(err, errDiagnosticsNotFound) {
+		writeError(w, http.StatusNotFound, ErrorResponse{Error: "not_found", Message: err.Error()})
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting diagnostics: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SnakeDiagnosticsResponse{
+		GameID:  gameID,
+		SnakeID: snakeID,
+		Name:    snake.Name,
+		Moves:   snake.Moves,
+	})
+}
+
+// Handle GET /games/{gameID}/events, which streams the game events over a websocket, or as
+// Server-Sent Events for clients that accept text/event-stream.
+// Clients that reconnect can skip the turns they already have with the fromTurn query parameter,
+// or lastEventId set to the last turn they received.
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gameID := vars["gameID"]
+
+	fromTurn, err := parseFromTurn(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_request", Field: "fromTurn", Message: err.Error()})
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		streamEvents(w, r, gameID, fromTurn)
+		return
+	}
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Websocket upgrade failed: %v", err)
+		return
+	}
+	defer func() {
+		fmt.Printf("Closing WebSocket for game %v \n", gameID)
+		ws.Close()
+	}()
+	fmt.Printf("Websocket connection for GameID %v is established \n", gameID)
+
+	sub, err := persistentServer.SubscribeToGame(gameID, fromTurn)
+	if err != nil {
+		fmt.Printf("ERROR! Couldn't subscribe to game\n")
+		ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, err.Error()))
+		return
+	}
+	defer sub.Close()
+
+	// Clients don't send anything, but reading is needed to notice when they close the connection
+	go func() {
+		for {
+			if _, _, err := ws.NextReader(); err != nil {
+				sub.Close()
+				return
+			}
+		}
+	}()
+
+	for event := range sub.Events() {
+		if err := ws.WriteJSON(event); err != nil {
+			if !strings.Contains(err.Error(), "websocket: close") {
+				log.Printf("Websocket write error: %v", err)
+			}
+			return
+		}
+	}
+
+	if sub.Dropped() {
+		fmt.Printf("Websocket for game %v fell too far behind, disconnecting\n", gameID)
+		ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too far behind"))
+		return
+	}
+
+	fmt.Printf("All events have been written \n")
+	ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+// Stream the game events as Server-Sent Events, using the turn number as the event ID so that
+// reconnecting clients resume from the Last-Event-ID they received.
+func streamEvents(w http.ResponseWriter, r *http.Request, gameID string, fromTurn int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub, err := persistentServer.SubscribeToGame(gameID, fromTurn)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrorResponse{Error: "not_found", Message: err.Error()})
+		return
+	}
+	defer sub.Close()
+
+	// Stop sending events when the client goes away
+	go func() {
+		<-r.Context().Done()
+		sub.Close()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// The game end event doesn't have a turn of its own, so it uses the last turn sent
+	turn := fromTurn - 1
+	for event := range sub.Events() {
+		if frame, ok := event.Data.(board.GameFrame); ok {
+			turn = frame.Turn
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Unable to encode event for game %v: %v", gameID, err)
+			return
+		}
+		if turn >= 0 {
+			fmt.Fprintf(w, "id: %d\n", turn)
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.EventType, data); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+
+	if sub.Dropped() {
+		fmt.Printf("Event stream for game %v fell too far behind, disconnecting\n", gameID)
+	}
+}
+
+// The first turn to send events for, from the Last-Event-ID header sent by reconnecting
+// Server-Sent Events clients, or the fromTurn or lastEventId query parameters.
+func parseFromTurn(r *http.Request) (int, error) {
+	if value := r.Header.Get("Last-Event-ID"); value != "" {
+		turn, err := strconv.Atoi(value)
+		if err != nil || turn < 0 {
+			return 0, errors.New("Last-Event-ID must be a positive number")
+		}
+		return turn + 1, nil
+	}
+
+	query := r.URL.Query()
+	if value := query.Get("fromTurn"); value != "" {
+		turn, err := strconv.Atoi(value)
+		if err != nil || turn < 0 {
+			return 0, errors.New("must be a positive number")
+		}
+		return turn, nil
+	}
+	if value := query.Get("lastEventId"); value != "" {
+		turn, err := strconv.Atoi(value)
+		if err != nil || turn < 0 {
+			return 0, errors.New("lastEventId must be a positive number")
+		}
+		return turn + 1, nil
+	}
+	return 0, nil
+}
+
+// Handle GET /leaderboard, which lists the ratings of every snake that has played a rated game, from highest to lowest.
+func leaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	rankings, err := leaderboard.Rankings()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error listing ratings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LeaderboardResponse{Ratings: rankings})
+}
+
+// Handle GET /leaderboard/{snake}, which returns the current rating for a snake along with its rating history.
+func snakeRatingHandler(w http.ResponseWriter, r *http.Request) {
+	snake := mux.Vars(r)["snake"]
+
+	rating, err := leaderboard.Rating(snake)
+	if errors.Is(err, ratings.ErrSnakeNotRated) {
+		writeError(w, http.StatusNotFound, ErrorResponse{Error: "not_found", Message: err.Error()})
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting rating: %v", err), http.StatusInternalServerError)
+		return
+	}
+	history, err := leaderboard.History(snake)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting rating history: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SnakeRatingResponse{Rating: rating, History: history})
+}
+
+// Handle GET /snakes, which lists registered snakes.
+// Supports filtering with the owner, tag and online query parameters.
+func listSnakesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	snakes, err := registry.list(SnakeFilter{
+		Owner:      query.Get("owner"),
+		Tag:        query.Get("tag"),
+		OnlineOnly: query.Get("online") == "true",
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error listing snakes: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListSnakesResponse{Snakes: snakes})
+}
+
+// Handle POST /snakes, which registers a new snake.
+func registerSnakeHandler(w http.ResponseWriter, r *http.Request) {
+	var registration SnakeRegistration
+	if err := json.NewDecoder(r.Body).Decode(&registration); err != nil {
+		writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_request", Message: err.Error()})
+		return
+	}
+
+	var ownerKeyID string
+	if key, ok := apiKeyFromContext(r.Context()); ok {
+		ownerKeyID = key.ID
+	}
+	snake, err := registry.register(registration, ownerKeyID)
+	if err != nil {
+		writeRegistryError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(snake)
+}
+
+func snakeHandler(w http.ResponseWriter, r *http.Request) {
+	snake, err := registry.get(mux.Vars(r)["snakeID"])
+	if err != nil {
+		writeRegistryError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snake)
+}
+
+// Handle PUT /snakes/{snakeID}, which replaces the name, URL, owner and tags of a registered snake.
+func updateSnakeHandler(w http.ResponseWriter, r *http.Request) {
+	var registration SnakeRegistration
+	if err := json.NewDecoder(r.Body).Decode(&registration); err != nil {
+		writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_request", Message: err.Error()})
+		return
+	}
+	snakeID := mux.Vars(r)["snakeID"]
+	if !canManageSnake(w, r, snakeID) {
+		return
+	}
+
+	snake, err := registry.update(snakeID, registration)
+	if err != nil {
+		writeRegistryError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snake)
+}
+
+func deleteSnakeHandler(w http.ResponseWriter, r *http.Request) {
+	snakeID := mux.Vars(r)["snakeID"]
+	if !canManageSnake(w, r, snakeID) {
+		return
+	}
+
+	if err := registry.delete(snakeID); err != nil {
+		writeRegistryError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Check that the request's key can change a snake, writing the error response if it can't.
+func canManageSnake(w http.ResponseWriter, r *http.Request, snakeID string) bool {
+	key, ok := apiKeyFromContext(r.Context())
+	if !ok {
+		return true
+	}
+	snake, err := registry.get(snakeID)
+	if err != nil {
+		writeRegistryError(w, err)
+		return false
+	}
+	if !apiKeys.canManageSnake(key, snake) {
+		writeError(w, http.StatusForbidden, ErrorResponse{Error: "forbidden", Message: "snakes can only be changed by the API key that registered them"})
+		return false
+	}
+	return true
+}
+
+// Reject a game that can't be played, with the field that caused it when the config error says which one.
+func writeGameConfigError(w http.ResponseWriter, err error) {
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_game_config", Field: configErr.Field, Message: configErr.Message})
+		return
+	}
+	writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_game_config", Message: err.Error()})
+}
+
+func writeRegistryError(w http.ResponseWriter, err error) {
+	var configErr *ConfigError
+	switch {
+	case errors.As(err, &configErr):
+		writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_snake", Field: configErr.Field, Message: configErr.Message})
+	case errors.Is(err, errSnakeNotFound):
+		writeError(w, http.StatusNotFound, ErrorResponse{Error: "not_found", Message: err.Error()})
+	case errors.Is(err, errSnakeNameTaken):
+		writeError(w, http.StatusConflict, ErrorResponse{Error: "name_taken", Field: "name", Message: err.Error()})
+	default:
+		http.Error(w, fmt.Sprintf("Error updating snake registry: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// Handle GET /webhooks, which lists the webhooks that are notified about every game.
+func listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := webhooks.listWebhooks()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error listing webhooks: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListWebhooksResponse{Webhooks: list})
+}
+
+// Handle POST /webhooks, which adds a webhook that is notified when any game finishes or is cancelled.
+func addWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var req AddWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_request", Message: err.Error()})
+		return
+	}
+
+	webhook, err := webhooks.addWebhook(req.URL)
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_webhook", Field: "url", Message: configErr.Message})
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Error adding webhook: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	err := webhooks.deleteWebhook(mux.Vars(r)["webhookID"])
+	if errors.Is(err, errWebhookNotFound) {
+		writeError(w, http.StatusNotFound, ErrorResponse{Error: "not_found", Message: err.Error()})
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Error deleting webhook: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Handle GET /webhooks/deliveries, which returns the webhook delivery log, newest first.
+// The gameId query parameter limits the log to a single game.
+func listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := webhooks.listDeliveries(r.URL.Query().Get("gameId"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error listing webhook deliveries: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListWebhookDeliveriesResponse{Deliveries: deliveries})
+}
+
+// Handle GET /metrics, in the Prometheus text format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	running, queued := runner.counts()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	gameMetrics.writeTo(w, running, queued, persistentServer.SubscriberCount())
+}
+
+// Handle GET /admin/keys, which lists the API keys without their secrets.
+func listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := apiKeys.listKeys()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error listing API keys: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListAPIKeysResponse{Keys: keys})
+}
+
+// Handle POST /admin/keys, which creates an API key. The secret key is only returned in this response.
+func createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_request", Message: err.Error()})
+		return
+	}
+
+	key, secret, err := apiKeys.createKey(req)
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		writeError(w, http.StatusBadRequest, ErrorResponse{Error: "invalid_api_key", Field: configErr.Field, Message: configErr.Message})
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Error creating API key: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateAPIKeyResponse{Key: key, Secret: secret})
+}
+
+func deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	err := apiKeys.deleteKey(mux.Vars(r)["keyID"])
+	if errors.Is(err, errAPIKeyNotFound) {
+		writeError(w, http.StatusNotFound, ErrorResponse{Error: "not_found", Message: err.Error()})
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Error deleting API key: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, response ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
+func indexHandler(w http.ResponseWriter, r *http.Request) {
+	response := IndexResponse{Status: "Ok"}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
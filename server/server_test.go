@@ -0,0 +1,242 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BattlesnakeOfficial/rules"
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/BattlesnakeOfficial/rules/ratings"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFromTurn(t *testing.T) {
+	tests := []struct {
+		query       string
+		lastEventID string
+		expected    int
+		err         bool
+	}{
+		{"", "", 0, false},
+		{"?fromTurn=12", "", 12, false},
+		{"?lastEventId=12", "", 13, false},
+		{"?fromTurn=3&lastEventId=12", "", 3, false},
+		{"?fromTurn=3", "20", 21, false},
+		{"?fromTurn=-1", "", 0, true},
+		{"?lastEventId=abc", "", 0, true},
+		{"", "abc", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query+test.lastEventID, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/games/GAME_ID/events"+test.query, nil)
+			if test.lastEventID != "" {
+				r.Header.Set("Last-Event-ID", test.lastEventID)
+			}
+			fromTurn, err := parseFromTurn(r)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, fromTurn)
+		})
+	}
+}
+
+func TestEventsHandlerServerSentEvents(t *testing.T) {
+	persistentServer = board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	persistentServer.AddGame(board.Game{ID: "GAME_ID"})
+	for turn := 0; turn < 3; turn++ {
+		persistentServer.SendEvent("GAME_ID", board.GameEvent{EventType: board.EVENT_TYPE_FRAME, Data: board.GameFrame{Turn: turn}})
+	}
+	persistentServer.SendEvent("GAME_ID", board.GameEvent{EventType: board.EVENT_TYPE_GAME_END, Data: board.Game{ID: "GAME_ID"}})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/games/{gameID}/events", eventsHandler)
+
+	r := httptest.NewRequest("GET", "/games/GAME_ID/events", nil)
+	r.Header.Set("Accept", "text/event-stream")
+	r.Header.Set("Last-Event-ID", "0")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	require.Equal(t, ""+
+		"id: 1\nevent: frame\ndata: {\"Type\":\"frame\",\"Data\":"+frameJSON(t, 1)+"}\n\n"+
+		"id: 2\nevent: frame\ndata: {\"Type\":\"frame\",\"Data\":"+frameJSON(t, 2)+"}\n\n"+
+		"id: 2\nevent: game_end\ndata: {\"Type\":\"game_end\",\"Data\":"+gameJSON(t)+"}\n\n",
+		w.Body.String())
+
+	r = httptest.NewRequest("GET", "/games/MISSING/events", nil)
+	r.Header.Set("Accept", "text/event-stream")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, 404, w.Code)
+}
+
+func frameJSON(t *testing.T, turn int) string {
+	data, err := json.Marshal(board.GameFrame{Turn: turn})
+	require.NoError(t, err)
+	return string(data)
+}
+
+func gameJSON(t *testing.T) string {
+	data, err := json.Marshal(board.Game{ID: "GAME_ID"})
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestExportHandler(t *testing.T) {
+	persistentServer = board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	persistentServer.AddGame(board.Game{ID: "GAME_ID", RulesetName: "standard", Map: "standard", Width: 11, Height: 11})
+	persistentServer.SendEvent("GAME_ID", board.GameEvent{EventType: board.EVENT_TYPE_FRAME, Data: board.GameFrame{
+		Turn:   0,
+		Snakes: []board.Snake{{ID: "snk_0", Name: "snake", Body: []rules.Point{{X: 1, Y: 1}}}},
+	}})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/games/{gameID}/export", exportHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/games/GAME_ID/export", nil))
+	require.Equal(t, 200, w.Code)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 3)
+	require.Contains(t, lines[0], `"id":"GAME_ID"`)
+	require.Contains(t, lines[1], `"turn":0`)
+	require.JSONEq(t, `{"winnerId": "", "winnerName": "", "isDraw": false}`, lines[2])
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/games/MISSING/export", nil))
+	require.Equal(t, 404, w.Code)
+}
+
+func TestLeaderboardHandlers(t *testing.T) {
+	leaderboard = ratings.NewLeaderboard(board.NewMemoryGameStore())
+	require.NoError(t, leaderboard.RecordGame(
+		board.GameSummary{Game: board.Game{ID: "GAME_ID", Status: board.GameStatusComplete}},
+		[]board.GameEvent{{EventType: board.EVENT_TYPE_FRAME, Data: board.GameFrame{Snakes: []board.Snake{
+			{Name: "winner"},
+			{Name: "loser", Death: &board.Death{Turn: 1}},
+		}}}},
+	))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/leaderboard", leaderboardHandler)
+	router.HandleFunc("/leaderboard/{snake}", snakeRatingHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/leaderboard", nil))
+	require.Equal(t, 200, w.Code)
+	var response LeaderboardResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Ratings, 2)
+	require.Equal(t, "winner", response.Ratings[0].Snake)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/leaderboard/loser", nil))
+	require.Equal(t, 200, w.Code)
+	var snakeResponse SnakeRatingResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &snakeResponse))
+	require.Equal(t, "loser", snakeResponse.Rating.Snake)
+	require.Len(t, snakeResponse.History, 1)
+	require.Equal(t, "GAME_ID", snakeResponse.History[0].GameID)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/leaderboard/missing", nil))
+	require.Equal(t, 404, w.Code)
+}
+
+func TestPlayHandlerUnknownSnakeID(t *testing.T) {
+	registry = newSnakeRegistry(board.NewMemoryGameStore())
+
+	w := httptest.NewRecorder()
+	playHandler(w, httptest.NewRequest("POST", "/play", strings.NewReader(`{"snakeIds": ["missing"]}`)))
+	require.Equal(t, 400, w.Code)
+	var response ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, "invalid_game_config", response.Error)
+	require.Equal(t, "snakeIds", response.Field)
+}
+
+func TestPlayHandler(t *testing.T) {
+	persistentServer = board.NewPersistentBoardServer(board.NewMemoryGameStore())
+	runner = newGameRunner(persistentServer, 1, 10)
+	registry = newSnakeRegistry(board.NewMemoryGameStore())
+	webhooks = newWebhookNotifier(board.NewMemoryGameStore(), "https://example.com")
+	publicURL = "https://example.com"
+	boardURL = "https://board.example.com"
+	body := fmt.Sprintf(`{"players": [{"name": "snake", "url": %q}]}`, newMovingSnake(t))
+
+	w := httptest.NewRecorder()
+	playHandler(w, httptest.NewRequest("POST", "/play", strings.NewReader(body)))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var response PlayResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.NotEmpty(t, response.ID)
+	require.Contains(t, []string{board.GameStatusQueued, board.GameStatusRunning, board.GameStatusComplete}, response.Status)
+	require.Equal(t, "https://example.com/games/"+response.ID, response.URL)
+	require.Equal(t, response.URL, w.Header().Get("Location"))
+	require.Equal(t, "wss://example.com/games/"+response.ID+"/events", response.EventsURL)
+	require.Equal(t, "https://board.example.com?engine=https%3A%2F%2Fexample.com&game="+response.ID+"&autoplay=true", response.BoardURL)
+	require.Equal(t, "https://example.com/games/"+response.ID+"/export", response.ExportURL)
+	require.Nil(t, response.Result)
+
+	// Waiting returns the result once the game has ended
+	w = httptest.NewRecorder()
+	playHandler(w, httptest.NewRequest("POST", "/play?wait=true", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code)
+	response = PlayResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, board.GameStatusComplete, response.Status)
+	require.NotNil(t, response.Result)
+	require.Equal(t, response.ID, response.Result.Game.ID)
+	require.Equal(t, []string{"snake"}, response.Result.Snakes)
+	require.False(t, response.Result.Ended.IsZero())
+
+	w = httptest.NewRecorder()
+	playHandler(w, httptest.NewRequest("POST", "/play?wait=maybe", strings.NewReader(body)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestWebsocketURL(t *testing.T) {
+	require.Equal(t, "ws://localhost:8080", websocketURL("http://localhost:8080"))
+	require.Equal(t, "wss://example.com/battlesnake", websocketURL("https://example.com/battlesnake"))
+}
+
+func TestPlayHandlerPrivateWebhook(t *testing.T) {
+	body := fmt.Sprintf(`{"players": [{"name": "snake", "url": %q}], "webhooks": ["http://127.0.0.1:8080/hook"]}`, newMovingSnake(t))
+
+	w := httptest.NewRecorder()
+	playHandler(w, httptest.NewRequest("POST", "/play", strings.NewReader(body)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var response ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, "invalid_game_config", response.Error)
+	require.Equal(t, "webhooks", response.Field)
+}
+
+func TestWriteGameConfigError(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeGameConfigError(w, &ConfigError{Field: "width", Message: "must be at most 25"})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var response ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, ErrorResponse{Error: "invalid_game_config", Field: "width", Message: "must be at most 25"}, response)
+
+	// Other errors are still rejected, without a field
+	w = httptest.NewRecorder()
+	writeGameConfigError(w, errors.New("something else went wrong"))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	response = ErrorResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, ErrorResponse{Error: "invalid_game_config", Message: "something else went wrong"}, response)
+}
@@ -0,0 +1,437 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/google/uuid"
+)
+
+const (
+	webhooksCollection          = "webhooks"
+	webhookDeliveriesCollection = "webhook_deliveries"
+)
+
+var errWebhookNotFound = errors.New("webhook not found")
+
+// The delays before retrying a failed webhook delivery. Delivery is abandoned after the last retry fails.
+var webhookRetryDelays = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second, 2 * time.Minute, 10 * time.Minute}
+
+// The number of deliveries kept in the delivery log. The oldest are removed as new deliveries are made.
+const maxWebhookDeliveries = 1000
+
+// A webhook that is notified about every game.
+type Webhook struct {
+	ID      string    `json:"id"`
+	URL     string    `json:"url"`
+	Created time.Time `json:"created"`
+}
+
+// The JSON body posted to webhooks when a game finishes or is cancelled.
+type WebhookPayload struct {
+	GameID     string             `json:"gameId"`
+	Status     string             `json:"status"`
+	Source     string             `json:"source"`
+	WinnerID   string             `json:"winnerId"`
+	WinnerName string             `json:"winnerName"`
+	IsDraw     bool               `json:"isDraw"`
+	Placements []WebhookPlacement `json:"placements"`
+	Turn       int                `json:"turn"`
+	ExportURL  string             `json:"exportUrl"`
+}
+
+type WebhookPlacement struct {
+	SnakeID         string `json:"snakeId"`
+	SnakeName       string `json:"snakeName"`
+	Placement       int    `json:"placement"`
+	EliminatedTurn  int    `json:"eliminatedTurn,omitempty"`
+	EliminatedCause string `json:"eliminatedCause,omitempty"`
+}
+
+// A record of posting a game result to a webhook, including every attempt that was made.
+type WebhookDelivery struct {
+	ID         string           `json:"id"`
+	WebhookURL string           `json:"webhookUrl"`
+	GameID     string           `json:"gameId"`
+	Delivered  bool             `json:"delivered"`
+	Attempts   []WebhookAttempt `json:"attempts"`
+	Created    time.Time        `json:"created"`
+}
+
+type WebhookAttempt struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Posts game results to the global webhooks, and to the webhooks given when each game was started.
+type webhookNotifier struct {
+	store        board.RecordStore
+	httpClient   *http.Client
+	publicClient *http.Client // only connects to public addresses, for webhooks given by callers without an admin key
+	publicURL    string
+	retryDelays  []time.Duration
+
+	mu            sync.Mutex
+	gameWebhooks  map[string]gameWebhooks // game ID to the webhooks for that game only
+	deliveryLog   []string                // the IDs of the deliveries kept in the store, oldest first
+	maxDeliveries int
+	deliveries    sync.WaitGroup
+	stopping      chan struct{} // closed when the server is shutting down, to stop waiting to retry
+	stopOnce      sync.Once
+}
+
+type gameWebhooks struct {
+	urls       []string
+	publicOnly bool
+}
+
+func newWebhookNotifier(store board.RecordStore, publicURL string) *webhookNotifier {
+	// The address is checked when connecting rather than when the webhook is given, so that a
+	// hostname can't be changed to resolve to a private address in between
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network string, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("webhook address %s is not a public address", host)
+			}
+			return nil
+		},
+	}
+	publicTransport := http.DefaultTransport.(*http.Transport).Clone()
+	publicTransport.Proxy = nil
+	publicTransport.DialContext = dialer.DialContext
+
+	notifier := &webhookNotifier{
+		store:         store,
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+		publicClient:  &http.Client{Timeout: 10 * time.Second, Transport: publicTransport},
+		publicURL:     strings.TrimSuffix(publicURL, "/"),
+		retryDelays:   webhookRetryDelays,
+		gameWebhooks:  make(map[string]gameWebhooks),
+		maxDeliveries: maxWebhookDeliveries,
+		stopping:      make(chan struct{}),
+	}
+
+	// Pick up the deliveries logged before the server last stopped, so that they are removed in turn
+	deliveries, err := notifier.listDeliveries("")
+	if err != nil {
+		log.Printf("Unable to list webhook deliveries: %v", err)
+	}
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		notifier.deliveryLog = append(notifier.deliveryLog, deliveries[i].ID)
+	}
+	return notifier
+}
+
+func validateWebhookURL(webhookURL string) error {
+	if u, err := url.ParseRequestURI(webhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return &ConfigError{Field: "webhooks", Message: fmt.Sprintf("%q is not a valid http(s) URL", webhookURL)}
+	}
+	return nil
+}
+
+// Check that a webhook doesn't point at the server's own network, for webhooks given by callers without an admin key.
+// Hostnames are checked again once they are resolved, when the webhook is posted.
+func validatePublicWebhookURL(webhookURL string) error {
+	if err := validateWebhookURL(webhookURL); err != nil {
+		return err
+	}
+	u, _ := url.ParseRequestURI(webhookURL)
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	ip := net.ParseIP(host)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || (ip != nil && !isPublicIP(ip)) {
+		return &ConfigError{Field: "webhooks", Message: fmt.Sprintf("%q is not a public address, which requires an admin API key", webhookURL)}
+	}
+	return nil
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() && !ip.IsMulticast()
+}
+
+func (notifier *webhookNotifier) addWebhook(webhookURL string) (Webhook, error) {
+	if err := validateWebhookURL(webhookURL); err != nil {
+		return Webhook{}, err
+	}
+	webhook := Webhook{
+		ID:      uuid.New().String(),
+		URL:     webhookURL,
+		Created: time.Now(),
+	}
+	if err := notifier.store.PutRecord(webhooksCollection, webhook.ID, webhook); err != nil {
+		return Webhook{}, err
+	}
+	return webhook, nil
+}
+
+func (notifier *webhookNotifier) deleteWebhook(webhookID string) error {
+	var webhook Webhook
+	if err := notifier.store.GetRecord(webhooksCollection, webhookID, &webhook); errors.Is(err, board.ErrRecordNotFound) {
+		return fmt.Errorf("%w: %s", errWebhookNotFound, webhookID)
+	} else if err != nil {
+		return err
+	}
+	return notifier.store.DeleteRecord(webhooksCollection, webhookID)
+}
+
+// List the global webhooks, oldest first.
+func (notifier *webhookNotifier) listWebhooks() ([]Webhook, error) {
+	webhookIDs, err := notifier.store.ListRecords(webhooksCollection)
+	if err != nil {
+		return nil, err
+	}
+	webhooks := make([]Webhook, 0, len(webhookIDs))
+	for _, webhookID := range webhookIDs {
+		var webhook Webhook
+		if err := notifier.store.GetRecord(webhooksCollection, webhookID, &webhook); errors.Is(err, board.ErrRecordNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].Created.Before(webhooks[j].Created)
+	})
+	return webhooks, nil
+}
+
+// Notify extra webhooks when a game ends, as well as the global webhooks.
+// When publicOnly is set, the webhooks are only posted to if they resolve to public addresses.
+// This must be called before the game starts, so that it can't end first.
+func (notifier *webhookNotifier) watchGame(gameID string, webhookURLs []string, publicOnly bool) {
+	if len(webhookURLs) == 0 {
+		return
+	}
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	watched := notifier.gameWebhooks[gameID]
+	watched.urls = append(watched.urls, webhookURLs...)
+	watched.publicOnly = watched.publicOnly || publicOnly
+	notifier.gameWebhooks[gameID] = watched
+}
+
+// Stop tracking the webhooks for a game that will never be run.
+func (notifier *webhookNotifier) forgetGame(gameID string) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	delete(notifier.gameWebhooks, gameID)
+}
+
+// Post the result of a game to its webhooks in the background, if it finished or was cancelled.
+// Games that failed or were interrupted by the server stopping aren't sent.
+// It is registered with PersistentBoardServer.OnGameEnd.
+func (notifier *webhookNotifier) gameEnded(summary board.GameSummary, events []board.GameEvent) {
+	notifier.mu.Lock()
+	watched := notifier.gameWebhooks[summary.Game.ID]
+	delete(notifier.gameWebhooks, summary.Game.ID)
+	notifier.mu.Unlock()
+
+	if summary.Game.Status != board.GameStatusComplete && summary.Game.Status != board.GameStatusCancelled {
+		return
+	}
+
+	// The game's own webhooks come first, followed by the global webhooks
+	webhookURLs := append([]string(nil), watched.urls...)
+	webhooks, err := notifier.listWebhooks()
+	if err != nil {
+		log.Printf("Unable to list webhooks for game %v: %v", summary.Game.ID, err)
+	}
+	for _, webhook := range webhooks {
+		webhookURLs = append(webhookURLs, webhook.URL)
+	}
+	if len(webhookURLs) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(notifier.buildPayload(summary, events))
+	if err != nil {
+		log.Printf("Unable to serialize webhook payload for game %v: %v", summary.Game.ID, err)
+		return
+	}
+	for i, webhookURL := range webhookURLs {
+		httpClient := notifier.httpClient
+		if i < len(watched.urls) && watched.publicOnly {
+			httpClient = notifier.publicClient
+		}
+		delivery := WebhookDelivery{
+			ID:         uuid.New().String(),
+			WebhookURL: webhookURL,
+			GameID:     summary.Game.ID,
+			Attempts:   []WebhookAttempt{},
+			Created:    time.Now(),
+		}
+		notifier.logDelivery(delivery.ID)
+		notifier.deliveries.Add(1)
+		go func() {
+			defer notifier.deliveries.Done()
+			notifier.deliver(httpClient, delivery, payload)
+		}()
+	}
+}
+
+func (notifier *webhookNotifier) buildPayload(summary board.GameSummary, events []board.GameEvent) WebhookPayload {
+	payload := WebhookPayload{
+		GameID:     summary.Game.ID,
+		Status:     summary.Game.Status,
+		Source:     summary.Game.Source,
+		WinnerID:   summary.WinnerID,
+		WinnerName: summary.WinnerName,
+		IsDraw:     summary.IsDraw,
+		Placements: []WebhookPlacement{},
+		Turn:       summary.Turn,
+		ExportURL:  fmt.Sprintf("%s/games/%s/export", notifier.publicURL, url.PathEscape(summary.Game.ID)),
+	}
+
+	var lastFrame *board.GameFrame
+	for _, event := range events {
+		if frame, ok := event.Data.(board.GameFrame); ok {
+			lastFrame = &frame
+		}
+	}
+	if lastFrame == nil {
+		return payload
+	}
+	for _, placement := range board.Placements(*lastFrame) {
+		payload.Placements = append(payload.Placements, WebhookPlacement{
+			SnakeID:         placement.SnakeID,
+			SnakeName:       placement.SnakeName,
+			Placement:       placement.Placement,
+			EliminatedTurn:  placement.EliminatedTurn,
+			EliminatedCause: placement.EliminatedCause,
+		})
+	}
+	return payload
+}
+
+// Post the payload until the webhook accepts it or the retries run out, recording every attempt in the delivery log.
+func (notifier *webhookNotifier) deliver(httpClient *http.Client, delivery WebhookDelivery, payload []byte) {
+	for attempt := 0; ; attempt++ {
+		result := postWebhook(httpClient, delivery.WebhookURL, payload)
+		delivery.Attempts = append(delivery.Attempts, result)
+		delivery.Delivered = result.Error == ""
+		notifier.saveDelivery(delivery)
+
+		if delivery.Delivered {
+			return
+		}
+		if attempt >= len(notifier.retryDelays) {
+			log.Printf("Giving up on webhook %v for game %v after %d attempts: %v", delivery.WebhookURL, delivery.GameID, attempt+1, result.Error)
+			return
+		}
+		select {
+		case <-time.After(notifier.retryDelays[attempt]):
+		case <-notifier.stopping:
+			log.Printf("Giving up on webhook %v for game %v because the server is stopping: %v", delivery.WebhookURL, delivery.GameID, result.Error)
+			return
+		}
+	}
+}
+
+// Add a new delivery to the log, removing the oldest deliveries once the log is full.
+func (notifier *webhookNotifier) logDelivery(deliveryID string) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+
+	notifier.deliveryLog = append(notifier.deliveryLog, deliveryID)
+	for len(notifier.deliveryLog) > notifier.maxDeliveries {
+		if err := notifier.store.DeleteRecord(webhookDeliveriesCollection, notifier.deliveryLog[0]); err != nil {
+			log.Printf("Unable to remove webhook delivery %v: %v", notifier.deliveryLog[0], err)
+		}
+		notifier.deliveryLog = notifier.deliveryLog[1:]
+	}
+}
+
+// Save the attempts made for a delivery, unless it has already been removed from the log while being retried.
+func (notifier *webhookNotifier) saveDelivery(delivery WebhookDelivery) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+
+	if !slices.Contains(notifier.deliveryLog, delivery.ID) {
+		return
+	}
+	if err := notifier.store.PutRecord(webhookDeliveriesCollection, delivery.ID, delivery); err != nil {
+		log.Printf("Unable to save webhook delivery %v: %v", delivery.ID, err)
+	}
+}
+
+// Stop retrying failed deliveries, and wait for the deliveries in progress to finish or the context to be done.
+func (notifier *webhookNotifier) shutdown(ctx context.Context) error {
+	notifier.stopOnce.Do(func() {
+		close(notifier.stopping)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		notifier.deliveries.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func postWebhook(httpClient *http.Client, webhookURL string, payload []byte) WebhookAttempt {
+	attempt := WebhookAttempt{Time: time.Now()}
+	res, err := httpClient.Post(webhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	attempt.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("unexpected status code %d", res.StatusCode)
+	}
+	return attempt
+}
+
+// List the delivery log, newest first, optionally only for one game.
+func (notifier *webhookNotifier) listDeliveries(gameID string) ([]WebhookDelivery, error) {
+	deliveryIDs, err := notifier.store.ListRecords(webhookDeliveriesCollection)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]WebhookDelivery, 0, len(deliveryIDs))
+	for _, deliveryID := range deliveryIDs {
+		var delivery WebhookDelivery
+		if err := notifier.store.GetRecord(webhookDeliveriesCollection, deliveryID, &delivery); errors.Is(err, board.ErrRecordNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if gameID == "" || delivery.GameID == gameID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].Created.After(deliveries[j].Created)
+	})
+	return deliveries, nil
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BattlesnakeOfficial/rules/board"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var mu sync.Mutex
+	var received []WebhookPayload
+	requests := 0
+	// Fails the first request, to check that deliveries are retried
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var payload WebhookPayload
+		body, _ := io.ReadAll(r.Body)
+		require.NoError(t, json.Unmarshal(body, &payload))
+		received = append(received, payload)
+	}))
+	defer webhookServer.Close()
+
+	notifier := newWebhookNotifier(board.NewMemoryGameStore(), "http://example.com/")
+	notifier.retryDelays = []time.Duration{time.Millisecond}
+
+	_, err := notifier.addWebhook("not a url")
+	require.Error(t, err)
+	webhook, err := notifier.addWebhook(webhookServer.URL + "/global")
+	require.NoError(t, err)
+	list, err := notifier.listWebhooks()
+	require.NoError(t, err)
+	require.Equal(t, []string{webhook.ID}, []string{list[0].ID})
+
+	notifier.watchGame("GAME_ID", []string{"http://localhost:1/unreachable"}, false)
+
+	game := board.Game{ID: "GAME_ID", Status: board.GameStatusComplete, Source: "API"}
+	events := []board.GameEvent{
+		{EventType: board.EVENT_TYPE_FRAME, Data: board.GameFrame{Turn: 7, Snakes: []board.Snake{
+			{ID: "1", Name: "winner"},
+			{ID: "2", Name: "loser", Death: &board.Death{Turn: 7, Cause: "wall-collision"}},
+		}}},
+		{EventType: board.EVENT_TYPE_GAME_END, Data: game},
+	}
+	notifier.gameEnded(board.NewGameSummary(game, events, time.Now(), time.Now()), events)
+	notifier.deliveries.Wait()
+
+	require.Len(t, received, 1)
+	require.Equal(t, WebhookPayload{
+		GameID:     "GAME_ID",
+		Status:     board.GameStatusComplete,
+		Source:     "API",
+		WinnerID:   "1",
+		WinnerName: "winner",
+		Placements: []WebhookPlacement{
+			{SnakeID: "1", SnakeName: "winner", Placement: 1},
+			{SnakeID: "2", SnakeName: "loser", Placement: 2, EliminatedTurn: 7, EliminatedCause: "wall-collision"},
+		},
+		Turn:      7,
+		ExportURL: "http://example.com/games/GAME_ID/export",
+	}, received[0])
+
+	deliveries, err := notifier.listDeliveries("GAME_ID")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	for _, delivery := range deliveries {
+		require.Len(t, delivery.Attempts, 2)
+		if delivery.WebhookURL == webhookServer.URL+"/global" {
+			require.True(t, delivery.Delivered)
+			require.Equal(t, http.StatusServiceUnavailable, delivery.Attempts[0].StatusCode)
+			require.Equal(t, http.StatusOK, delivery.Attempts[1].StatusCode)
+		} else {
+			require.False(t, delivery.Delivered)
+			require.NotEmpty(t, delivery.Attempts[1].Error)
+		}
+	}
+
+	deliveries, err = notifier.listDeliveries("OTHER_GAME")
+	require.NoError(t, err)
+	require.Empty(t, deliveries)
+
+	// Webhooks given for a game are only used once
+	notifier.gameEnded(board.NewGameSummary(game, events, time.Now(), time.Now()), events)
+	notifier.deliveries.Wait()
+	deliveries, err = notifier.listDeliveries("GAME_ID")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 3)
+
+	require.NoError(t, notifier.deleteWebhook(webhook.ID))
+	require.ErrorIs(t, notifier.deleteWebhook(webhook.ID), errWebhookNotFound)
+}
+
+func TestPublicWebhooks(t *testing.T) {
+	for _, webhookURL := range []string{"http://localhost:8080/hook", "http://127.0.0.1/hook", "http://10.1.2.3/hook", "http://[::1]/hook", "http://169.254.169.254/latest", "ftp://example.com"} {
+		require.Error(t, validatePublicWebhookURL(webhookURL), webhookURL)
+	}
+	require.NoError(t, validatePublicWebhookURL("https://example.com/hook"))
+	require.NoError(t, validatePublicWebhookURL("http://8.8.8.8/hook"))
+
+	requests := 0
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer webhookServer.Close()
+
+	// Hostnames that resolve to private addresses are refused when connecting
+	notifier := newWebhookNotifier(board.NewMemoryGameStore(), "http://example.com")
+	notifier.retryDelays = nil
+	notifier.watchGame("GAME_ID", []string{webhookServer.URL}, true)
+	game := board.Game{ID: "GAME_ID", Status: board.GameStatusComplete}
+	notifier.gameEnded(board.NewGameSummary(game, nil, time.Now(), time.Now()), nil)
+	notifier.deliveries.Wait()
+
+	require.Zero(t, requests)
+	deliveries, err := notifier.listDeliveries("GAME_ID")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.False(t, deliveries[0].Delivered)
+	require.Contains(t, deliveries[0].Attempts[0].Error, "not a public address")
+}
+
+func TestWebhookNotifierDeliveryLog(t *testing.T) {
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer webhookServer.Close()
+
+	store := board.NewMemoryGameStore()
+	notifier := newWebhookNotifier(store, "http://example.com")
+	notifier.maxDeliveries = 2
+	_, err := notifier.addWebhook(webhookServer.URL)
+	require.NoError(t, err)
+
+	endGame := func(gameID string, status string) {
+		game := board.Game{ID: gameID, Status: status}
+		notifier.gameEnded(board.NewGameSummary(game, nil, time.Now(), time.Now()), nil)
+		notifier.deliveries.Wait()
+	}
+
+	// Games that failed or were aborted aren't sent
+	endGame("ERROR_GAME", board.GameStatusError)
+	endGame("ABORTED_GAME", board.GameStatusAborted)
+	deliveries, err := notifier.listDeliveries("")
+	require.NoError(t, err)
+	require.Empty(t, deliveries)
+
+	// Only the newest deliveries are kept, including after a restart
+	endGame("GAME_1", board.GameStatusComplete)
+	endGame("GAME_2", board.GameStatusCancelled)
+	endGame("GAME_3", board.GameStatusComplete)
+	restarted := newWebhookNotifier(store, "http://example.com")
+	restarted.maxDeliveries = 2
+	restarted.gameEnded(board.NewGameSummary(board.Game{ID: "GAME_4", Status: board.GameStatusComplete}, nil, time.Now(), time.Now()), nil)
+	restarted.deliveries.Wait()
+
+	deliveries, err = restarted.listDeliveries("")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	require.Equal(t, "GAME_4", deliveries[0].GameID)
+	require.Equal(t, "GAME_3", deliveries[1].GameID)
+}
+
+func TestWebhookNotifierShutdown(t *testing.T) {
+	notifier := newWebhookNotifier(board.NewMemoryGameStore(), "http://example.com")
+	notifier.retryDelays = []time.Duration{time.Hour}
+	notifier.watchGame("GAME_ID", []string{"http://localhost:1/unreachable"}, false)
+	notifier.gameEnded(board.NewGameSummary(board.Game{ID: "GAME_ID", Status: board.GameStatusComplete}, nil, time.Now(), time.Now()), nil)
+
+	// Deliveries waiting to be retried give up once the server is stopping
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, notifier.shutdown(ctx))
+	deliveries, err := notifier.listDeliveries("GAME_ID")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Len(t, deliveries[0].Attempts, 1)
+	require.False(t, deliveries[0].Delivered)
+}